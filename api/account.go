@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+)
+
+// exportUserHandler handles the "GET /v1/user/me/export" endpoint. It returns all the personal
+// data held about the user as a downloadable JSON document, including their point history.
+func (app *Application) exportUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var codes []string
+	for code := range user.Vouchers {
+		codes = append(codes, code)
+	}
+
+	vouchers := []envelope{}
+	if len(codes) > 0 {
+		details, err := app.Models.Vouchers.GetVoucherList(r.Context(), codes)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for _, voucher := range details {
+			vouchers = append(vouchers, envelope{
+				"voucher":         voucher,
+				"usage_remaining": user.Vouchers[voucher.Code],
+			})
+		}
+	}
+
+	events, err := app.Models.Events.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Split the points earned and spent from the security events.
+	securityEvents := []data.Event{}
+	pointHistory := []data.Event{}
+	for _, event := range events {
+		switch event.Type {
+		case data.EventPointsEarned, data.EventPointsSpent, data.EventPointsAdjusted:
+			pointHistory = append(pointHistory, event)
+		default:
+			securityEvents = append(securityEvents, event)
+		}
+	}
+
+	sessions, err := app.Models.Sessions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	identities := []envelope{}
+	for _, identity := range user.Identities {
+		identities = append(identities, envelope{"provider": identity.Provider, "linked_at": identity.LinkedAt})
+	}
+
+	env := envelope{
+		"exported_at": time.Now(),
+		"profile": envelope{
+			"id":          user.ID,
+			"name":        user.Name,
+			"email":       user.Email,
+			"addresses":   user.Addresses,
+			"phone":       user.Phone,
+			"created_at":  user.CreatedAt,
+			"updated_at":  user.UpdatedAt,
+			"mfa_enabled": user.MFA.Enabled,
+			"identities":  identities,
+		},
+		"points":        user.Points,
+		"point_history": pointHistory,
+		"vouchers":      vouchers,
+		"sessions":      sessions,
+		"events":        securityEvents,
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="savingsquads-export-%s.json"`, time.Now().Format("2006-01-02")))
+	headers.Set("Cache-Control", "no-store")
+
+	err = app.writeJSON(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteUserHandler handles the "DELETE /v1/user/me" endpoint. The account isn't deleted straight
+// away, but scheduled to be anonymized once the cooling-off period has passed, during which the
+// user can still log in and cancel the deletion.
+func (app *Application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	if user.IsDeletionScheduled() {
+		app.deletionAlreadyScheduledResponse(w, r, user.DeletionScheduledAt)
+		return
+	}
+
+	at := time.Now().Add(app.Config.Deletion.CoolingOff)
+	err := app.Models.Users.ScheduleDeletion(r.Context(), user.ID, at)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Events.Insert(r.Context(), &data.Event{
+		UserID:     user.ID,
+		Type:       data.EventDeletionRequested,
+		CreatedAt:  time.Now(),
+		Properties: map[string]string{"scheduled_at": at.Format(time.RFC3339)},
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"message": "account scheduled for deletion", "scheduled_at": at}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// cancelDeletionHandler handles the "DELETE /v1/user/me/deletion" endpoint, cancelling a
+// scheduled account deletion.
+func (app *Application) cancelDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	if !user.IsDeletionScheduled() {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err := app.Models.Users.CancelDeletion(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Events.Insert(r.Context(), &data.Event{
+		UserID:    user.ID,
+		Type:      data.EventDeletionCancelled,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "account deletion cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runAccountDeletions anonymizes the accounts whose deletion is due every Deletion.Interval,
+// until stop is closed.
+func (app *Application) runAccountDeletions(stop <-chan struct{}) {
+	ticker := time.NewTicker(app.Config.Deletion.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			err := app.deleteDueAccounts(context.Background(), now)
+			if err != nil {
+				app.Logger.PrintError(err, nil)
+			}
+		}
+	}
+}
+
+// deleteDueAccounts anonymizes every account whose deletion is due at the given time and revokes
+// its sessions. A failure for one account doesn't stop the others from being deleted.
+func (app *Application) deleteDueAccounts(ctx context.Context, now time.Time) error {
+	ids, err := app.Models.Users.GetAllDueForDeletion(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := app.Models.Users.Anonymize(ctx, id, now)
+		if err != nil {
+			// The deletion was cancelled since it was picked up.
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.Logger.PrintError(err, map[string]string{"user_id": id})
+			}
+			continue
+		}
+
+		err = app.Models.Sessions.DeleteAllForUser(ctx, id)
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{"user_id": id})
+		}
+
+		err = app.Models.Events.Insert(ctx, &data.Event{
+			UserID:    id,
+			Type:      data.EventAccountDeleted,
+			CreatedAt: now,
+		})
+		if err != nil {
+			app.Logger.PrintError(err, map[string]string{"user_id": id})
+		}
+
+		app.Logger.PrintInfo("account deleted", map[string]string{"user_id": id})
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+)
+
+func TestExportUserHandler(t *testing.T) {
+	app := newTestApplication(t)
+	user := &data.User{ID: "testID", Name: "Test User", Email: "test@example.com", Points: 10}
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/user/me/export", nil)
+	r = app.contextSetUser(r, user)
+	rr := httptest.NewRecorder()
+	app.exportUserHandler(rr, r)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment;") {
+		t.Errorf("got Content-Disposition %q; want an attachment", got)
+	}
+
+	var body struct {
+		Profile struct {
+			Email string `json:"email"`
+		} `json:"profile"`
+		Points       int          `json:"points"`
+		PointHistory []data.Event `json:"point_history"`
+		Events       []data.Event `json:"events"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Profile.Email != user.Email || body.Points != user.Points {
+		t.Errorf("got export %s", rr.Body)
+	}
+	if len(body.PointHistory) != 1 || body.PointHistory[0].Type != data.EventPointsEarned {
+		t.Errorf("got point history %v; want the points earned", body.PointHistory)
+	}
+	if len(body.Events) != 1 || body.Events[0].Type != data.EventAccountLocked {
+		t.Errorf("got events %v; want only the security events", body.Events)
+	}
+}
+
+func TestAccountDeletionHandlers(t *testing.T) {
+	app := newTestApplication(t)
+	app.Config.Deletion.CoolingOff = 30 * 24 * time.Hour
+
+	scheduled := &data.User{ID: "testID", DeletionScheduledAt: time.Now().Add(time.Hour)}
+	active := &data.User{ID: "testID"}
+
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		user     *data.User
+		wantCode int
+	}{
+		{"Delete", app.deleteUserHandler, active, http.StatusAccepted},
+		{"Delete already scheduled", app.deleteUserHandler, scheduled, http.StatusConflict},
+		{"Cancel", app.cancelDeletionHandler, scheduled, http.StatusOK},
+		{"Cancel not scheduled", app.cancelDeletionHandler, active, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/v1/user/me", nil)
+			r = app.contextSetUser(r, tt.user)
+			rr := httptest.NewRecorder()
+			tt.handler(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("got status %d; want %d: %s", rr.Code, tt.wantCode, rr.Body)
+			}
+		})
+	}
+}
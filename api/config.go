@@ -1,60 +1,325 @@
-package api
-
-import (
-	"context"
-	"time"
-
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-)
-
-// Define a config struct.
-type Config struct {
-	Port int
-	Env  string
-	// Add a new jwt struct containing a single string field for the JWT signing secret.
-	Jwt struct {
-		Secret string
-	}
-	// db struct field holds the configuration settings for our database connection pool.
-	Db struct {
-		MaxOpenConns     int
-		MaxIdleTime      string
-		ConnectionString string
-		DatabaseName     string
-	}
-	Cors struct {
-		TrustedOrigins []string
-	}
-}
-
-func OpenDB(cfg Config) (*mongo.Database, error) {
-	// Set client options
-	clientOptions := options.Client().ApplyURI(cfg.Db.ConnectionString)
-	clientOptions.SetMaxPoolSize(uint64(cfg.Db.MaxOpenConns)) // Set the maximum connection pool size
-
-	maxConnectionIdleTime, err := time.ParseDuration(cfg.Db.MaxIdleTime)
-	if err != nil {
-		return nil, err
-	}
-	clientOptions.SetMaxConnIdleTime(maxConnectionIdleTime) // Set the maximum connection idle time
-
-	// Create a context with a 5-second timeout deadline.
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// Connect to the MongoDB server with context
-	client, err := mongo.Connect(ctx, clientOptions)
-	if err != nil {
-		return nil, err
-	}
-
-	// Call Ping to check the connection
-	err = client.Ping(ctx, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Return a handle to the specified database
-	return client.Database(cfg.Db.DatabaseName), nil
-}
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
+	"github.com/toduluz/savingsquadsbackend/internal/jwks"
+	"github.com/toduluz/savingsquadsbackend/internal/oidc"
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Define a config struct.
+type Config struct {
+	Port int
+	Env  string
+	// Build describes the binary, as reported by the health check endpoints. Version is set at
+	// build time with -ldflags "-X main.version=...", and Commit and Time come from the version
+	// control information which Go embeds in the binary.
+	Build struct {
+		Version string
+		Commit  string
+		Time    string
+	}
+	// Log holds the logging settings. Level can also be changed while the server is running,
+	// through the admin API. When SampleFirst is positive, only the first SampleFirst entries with
+	// the same message are written each second, and one in every SampleThereafter after that.
+	Log struct {
+		Level            jsonlog.Level
+		SampleFirst      int
+		SampleThereafter int
+	}
+	// Storage is the storage backend, either "mongo", "postgres" or "memory". The memory backend
+	// keeps all data in the process and loses it on restart, so it is only meant for development
+	// and tests.
+	Storage string
+	// Jwt holds the JWT settings. Tokens are signed with the Ed25519 or RSA key with ID
+	// SigningKeyID (the first private key if empty) from the PEM files in KeyFiles, and verified
+	// with any of them.
+	Jwt struct {
+		KeyFiles     []string
+		SigningKeyID string
+		Issuer       string
+		Audience     string
+	}
+	// Cookie holds the AES keys which cookies are encrypted with, newest first. Cookies are
+	// encrypted with the first key and decrypted with any of them, so a key can be rotated by
+	// adding a new key in front and removing the old one once its cookies have expired.
+	Cookie struct {
+		Keys [][]byte `secret:"true"`
+	}
+	// db struct field holds the configuration settings for our database connection pool.
+	Db struct {
+		MaxOpenConns     int
+		MaxIdleTime      string
+		ConnectionString string `secret:"true"`
+		DatabaseName     string
+		QueryTimeout     time.Duration
+		// Migrate applies the database migrations at startup. Only one instance migrates at a
+		// time, and the others wait up to MigrateTimeout for it to finish.
+		Migrate        bool
+		MigrateTimeout time.Duration
+	}
+	// Postgres holds the PostgreSQL connection settings, used when Storage is "postgres". The
+	// connection pool settings in Db apply to it as well.
+	Postgres struct {
+		DSN string `secret:"true"`
+	}
+	// Shutdown holds the graceful shutdown settings. On SIGINT or SIGTERM the readiness check
+	// fails straight away, and the server keeps serving for DrainDelay so that load balancers
+	// stop sending it requests before it stops accepting connections. It then waits up to
+	// Timeout for the requests in flight and the background work to finish.
+	Shutdown struct {
+		DrainDelay time.Duration
+		Timeout    time.Duration
+	}
+	// Tracing holds the OpenTelemetry settings. Exporter is "none", "stdout" or "otlp", in which
+	// case spans are sent over HTTP to Endpoint, or to the endpoint set by the standard
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable if Endpoint is empty. SampleRatio is the
+	// share of new traces which are recorded; traces started by a caller follow its decision.
+	Tracing struct {
+		Exporter    string
+		Endpoint    string
+		SampleRatio float64
+	}
+	// Metrics holds the port of the admin server, which serves the metrics on "/metrics" apart
+	// from the API so that they aren't exposed to its clients. A Port of zero disables it.
+	Metrics struct {
+		Port int
+	}
+	// TLS holds the HTTPS settings. The server serves HTTPS, with HTTP/2, when CertFile and
+	// KeyFile are set, and reloads them when they change. SelfSigned serves HTTPS with a
+	// generated certificate instead, which is only allowed in development. If RedirectPort is set,
+	// plain HTTP requests to it are redirected to HTTPS.
+	TLS struct {
+		CertFile     string
+		KeyFile      string
+		SelfSigned   bool
+		RedirectPort int
+	}
+	Cors struct {
+		TrustedOrigins []string
+	}
+	// Lockout holds the brute-force protection settings for login. After MaxAttempts consecutive
+	// failures the account is locked for BaseDuration, doubling with every further failure up to
+	// MaxDuration. A MaxAttempts of zero disables lockout.
+	Lockout struct {
+		MaxAttempts  int
+		BaseDuration time.Duration
+		MaxDuration  time.Duration
+	}
+	// Mfa holds the TOTP two-factor authentication settings. Issuer is the name shown for the
+	// account in authenticator apps.
+	Mfa struct {
+		Issuer string
+	}
+	// Deletion holds the account deletion settings. Accounts are anonymized CoolingOff after the
+	// user asks for deletion, by a job which runs every Interval.
+	Deletion struct {
+		CoolingOff time.Duration
+		Interval   time.Duration
+	}
+	// Oidc holds the OpenID Connect providers, such as Google or Apple, which users can sign in
+	// with. Each provider's redirect URL must point at "/v1/user/oidc/{name}/callback".
+	Oidc struct {
+		Providers []oidc.Config
+	}
+}
+
+// ValidateConfig checks the configuration before the server starts. The errors are keyed by the
+// name of the flag which sets the invalid value. Outside of development, the settings which have
+// throwaway fallbacks for local runs, such as the keys, are required.
+func ValidateConfig(v *validator.Validator, cfg Config) {
+	v.Check(cfg.Port > 0 && cfg.Port <= 65535, "port", "must be between 1 and 65535")
+	v.Check(validator.In(cfg.Env, "development", "staging", "production"), "env", "must be development, staging or production")
+	v.Check(cfg.Metrics.Port >= 0 && cfg.Metrics.Port <= 65535, "metrics-port", "must be between 0 and 65535")
+	v.Check(cfg.Metrics.Port != cfg.Port, "metrics-port", "must be different from the API server port")
+	v.Check(cfg.TLS.RedirectPort >= 0 && cfg.TLS.RedirectPort <= 65535, "tls-redirect-port", "must be between 0 and 65535")
+	if cfg.TLS.RedirectPort != 0 {
+		v.Check(cfg.TLS.RedirectPort != cfg.Port && cfg.TLS.RedirectPort != cfg.Metrics.Port, "tls-redirect-port", "must be different from the API server and metrics ports")
+		v.Check(cfg.TLS.CertFile != "" || cfg.TLS.SelfSigned, "tls-redirect-port", "must only be set when TLS is enabled")
+	}
+	v.Check((cfg.TLS.CertFile == "") == (cfg.TLS.KeyFile == ""), "tls-key-file", "must be provided together with the certificate file")
+	for name, file := range map[string]string{"tls-cert-file": cfg.TLS.CertFile, "tls-key-file": cfg.TLS.KeyFile} {
+		if file != "" {
+			_, err := os.Stat(file)
+			v.Check(err == nil, name, fmt.Sprintf("must exist, but %s can't be read", file))
+		}
+	}
+	v.Check(!cfg.TLS.SelfSigned || cfg.TLS.CertFile == "", "tls-self-signed", "must not be set together with a certificate file")
+	v.Check(cfg.Log.Level != jsonlog.LevelFatal, "log-level", "must be debug, info, warn, error or off")
+	v.Check(cfg.Log.SampleFirst >= 0, "log-sample-first", "must not be negative")
+	v.Check(cfg.Log.SampleThereafter >= 0, "log-sample-thereafter", "must not be negative")
+	v.Check(cfg.Shutdown.DrainDelay >= 0, "shutdown-drain-delay", "must not be negative")
+	v.Check(cfg.Shutdown.Timeout > 0, "shutdown-timeout", "must be greater than zero")
+
+	v.Check(validator.In(cfg.Tracing.Exporter, "none", "stdout", "otlp"), "otel-exporter", "must be none, stdout or otlp")
+	v.Check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1, "otel-sample-ratio", "must be between 0 and 1")
+	if cfg.Tracing.Endpoint != "" {
+		u, err := url.Parse(cfg.Tracing.Endpoint)
+		v.Check(err == nil && u.Scheme != "" && u.Host != "", "otel-endpoint", "must be an absolute URL")
+	}
+
+	v.Check(validator.In(cfg.Storage, "mongo", "postgres", "memory"), "storage", "must be mongo, postgres or memory")
+	switch cfg.Storage {
+	case "mongo":
+		v.Check(cfg.Db.ConnectionString != "", "db-connection-string", "must be provided")
+		v.Check(cfg.Db.DatabaseName != "", "db-database-name", "must be provided")
+	case "postgres":
+		v.Check(cfg.Postgres.DSN != "", "postgres-dsn", "must be provided")
+	}
+	v.Check(cfg.Db.MaxOpenConns > 0, "db-max-open-conns", "must be greater than zero")
+	maxIdleTime, err := time.ParseDuration(cfg.Db.MaxIdleTime)
+	v.Check(err == nil && maxIdleTime > 0, "db-max-idle-time", "must be a positive duration, such as 15m")
+	v.Check(cfg.Db.QueryTimeout > 0, "db-query-timeout", "must be greater than zero")
+	v.Check(cfg.Db.MigrateTimeout > 0, "db-migrate-timeout", "must be greater than zero")
+
+	// The cookie keys are AES-256 keys, so anything but 32 bytes is a mistake, such as a key
+	// which was truncated when it was copied.
+	for _, key := range cfg.Cookie.Keys {
+		v.Check(len(key) == 32, "cookie-keys", "must be 32-byte keys")
+	}
+	// Load the signing keys the way the server does, which fails for unreadable files, RSA keys
+	// with a modulus of less than jwks.MinRSABits, malformed Ed25519 keys and an unknown signing
+	// key ID.
+	if len(cfg.Jwt.KeyFiles) > 0 {
+		_, err := jwks.Load(cfg.Jwt.KeyFiles, cfg.Jwt.SigningKeyID)
+		if err != nil {
+			v.AddError("jwt-key-files", fmt.Sprintf("must hold valid signing keys: %v", err))
+		}
+	}
+	v.Check(cfg.Jwt.Issuer != "", "jwt-issuer", "must be provided")
+	v.Check(cfg.Jwt.Audience != "", "jwt-audience", "must be provided")
+
+	v.Check(cfg.Lockout.MaxAttempts >= 0, "lockout-max-attempts", "must not be negative")
+	v.Check(cfg.Lockout.BaseDuration > 0, "lockout-base-duration", "must be greater than zero")
+	v.Check(cfg.Lockout.MaxDuration >= cfg.Lockout.BaseDuration, "lockout-max-duration", "must not be less than the base duration")
+	v.Check(cfg.Deletion.CoolingOff >= 0, "deletion-cooling-off", "must not be negative")
+	v.Check(cfg.Deletion.Interval > 0, "deletion-interval", "must be greater than zero")
+
+	names := make([]string, 0, len(cfg.Oidc.Providers))
+	for _, provider := range cfg.Oidc.Providers {
+		names = append(names, provider.Name)
+	}
+	v.Check(validator.Unique(names), "oidc-provider", "must have unique names")
+
+	if cfg.Env != "development" {
+		v.Check(len(cfg.Cookie.Keys) > 0, "cookie-keys", "must be provided outside of development")
+		v.Check(len(cfg.Jwt.KeyFiles) > 0, "jwt-key-files", "must be provided outside of development")
+		v.Check(cfg.Storage != "memory", "storage", "must not be memory outside of development")
+		v.Check(!cfg.TLS.SelfSigned, "tls-self-signed", "must not be set outside of development")
+	}
+	if cfg.Env == "production" {
+		for _, origin := range cfg.Cors.TrustedOrigins {
+			v.Check(strings.HasPrefix(origin, "https://"), "cors-trusted-origins", "must be https origins in production")
+		}
+		for _, provider := range cfg.Oidc.Providers {
+			v.Check(strings.HasPrefix(provider.RedirectURL, "https://"), "oidc-provider", "must have https redirect URLs in production")
+		}
+	}
+}
+
+// OpenDB connects to MongoDB. The monitors are notified of every command, which is how command
+// durations are recorded in the metrics and commands are traced.
+func OpenDB(cfg Config, monitors ...*event.CommandMonitor) (*mongo.Database, error) {
+	// Set client options
+	clientOptions := options.Client().ApplyURI(cfg.Db.ConnectionString)
+	if len(monitors) > 0 {
+		clientOptions.SetMonitor(combineMonitors(monitors))
+	}
+	clientOptions.SetMaxPoolSize(uint64(cfg.Db.MaxOpenConns)) // Set the maximum connection pool size
+
+	maxConnectionIdleTime, err := time.ParseDuration(cfg.Db.MaxIdleTime)
+	if err != nil {
+		return nil, err
+	}
+	clientOptions.SetMaxConnIdleTime(maxConnectionIdleTime) // Set the maximum connection idle time
+
+	// Create a context with a 5-second timeout deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Connect to the MongoDB server with context
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call Ping to check the connection
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Return a handle to the specified database
+	return client.Database(cfg.Db.DatabaseName), nil
+}
+
+// OpenPostgres opens a PostgreSQL connection pool with the pool settings of cfg.Db and checks
+// that the database can be reached.
+func OpenPostgres(cfg Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.Postgres.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	maxConnectionIdleTime, err := time.ParseDuration(cfg.Db.MaxIdleTime)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.Db.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Db.MaxOpenConns)
+	db.SetConnMaxIdleTime(maxConnectionIdleTime)
+
+	// Create a context with a 5-second timeout deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// combineMonitors returns a command monitor which notifies each of the monitors in turn, since a
+// client only takes one. Nil monitors are skipped.
+func combineMonitors(monitors []*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, monitor := range monitors {
+				if monitor != nil && monitor.Started != nil {
+					monitor.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, monitor := range monitors {
+				if monitor != nil && monitor.Succeeded != nil {
+					monitor.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, monitor := range monitors {
+				if monitor != nil && monitor.Failed != nil {
+					monitor.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/internal/oidc"
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
+)
+
+// validConfig returns a configuration which passes validation in development.
+func validConfig() Config {
+	var cfg Config
+	cfg.Port = 4000
+	cfg.Env = "development"
+	cfg.Metrics.Port = 9090
+	cfg.Shutdown.Timeout = 20 * time.Second
+	cfg.Tracing.Exporter = "none"
+	cfg.Tracing.SampleRatio = 1
+	cfg.Storage = "memory"
+	cfg.Db.MaxOpenConns = 100
+	cfg.Db.MaxIdleTime = "15m"
+	cfg.Db.QueryTimeout = 5 * time.Second
+	cfg.Db.MigrateTimeout = time.Minute
+	cfg.Jwt.Issuer = "savingsquads"
+	cfg.Jwt.Audience = "savingsquads"
+	cfg.Lockout.BaseDuration = time.Minute
+	cfg.Lockout.MaxDuration = time.Hour
+	cfg.Deletion.Interval = time.Hour
+	return cfg
+}
+
+func TestValidateConfig(t *testing.T) {
+	t.Parallel()
+
+	// A 1024-bit RSA key is too weak to sign tokens with.
+	weakKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weakKeyFile := filepath.Join(t.TempDir(), "weak.pem")
+	err = os.WriteFile(weakKeyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weakKey)}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr []string
+	}{
+		{name: "valid", modify: func(cfg *Config) {}},
+		{name: "port out of range", modify: func(cfg *Config) { cfg.Port = 70000 }, wantErr: []string{"port"}},
+		{name: "same metrics port", modify: func(cfg *Config) { cfg.Metrics.Port = 4000 }, wantErr: []string{"metrics-port"}},
+		{name: "unknown env", modify: func(cfg *Config) { cfg.Env = "prod" }, wantErr: []string{"env", "cookie-keys", "jwt-key-files", "storage"}},
+		{name: "invalid idle time", modify: func(cfg *Config) { cfg.Db.MaxIdleTime = "15" }, wantErr: []string{"db-max-idle-time"}},
+		{name: "mongo without connection string", modify: func(cfg *Config) { cfg.Storage = "mongo"; cfg.Db.DatabaseName = "testDB" }, wantErr: []string{"db-connection-string"}},
+		{name: "short cookie key", modify: func(cfg *Config) { cfg.Cookie.Keys = [][]byte{[]byte("short")} }, wantErr: []string{"cookie-keys"}},
+		{name: "missing key file", modify: func(cfg *Config) { cfg.Jwt.KeyFiles = []string{"testdata/missing.pem"} }, wantErr: []string{"jwt-key-files"}},
+		{name: "weak RSA key", modify: func(cfg *Config) { cfg.Jwt.KeyFiles = []string{weakKeyFile} }, wantErr: []string{"jwt-key-files"}},
+		{name: "key file without certificate", modify: func(cfg *Config) { cfg.TLS.KeyFile = "testdata/missing.pem" }, wantErr: []string{"tls-key-file"}},
+		{name: "redirect without TLS", modify: func(cfg *Config) { cfg.TLS.RedirectPort = 8080 }, wantErr: []string{"tls-redirect-port"}},
+		{name: "self-signed", modify: func(cfg *Config) { cfg.TLS.SelfSigned = true; cfg.TLS.RedirectPort = 8080 }},
+		{name: "sample ratio", modify: func(cfg *Config) { cfg.Tracing.SampleRatio = 2 }, wantErr: []string{"otel-sample-ratio"}},
+		{
+			name: "duplicate providers",
+			modify: func(cfg *Config) {
+				cfg.Oidc.Providers = []oidc.Config{{Name: "google"}, {Name: "google"}}
+			},
+			wantErr: []string{"oidc-provider"},
+		},
+		{
+			name: "production",
+			modify: func(cfg *Config) {
+				cfg.Env = "production"
+				cfg.TLS.SelfSigned = true
+				cfg.Cors.TrustedOrigins = []string{"http://example.com"}
+			},
+			wantErr: []string{"cookie-keys", "jwt-key-files", "storage", "tls-self-signed", "cors-trusted-origins"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(&cfg)
+
+			v := validator.New()
+			ValidateConfig(v, cfg)
+
+			if len(v.Errors) != len(tt.wantErr) {
+				t.Errorf("got errors %v, want errors for %v", v.Errors, tt.wantErr)
+			}
+			for _, key := range tt.wantErr {
+				if _, ok := v.Errors[key]; !ok {
+					t.Errorf("missing error for %s in %v", key, v.Errors)
+				}
+			}
+		})
+	}
+}
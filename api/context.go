@@ -13,9 +13,49 @@ type contextKey string
 // context.
 const userContextKey = contextKey("user")
 
+// apiKeyContextKey is used as a key for getting and setting the merchant API key which
+// authenticated the request.
+const apiKeyContextKey = contextKey("apiKey")
+
+// sessionContextKey is used as a key for getting and setting the session which the session JWT
+// of the request belongs to.
+const sessionContextKey = contextKey("session")
+
+// requestInfoContextKey is used as a key for getting and setting the requestInfo of the request.
+const requestInfoContextKey = contextKey("requestInfo")
+
+// requestInfo identifies the request in the logs. It is added to the context by logRequest, and
+// as a pointer so that the user which authenticate finds deeper in the chain ends up in the
+// access log too.
+type requestInfo struct {
+	id     string
+	userID string
+}
+
+// contextSetRequestInfo returns a new copy of the request with the provided requestInfo added to
+// the context.
+func (app *Application) contextSetRequestInfo(r *http.Request, info *requestInfo) *http.Request {
+	ctx := context.WithValue(r.Context(), requestInfoContextKey, info)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID retrieves the ID of the request from the request context. It returns the
+// empty string if the request didn't go through logRequest.
+func (app *Application) contextGetRequestID(r *http.Request) string {
+	info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo)
+	if !ok {
+		return ""
+	}
+	return info.id
+}
+
 // contextSetUser returns a new copy of the request with the provided User struct added to the
-// context.
+// context. The user's ID is also recorded for the access log.
 func (app *Application) contextSetUser(r *http.Request, user *data.User) *http.Request {
+	if info, ok := r.Context().Value(requestInfoContextKey).(*requestInfo); ok && !user.IsAnonymous() {
+		info.userID = user.ID
+	}
+
 	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
@@ -31,3 +71,31 @@ func (app *Application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+// contextSetAPIKey returns a new copy of the request with the provided merchant APIKey struct
+// added to the context.
+func (app *Application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey retrieves the merchant APIKey struct from the request context. Unlike
+// contextGetUser, it returns nil if the request wasn't authenticated with an API key.
+func (app *Application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+// contextSetSession returns a new copy of the request with the provided Session struct added to
+// the context.
+func (app *Application) contextSetSession(r *http.Request, session *data.Session) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionContextKey, session)
+	return r.WithContext(ctx)
+}
+
+// contextGetSession retrieves the Session struct from the request context. It returns nil if the
+// request wasn't authenticated with a session JWT.
+func (app *Application) contextGetSession(r *http.Request) *data.Session {
+	session, _ := r.Context().Value(sessionContextKey).(*data.Session)
+	return session
+}
@@ -10,26 +10,43 @@ func (app *Application) setCookie(w http.ResponseWriter, name, value string, max
 	cookie := http.Cookie{
 		Name:     name,
 		Value:    value,
-		Path:     "/v1/users",
+		Path:     "/v1",
 		MaxAge:   maxAge,
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteLaxMode,
 	}
 
-	// Use the WriteSigned() function, passing in the secret key as the final
-	// argument.
-	err := cookies.WriteSigned(w, cookie, []byte(app.Config.Jwt.Secret))
+	// Use the WriteEncrypted() function, passing in the cookie keys as the final argument,
+	// so that the client can neither read nor modify the cookie contents.
+	err := cookies.WriteEncrypted(w, cookie, app.Config.Cookie.Keys)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// setOIDCStateCookie sets the encrypted cookie which holds the state of an OpenID Connect login.
+// It is scoped to the OIDC routes so that it is only sent back to the callback.
+func (app *Application) setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) error {
+	cookie := http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/v1/user/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		// The callback is a top-level redirect from the provider, which Lax cookies are sent
+		// with.
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	return cookies.WriteEncrypted(w, cookie, app.Config.Cookie.Keys)
+}
+
 func (app *Application) getCookie(r *http.Request, value string) (string, error) {
-	// Use the ReadSigned() function, passing in the secret key as the final
-	// argument.
-	value, err := cookies.ReadSigned(r, value, []byte(app.Config.Jwt.Secret))
+	// Use the ReadEncrypted() function, passing in the cookie keys as the final argument.
+	value, err := cookies.ReadEncrypted(r, value, app.Config.Cookie.Keys)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+)
+
+// csrfCookie is the name of the cookie which holds the CSRF token. It is encrypted and HttpOnly,
+// so another site can neither read it nor plant a token of its own, and the client has to get the
+// token from csrfTokenHandler to send it back in the csrfHeader.
+const (
+	csrfCookie = "csrf"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrfTokenHandler handles the "GET /v1/user/csrf" endpoint. It returns the CSRF token which
+// cookie-authenticated clients must send in the "X-CSRF-Token" header of state-changing requests,
+// issuing a new one if the client doesn't have one yet.
+func (app *Application) csrfTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := app.getCookie(r, csrfCookie)
+	if err != nil || token == "" {
+		b := make([]byte, 32)
+		_, err = rand.Read(b)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		token = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	// (Re)set the cookie so that it lives as long as a session started now.
+	err = app.setCookie(w, csrfCookie, token, int(sessionDuration.Seconds()))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"csrf_token": token}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// requireCSRFToken is middleware which protects state-changing requests authenticated by the
+// session cookie against cross-site request forgery. The request must come from our own or a
+// trusted origin, and carry the token from the "csrf" cookie in the "X-CSRF-Token" header.
+// Requests with an Authorization header are skipped, since authenticate uses the header instead
+// of the cookie and browsers never add it on their own.
+func (app *Application) requireCSRFToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !app.isTrustedOrigin(r) {
+			app.untrustedOriginResponse(w, r)
+			return
+		}
+
+		token, err := app.getCookie(r, csrfCookie)
+		if err != nil || token == "" {
+			app.invalidCSRFTokenResponse(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(token)) != 1 {
+			app.invalidCSRFTokenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isTrustedOrigin reports whether the request comes from the API's own origin or one of
+// Cors.TrustedOrigins, going by the Origin header or, failing that, the Referer header. Requests
+// with neither header are allowed through to the token check, since some browsers and proxies
+// strip them.
+func (app *Application) isTrustedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer, err := url.Parse(r.Header.Get("Referer"))
+		if err != nil {
+			return false
+		}
+		if referer.Host == "" {
+			return true
+		}
+		origin = referer.Scheme + "://" + referer.Host
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if u.Host == r.Host {
+		return true
+	}
+
+	for i := range app.Config.Cors.TrustedOrigins {
+		if origin == app.Config.Cors.TrustedOrigins[i] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireCSRFToken(t *testing.T) {
+	app := newTestApplication(t)
+	app.Config.Cors.TrustedOrigins = []string{"https://app.example.com"}
+
+	// Get a CSRF token and its cookie from the issuance endpoint.
+	rr := httptest.NewRecorder()
+	app.csrfTokenHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/user/csrf", nil))
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookie {
+		t.Fatalf("got cookies %v; want the %s cookie", cookies, csrfCookie)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	token, err := app.getCookie(r, csrfCookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		headers  map[string]string
+		cookie   bool
+		wantCode int
+	}{
+		{"Safe method", http.MethodGet, nil, false, http.StatusOK},
+		{"Bearer token", http.MethodPost, map[string]string{"Authorization": "Bearer abc"}, false, http.StatusOK},
+		{"Valid token", http.MethodPost, map[string]string{csrfHeader: token}, true, http.StatusOK},
+		{"Missing cookie", http.MethodPost, map[string]string{csrfHeader: token}, false, http.StatusForbidden},
+		{"Missing header", http.MethodPut, nil, true, http.StatusForbidden},
+		{"Wrong token", http.MethodDelete, map[string]string{csrfHeader: "forged"}, true, http.StatusForbidden},
+		{"Trusted origin", http.MethodPost, map[string]string{csrfHeader: token, "Origin": "https://app.example.com"}, true, http.StatusOK},
+		{"Same origin", http.MethodPost, map[string]string{csrfHeader: token, "Origin": "http://example.com"}, true, http.StatusOK},
+		{"Untrusted origin", http.MethodPost, map[string]string{csrfHeader: token, "Origin": "https://evil.example.com"}, true, http.StatusForbidden},
+		{"Untrusted referer", http.MethodPost, map[string]string{csrfHeader: token, "Referer": "https://evil.example.com/page"}, true, http.StatusForbidden},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/v1/user/point", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if tt.cookie {
+				r.AddCookie(cookies[0])
+			}
+
+			rr := httptest.NewRecorder()
+			app.requireCSRFToken(next).ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("got status %d; want %d: %s", rr.Code, tt.wantCode, rr.Body)
+			}
+		})
+	}
+}
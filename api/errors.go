@@ -2,16 +2,28 @@ package api
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // logError method is a generic helper for logging an error message in *Application, as well
-// as the requested method and request URL.
+// as the requested method and request URL, and the request and trace IDs which tie it to the
+// access log and the trace of the request.
 func (app *Application) logError(r *http.Request, err error) {
-	app.Logger.PrintError(err, map[string]string{
+	properties := map[string]string{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
-	})
+	}
+	if id := app.contextGetRequestID(r); id != "" {
+		properties["request_id"] = id
+	}
+	if id := traceID(r); id != "" {
+		properties["trace_id"] = id
+	}
+
+	app.Logger.PrintError(err, properties)
 }
 
 // errorResponse method is a generic helper for sending JSON-formatted error messages to the
@@ -90,18 +102,24 @@ func (app *Application) invalidCredentialsResponse(w http.ResponseWriter, r *htt
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+// wwwAuthenticate is the authentication challenge sent in the "WWW-Authenticate" header of 401
+// Unauthorized responses for requests to authenticated resources.
+const wwwAuthenticate = `Bearer realm="savingsquads"`
+
 // invalidAuthenticationTokenResponse sends a JSON-formatted error with a 401 Unauthorized status
-// code and "WWW-Authenticate: Bearer" header to the client.
+// code and a "WWW-Authenticate: Bearer" header with an invalid_token error to the client.
 func (app *Application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("WWWW-Authenticate", "Bearer")
+	w.Header().Set("WWW-Authenticate", wwwAuthenticate+`, error="invalid_token"`)
 
 	message := "invalid or missing authentication token"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
 // authenticationRequiredResponse sends a JSON-formatted error with a 401 Unauthorized status code
-// to the client.
+// and "WWW-Authenticate: Bearer" header to the client.
 func (app *Application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", wwwAuthenticate)
+
 	message := "you must be authenticated to access this resource"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
@@ -113,6 +131,19 @@ func (app *Application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
 
+// accountLockedResponse sends a JSON-formatted error with a 429 Too Many Requests status code and
+// a "Retry-After" header telling the client when the account will be unlocked.
+func (app *Application) accountLockedResponse(w http.ResponseWriter, r *http.Request, until time.Time) {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	message := "your account has been temporarily locked due to too many failed login attempts"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 func (app *Application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
@@ -137,3 +168,41 @@ func (app *Application) voucherAlreadyRedeemedResponse(w http.ResponseWriter, r
 	message := "the requested voucher has already been redeemed"
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
+
+func (app *Application) mfaAlreadyEnabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "two-factor authentication is already enabled for this account"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *Application) mfaNotEnabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "two-factor authentication is not enabled for this account"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// missingScopeResponse sends a JSON-formatted error with a 403 Forbidden status code to a merchant
+// whose API key hasn't been granted the scope required by the endpoint.
+func (app *Application) missingScopeResponse(w http.ResponseWriter, r *http.Request, scope string) {
+	message := fmt.Sprintf("your API key must have the %q scope to access this resource", scope)
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// invalidCSRFTokenResponse sends a JSON-formatted error with a 403 Forbidden status code when a
+// cookie-authenticated request doesn't carry the CSRF token from the "csrf" cookie.
+func (app *Application) invalidCSRFTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or missing CSRF token"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// untrustedOriginResponse sends a JSON-formatted error with a 403 Forbidden status code when a
+// cookie-authenticated request comes from an origin which isn't trusted.
+func (app *Application) untrustedOriginResponse(w http.ResponseWriter, r *http.Request) {
+	message := "requests from this origin are not allowed"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+// deletionAlreadyScheduledResponse sends a JSON-formatted error with a 409 Conflict status code
+// when the user asks to delete an account which is already scheduled for deletion.
+func (app *Application) deletionAlreadyScheduledResponse(w http.ResponseWriter, r *http.Request, at time.Time) {
+	message := fmt.Sprintf("your account is already scheduled for deletion at %s", at.Format(time.RFC3339))
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
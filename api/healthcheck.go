@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// healthCheckTimeout bounds the time the readiness checks may take together, so that a hanging
+// dependency fails the check rather than the orchestrator's request.
+const healthCheckTimeout = 2 * time.Second
+
+// systemInfo returns the environment and build information reported by the health checks.
+func (app *Application) systemInfo() map[string]string {
+	return map[string]string{
+		"environment": app.Config.Env,
+		"version":     app.Config.Build.Version,
+		"commit":      app.Config.Build.Commit,
+		"build_time":  app.Config.Build.Time,
+	}
+}
+
+// livenessHandler handles the "GET /healthz" endpoint. It only reports that the process is able
+// to serve requests, so that a failing database doesn't get the server restarted.
+func (app *Application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"status": "alive"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readinessHandler handles the "GET /readyz" endpoint. It responds with 503 Service Unavailable
+// if any of the health checks fail or the server is shutting down, so that load balancers stop
+// sending it requests.
+func (app *Application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	ready, checks := app.runHealthChecks(r)
+
+	status := http.StatusOK
+	env := envelope{"status": "ready", "checks": checks, "system_info": app.systemInfo()}
+	if !ready {
+		status = http.StatusServiceUnavailable
+		env["status"] = "unavailable"
+	}
+
+	// Orchestrators poll this endpoint, so never let a cached response hide a change.
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "no-store")
+
+	err := app.writeJSON(w, status, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// healthcheckHandler handles the "GET /v1/healthcheck" endpoint, which reports the same status
+// as the readiness check for clients of the API.
+func (app *Application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+	app.readinessHandler(w, r)
+}
+
+// runHealthChecks runs every health check concurrently and reports whether the server is ready,
+// along with the result of each check. The result is only "ok" or "failed", since the checks are
+// public and their errors may describe the infrastructure; the errors are logged instead.
+func (app *Application) runHealthChecks(r *http.Request) (bool, map[string]string) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(app.HealthChecks))
+	for name, check := range app.HealthChecks {
+		go func(name string, check func(context.Context) error) {
+			results <- result{name, check(ctx)}
+		}(name, check)
+	}
+
+	ready := true
+	checks := make(map[string]string, len(app.HealthChecks)+1)
+	for range app.HealthChecks {
+		res := <-results
+		if res.err != nil {
+			ready = false
+			checks[res.name] = "failed"
+			app.logError(r, fmt.Errorf("health check %s: %w", res.name, res.err))
+			continue
+		}
+		checks[res.name] = "ok"
+	}
+
+	if app.shuttingDown.Load() {
+		ready = false
+		checks["shutdown"] = "shutting down"
+	}
+
+	return ready, checks
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
+)
+
+func TestHealthChecks(t *testing.T) {
+	app := newTestApplication(t)
+	var logs bytes.Buffer
+	app.Logger = jsonlog.NewLogger(&logs, jsonlog.LevelInfo)
+	app.Config.Env = "testing"
+	app.Config.Build.Version = "1.2.3"
+
+	var dbErr error
+	app.HealthChecks = map[string]func(context.Context) error{
+		"database": func(context.Context) error { return dbErr },
+	}
+
+	readiness := func() (int, map[string]any) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		app.readinessHandler(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var body map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Code, body
+	}
+
+	code, body := readiness()
+	if code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", code, http.StatusOK)
+	}
+	if info := body["system_info"].(map[string]any); info["environment"] != "testing" || info["version"] != "1.2.3" {
+		t.Errorf("got system info %v", info)
+	}
+
+	dbErr = errors.New("connection refused")
+	code, body = readiness()
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d with a failing check; want %d", code, http.StatusServiceUnavailable)
+	}
+	// The error is logged rather than returned to the public.
+	if got := body["checks"].(map[string]any)["database"]; got != "failed" {
+		t.Errorf("got database check %v; want failed", got)
+	}
+	if !strings.Contains(logs.String(), "connection refused") {
+		t.Errorf("the failing check wasn't logged: %s", logs.String())
+	}
+
+	dbErr = nil
+	app.shuttingDown.Store(true)
+	if code, _ = readiness(); code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d while shutting down; want %d", code, http.StatusServiceUnavailable)
+	}
+
+	// Liveness doesn't depend on the checks or on shutting down.
+	rr := httptest.NewRecorder()
+	app.livenessHandler(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("got liveness status %d; want %d", rr.Code, http.StatusOK)
+	}
+}
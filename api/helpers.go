@@ -1,12 +1,16 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +33,11 @@ func (app *Application) readIDParam(r *http.Request) string {
 	return param
 }
 
+// readParam reads the named interpolated parameter from request URL and returns it as a string.
+func (app *Application) readParam(r *http.Request, name string) string {
+	return mux.Vars(r)[name]
+}
+
 // writeJSON marshals data structure to encoded JSON response. It returns an error if there are
 // any issues, else error is nil.
 func (app *Application) writeJSON(w http.ResponseWriter, status int, data envelope,
@@ -62,13 +71,19 @@ func (app *Application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// maxBodyBytes limits the size of request bodies.
+const maxBodyBytes = 1_048_576
+
 // readJSON decodes request Body into corresponding Go type. It triages for any potential errors
 // and returns corresponding appropriate errors.
 func (app *Application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 	// Use http.MaxBytesReader() to limit the size of the request body to 1MB to prevent
 	// any potential nefarious DoS attacks.
-	maxBytes := 1_048_576
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+
+	// Time the decoding on its own, since it includes reading the body from the client.
+	_, span := tracer.Start(r.Context(), "readJSON")
+	defer span.End()
 
 	// Initialize the json.Decoder, and call the DisallowUnknownFields() method on it
 	// before decoding. So, if the JSON from the client includes any field which
@@ -130,7 +145,7 @@ func (app *Application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 		// error "http: request body too large". There is an open issue about turning
 		// this into a distinct error type at https://github.com/golang/go/issues/30715.
 		case err.Error() == "http: request body too large":
-			return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+			return fmt.Errorf("body must not be larger than %d bytes", maxBodyBytes)
 
 		// A json.InvalidUnmarshalError error will be returned if we pass a non-nil
 		// pointer to Decode(). We catch this and panic, rather than returning an error
@@ -257,19 +272,34 @@ func (app *Application) readInt(qs url.Values, key string, defaultValue int, v *
 }
 
 // background is a helper that accepts an arbitrary function as a parameter and runs it in a
-// in goroutine in the background.
-func (app *Application) background(fn func()) {
+// in goroutine in the background. The name describes the task in the report of the tasks which
+// were still running when the server shut down.
+func (app *Application) background(name string, fn func()) {
 	// Increment the WaitGroup counter
 	app.Wg.Add(1)
+	app.tasksMu.Lock()
+	if app.tasks == nil {
+		app.tasks = make(map[string]int)
+	}
+	app.tasks[name]++
+	app.tasksMu.Unlock()
 
 	go func() {
 		// Use defer to decrement the WaitGroup counter before the goroutine returns.
 		defer app.Wg.Done()
+		defer func() {
+			app.tasksMu.Lock()
+			app.tasks[name]--
+			if app.tasks[name] == 0 {
+				delete(app.tasks, name)
+			}
+			app.tasksMu.Unlock()
+		}()
 
 		// Recover from any panic
 		defer func() {
 			if err := recover(); err != nil {
-				app.Logger.PrintError(fmt.Errorf("%s", err), nil)
+				app.Logger.PrintError(fmt.Errorf("%s", err), map[string]string{"task": name})
 			}
 		}()
 
@@ -277,3 +307,79 @@ func (app *Application) background(fn func()) {
 		fn()
 	}()
 }
+
+// clientIP returns the IP address of the client from the remote address of the connection.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// responseRecorder wraps a ResponseWriter to record the status code and the number of bytes
+// written by the handler, for the metrics and the access log.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// statusCode returns the status code of the response, which is 200 OK if the handler wrote
+// nothing at all.
+func (rec *responseRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// routeTemplate returns the template of the route which the request matched, such as
+// "/v1/voucher/{id}", or "unmatched" if it matched none.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+// requestIDPattern matches the request IDs accepted from clients and proxies. Anything else is
+// replaced, so that a client can't inject arbitrary text into the logs.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID returns the ID sent in the X-Request-ID header if it is acceptable, so that requests
+// can be followed across services, or a new random ID otherwise.
+func requestID(r *http.Request) (string, error) {
+	if id := r.Header.Get("X-Request-ID"); requestIDPattern.MatchString(id) {
+		return id, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
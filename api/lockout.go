@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+)
+
+// lockoutDuration returns how long an account should be locked after the given number of
+// consecutive failed logins, or zero if it should not be locked. The duration doubles with every
+// failure past the threshold and is capped at the configured maximum.
+func (app *Application) lockoutDuration(failures int) time.Duration {
+	cfg := app.Config.Lockout
+	if cfg.MaxAttempts <= 0 || failures < cfg.MaxAttempts {
+		return 0
+	}
+
+	d := cfg.BaseDuration
+	for i := cfg.MaxAttempts; i < failures; i++ {
+		d *= 2
+		if cfg.MaxDuration > 0 && d >= cfg.MaxDuration {
+			return cfg.MaxDuration
+		}
+	}
+	if cfg.MaxDuration > 0 && d > cfg.MaxDuration {
+		return cfg.MaxDuration
+	}
+
+	return d
+}
+
+// registerFailedLogin records a failed login for the user and locks the account once the
+// configured threshold is reached. It returns the time until which the account is locked, which
+// is the zero time if no lock was applied.
+func (app *Application) registerFailedLogin(ctx context.Context, user *data.User) (time.Time, error) {
+	failures, err := app.Models.Users.IncrementFailedLogins(ctx, user.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	d := app.lockoutDuration(failures)
+	if d == 0 {
+		return time.Time{}, nil
+	}
+
+	until := time.Now().Add(d)
+	err = app.Models.Users.Lock(ctx, user.ID, until)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// Write the security event in the background so that a slow insert doesn't hold up the
+	// response.
+	app.background("account locked event", func() {
+		err := app.Models.Events.Insert(context.Background(), &data.Event{
+			UserID:    user.ID,
+			Type:      data.EventAccountLocked,
+			CreatedAt: time.Now(),
+			Properties: map[string]string{
+				"failed_logins": strconv.Itoa(failures),
+				"locked_until":  until.UTC().Format(time.RFC3339),
+			},
+		})
+		if err != nil {
+			app.Logger.PrintError(err, nil)
+		}
+	})
+
+	return until, nil
+}
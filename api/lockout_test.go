@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApplication(t)
+	app.Config.Lockout.MaxAttempts = 3
+	app.Config.Lockout.BaseDuration = time.Minute
+	app.Config.Lockout.MaxDuration = 10 * time.Minute
+
+	tests := []struct {
+		name     string
+		failures int
+		want     time.Duration
+	}{
+		{"Below threshold", 2, 0},
+		{"At threshold", 3, time.Minute},
+		{"One past threshold", 4, 2 * time.Minute},
+		{"Two past threshold", 5, 4 * time.Minute},
+		{"Capped at maximum", 10, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := app.lockoutDuration(tt.failures); got != tt.want {
+				t.Errorf("lockoutDuration(%d) = %v; want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginLockedAccount(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApplication(t)
+
+	login := func(email string) *httptest.ResponseRecorder {
+		body := `{"email": "` + email + `", "password": "pa55word1234"}`
+		r := httptest.NewRequest(http.MethodPost, "/v1/users/login", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		app.loginUserHandler(rr, r)
+		return rr
+	}
+
+	// A locked account must be indistinguishable from an unknown email.
+	locked := login("locked@example.com")
+	unknown := login("unknown@example.com")
+	if locked.Code != http.StatusUnauthorized || locked.Code != unknown.Code {
+		t.Errorf("got status %d for a locked account and %d for an unknown email; want %d for both", locked.Code, unknown.Code, http.StatusUnauthorized)
+	}
+	if locked.Body.String() != unknown.Body.String() {
+		t.Errorf("got body %q for a locked account and %q for an unknown email", locked.Body, unknown.Body)
+	}
+	if got := locked.Header().Get("Retry-After"); got != "" {
+		t.Errorf("got Retry-After %q for a locked account; want none", got)
+	}
+}
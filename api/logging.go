@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
+)
+
+// showLogLevelHandler handles the "GET /v1/admin/log-level" endpoint, returning the minimum
+// level of the entries the server logs.
+func (app *Application) showLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"level": app.Logger.Level()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateLogLevelHandler handles the "PUT /v1/admin/log-level" endpoint, which changes the level
+// while the server is running, such as to turn on debug logging while investigating a problem.
+// The change lasts until the server restarts.
+func (app *Application) updateLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Level string `json:"level"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	level, err := jsonlog.ParseLevel(input.Level)
+	if err != nil {
+		v := validator.New()
+		v.AddError("level", "must be one of debug, info, warn, error or off")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Log the change before making it, so that it's recorded even when raising the level.
+	app.Logger.Info("changing log level",
+		jsonlog.String("from", app.Logger.Level().String()),
+		jsonlog.String("to", level.String()),
+		jsonlog.String("user_id", app.contextGetUser(r).ID),
+	)
+	app.Logger.SetLevel(level)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"level": level}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
+)
+
+func TestUpdateLogLevelHandler(t *testing.T) {
+	app := newTestApplication(t)
+	admin := &data.User{ID: "adminID", Roles: []string{data.RoleAdmin}}
+
+	tests := []struct {
+		name           string
+		body           string
+		wantStatusCode int
+		wantLevel      jsonlog.Level
+	}{
+		{"Valid level", `{"level": "debug"}`, http.StatusOK, jsonlog.LevelDebug},
+		{"Unknown level", `{"level": "verbose"}`, http.StatusUnprocessableEntity, jsonlog.LevelDebug},
+		{"Upper case level", `{"level": "WARN"}`, http.StatusOK, jsonlog.LevelWarn},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPut, "/v1/admin/log-level", strings.NewReader(tc.body))
+			r = app.contextSetUser(r, admin)
+
+			app.updateLogLevelHandler(w, r)
+
+			if w.Code != tc.wantStatusCode {
+				t.Errorf("want %d; got %d", tc.wantStatusCode, w.Code)
+			}
+			if got := app.Logger.Level(); got != tc.wantLevel {
+				t.Errorf("want level %s; got %s", tc.wantLevel, got)
+			}
+		})
+	}
+}
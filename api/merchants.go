@@ -0,0 +1,343 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
+)
+
+// createMerchantHandler handles the "POST /v1/admin/merchant" endpoint.
+func (app *Application) createMerchantHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	merchant := &data.Merchant{
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      input.Name,
+		Active:    true,
+		Version:   1,
+	}
+
+	v := validator.New()
+	if data.ValidateMerchant(v, merchant); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	id, err := app.Models.Merchants.Insert(r.Context(), merchant)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	merchant.ID = id
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/merchant/%s", merchant.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"merchant": merchant}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listMerchantsHandler handles the "GET /v1/admin/merchant" endpoint.
+func (app *Application) listMerchantsHandler(w http.ResponseWriter, r *http.Request) {
+	merchants, err := app.Models.Merchants.GetAll(r.Context())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"merchants": merchants}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createAPIKeyHandler handles the "POST /v1/admin/merchant/{id}/key" endpoint. The plaintext key
+// is only returned in this response and can't be retrieved again.
+func (app *Application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Scopes []string `json:"scopes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateScopes(v, input.Scopes); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	merchant, err := app.Models.Merchants.Get(r.Context(), app.readIDParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	plaintext, key, err := app.issueAPIKey(r.Context(), merchant.ID, input.Scopes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"key": plaintext, "api_key": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listAPIKeysHandler handles the "GET /v1/admin/merchant/{id}/key" endpoint. Only key metadata is
+// returned, never the keys themselves.
+func (app *Application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	merchant, err := app.Models.Merchants.Get(r.Context(), app.readIDParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	keys, err := app.Models.Merchants.GetKeys(r.Context(), merchant.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// rotateAPIKeyHandler handles the "POST /v1/admin/merchant/{id}/key/{key}/rotate" endpoint. It
+// issues a new key with the same scopes and revokes the old one. The new key is stored first, so
+// that a failure never leaves the merchant without a working key.
+func (app *Application) rotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	merchantID := app.readIDParam(r)
+
+	old, err := app.Models.Merchants.GetKey(r.Context(), app.readParam(r, "key"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if old.MerchantID != merchantID || old.IsRevoked() {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	plaintext, key, err := app.issueAPIKey(r.Context(), merchantID, old.Scopes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Merchants.RevokeKey(r.Context(), merchantID, old.ID, time.Now())
+	if err != nil {
+		// Revoke the new key again rather than leave both working, since the caller will
+		// retry the rotation.
+		if rollbackErr := app.Models.Merchants.RevokeKey(r.Context(), merchantID, key.ID, time.Now()); rollbackErr != nil {
+			app.logError(r, rollbackErr)
+		}
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"key": plaintext, "api_key": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeAPIKeyHandler handles the "DELETE /v1/admin/merchant/{id}/key/{key}" endpoint.
+func (app *Application) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.Models.Merchants.RevokeKey(r.Context(), app.readIDParam(r), app.readParam(r, "key"), time.Now())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "api key successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// issueAPIKey generates and stores a new API key for the merchant, returning the plaintext key.
+func (app *Application) issueAPIKey(ctx context.Context, merchantID string, scopes []string) (string, *data.APIKey, error) {
+	plaintext, key, err := data.GenerateAPIKey(merchantID, scopes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = app.Models.Merchants.InsertKey(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return plaintext, key, nil
+}
+
+// validateMerchantVoucherHandler handles the "GET /v1/merchant/voucher/{id}" endpoint. It requires
+// the "vouchers:validate" scope and reports whether the voucher can currently be used.
+func (app *Application) validateMerchantVoucherHandler(w http.ResponseWriter, r *http.Request) {
+	voucher, err := app.Models.Vouchers.Get(r.Context(), app.readIDParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{"voucher": voucher, "valid": voucher.IsRedeemable(time.Now())}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// useMerchantVoucherHandler handles the "PUT /v1/merchant/voucher/{id}/use" endpoint. It requires
+// the "vouchers:use" scope and uses the voucher on behalf of the shopper given in the body.
+func (app *Application) useMerchantVoucherHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserID string `json:"user_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.UserID != "", "user_id", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Users.Get(r.Context(), strings.ToLower(input.UserID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.useVoucher(r.Context(), user, app.readIDParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, errVoucherNotAvailable):
+			app.voucherNotAvailableResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"voucher": "successfully used voucher"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// earnMerchantPointsHandler handles the "PUT /v1/merchant/user/{id}/point" endpoint. It requires
+// the "points:earn" scope and credits points to the shopper.
+func (app *Application) earnMerchantPointsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Points int `json:"points"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidatePoints(v, input.Points); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Users.Get(r.Context(), app.readIDParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Users.AddPoints(r.Context(), user.ID, input.Points)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.recordPoints(r.Context(), user.ID, data.EventPointsEarned, input.Points, map[string]string{
+		"source":      "merchant",
+		"merchant_id": app.contextGetAPIKey(r).MerchantID,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Metrics.PointsEarned("merchant", input.Points)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "points added"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
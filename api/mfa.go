@@ -0,0 +1,344 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+	"github.com/toduluz/savingsquadsbackend/internal/totp"
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
+)
+
+// mfaSkew is the number of 30-second time steps of clock drift tolerated either side of the
+// current time when checking a TOTP code.
+const mfaSkew = 1
+
+// mfaRecoveryCodes is the number of recovery codes generated when MFA is enabled.
+const mfaRecoveryCodes = 10
+
+// enrolMFAHandler handles the "POST /v1/user/mfa/enrol" endpoint. It generates a new TOTP secret
+// for the user and returns it along with an otpauth:// URI for authenticator apps. The secret
+// only takes effect once it has been confirmed with a valid code.
+func (app *Application) enrolMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	if user.MFA.Enabled {
+		app.mfaAlreadyEnabledResponse(w, r)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Users.SetMFAPendingSecret(r.Context(), user.ID, secret)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"secret": secret,
+		"uri":    totp.URI(app.Config.Mfa.Issuer, user.Email, secret),
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// confirmMFAHandler handles the "POST /v1/user/mfa/confirm" endpoint. It checks a code against the
+// pending secret, enables MFA and returns the recovery codes, which are only ever shown once.
+func (app *Application) confirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if user.MFA.Enabled {
+		app.mfaAlreadyEnabledResponse(w, r)
+		return
+	}
+	if user.MFA.PendingSecret == "" {
+		app.badRequestResponse(w, r, errors.New("two-factor authentication enrolment has not been started"))
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	step, ok := totp.Validate(user.MFA.PendingSecret, input.Code, time.Now(), mfaSkew)
+	v.Check(ok, "code", "is invalid or has expired")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	codes, hashes, err := data.GenerateRecoveryCodes(mfaRecoveryCodes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Users.EnableMFA(r.Context(), user.ID, user.MFA.PendingSecret, hashes, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Events.Insert(r.Context(), &data.Event{
+		UserID:    user.ID,
+		Type:      data.EventMFAEnabled,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"recovery_codes": codes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// disableMFAHandler handles the "POST /v1/user/mfa/disable" endpoint. The user must provide a
+// current code or an unused recovery code.
+func (app *Application) disableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !user.MFA.Enabled {
+		app.mfaNotEnabledResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	if validateMFAInput(v, input.Code, input.RecoveryCode); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ok, err := app.checkMFACode(r.Context(), user, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.Models.Users.DisableMFA(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.Models.Events.Insert(r.Context(), &data.Event{
+		UserID:    user.ID,
+		Type:      data.EventMFADisabled,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "two-factor authentication disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// verifyMFALoginHandler handles the "POST /v1/user/login/mfa" endpoint, which is the second step
+// of login for users with MFA enabled. It exchanges the challenge token issued by
+// loginUserHandler, from the body or the challenge cookie, and a valid code for a session.
+func (app *Application) verifyMFALoginHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MfaToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		DeviceName   string `json:"device_name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Clients which logged in with cookie mode have the challenge token in a cookie rather
+	// than in the body.
+	if input.MfaToken == "" {
+		input.MfaToken, _ = app.getCookie(r, mfaChallengeCookie)
+	}
+
+	v := validator.New()
+	v.Check(input.MfaToken != "", "mfa_token", "must be provided")
+	mode := app.readSessionMode(r, v)
+	validateDeviceName(v, input.DeviceName)
+	if validateMFAInput(v, input.Code, input.RecoveryCode); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	claims, err := app.validateMFAChallengeToken(input.MfaToken)
+	if err != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	user, err := app.Models.Users.Get(r.Context(), claims.Subject)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if user.IsLocked(time.Now()) {
+		app.accountLockedResponse(w, r, user.LockedUntil)
+		return
+	}
+
+	ok, err := app.checkMFACode(r.Context(), user, input.Code, input.RecoveryCode)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !ok {
+		// Wrong codes count towards the same lockout as wrong passwords.
+		lockedUntil, err := app.registerFailedLogin(r.Context(), user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !lockedUntil.IsZero() {
+			app.accountLockedResponse(w, r, lockedUntil)
+			return
+		}
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+	if user.FailedLogins > 0 {
+		err = app.Models.Users.ResetFailedLogins(r.Context(), user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// The challenge has been used, so clear the cookie if there is one.
+	if _, err := r.Cookie(mfaChallengeCookie); err == nil {
+		err = app.setCookie(w, mfaChallengeCookie, "", -1)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelope{"message": "successfully logged in"}
+	err = app.startSession(w, r, user, mode, input.DeviceName, env)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mfaChallengeCookie is the name of the cookie which holds the MFA challenge token in cookie
+// mode, so that browser clients never see it.
+const mfaChallengeCookie = "mfa_challenge"
+
+// mfaChallengeResponse issues a challenge token in place of a session, for users with MFA
+// enabled who have passed the first step of login. In cookie mode the token is set as an
+// encrypted cookie, otherwise it is returned in the "mfa_token" field.
+func (app *Application) mfaChallengeResponse(w http.ResponseWriter, r *http.Request, user *data.User, mode string) {
+	challenge, err := app.createMFAChallengeToken(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"mfa_required": true}
+	if mode == sessionModeToken {
+		env["mfa_token"] = string(challenge)
+	} else {
+		err = app.setCookie(w, mfaChallengeCookie, string(challenge), int(mfaChallengeDuration.Seconds()))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkMFACode verifies a TOTP code, or if none is given a recovery code, for the user and marks
+// it as used so that it can't be replayed. It returns false if the code is wrong or already used.
+func (app *Application) checkMFACode(ctx context.Context, user *data.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := totp.Validate(user.MFA.Secret, code, time.Now(), mfaSkew)
+		if !ok {
+			return false, nil
+		}
+		err := app.Models.Users.UseMFAStep(ctx, user.ID, step)
+		if err != nil {
+			if errors.Is(err, data.ErrMFACodeReused) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+
+	err := app.Models.Users.ConsumeRecoveryCode(ctx, user.ID, data.HashRecoveryCode(recoveryCode))
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// validateMFAInput checks that exactly one of a code or a recovery code has been provided.
+func validateMFAInput(v *validator.Validator, code, recoveryCode string) {
+	v.Check(code != "" || recoveryCode != "", "code", "must be provided")
+	v.Check(code == "" || recoveryCode == "", "recovery_code", "must not be provided together with code")
+}
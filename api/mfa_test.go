@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+)
+
+func TestMFAChallengeResponse(t *testing.T) {
+	app := newTestApplication(t)
+	user := &data.User{ID: "testID"}
+
+	tests := []struct {
+		name       string
+		mode       string
+		wantCookie bool
+		wantToken  bool
+	}{
+		{"Cookie mode", sessionModeCookie, true, false},
+		{"Token mode", sessionModeToken, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			app.mfaChallengeResponse(w, httptest.NewRequest(http.MethodPost, "/v1/user/login", nil), user, tt.mode)
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["mfa_required"] != true {
+				t.Errorf("got body %v; want mfa_required", body)
+			}
+			if _, ok := body["mfa_token"]; ok != tt.wantToken {
+				t.Errorf("got mfa_token in body %t; want %t", ok, tt.wantToken)
+			}
+
+			cookies := w.Result().Cookies()
+			if gotCookie := len(cookies) == 1 && cookies[0].Name == mfaChallengeCookie; gotCookie != tt.wantCookie {
+				t.Fatalf("got cookies %v; want challenge cookie %t", cookies, tt.wantCookie)
+			}
+			if !tt.wantCookie {
+				return
+			}
+
+			// The cookie must decrypt to a valid challenge token.
+			r := httptest.NewRequest(http.MethodPost, "/v1/user/login/mfa", nil)
+			r.AddCookie(cookies[0])
+			token, err := app.getCookie(r, mfaChallengeCookie)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := app.validateMFAChallengeToken(token); err != nil {
+				t.Errorf("invalid challenge token in cookie: %v", err)
+			}
+		})
+	}
+}
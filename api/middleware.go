@@ -1,12 +1,16 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/toduluz/savingsquadsbackend/internal/cookies"
 	"github.com/toduluz/savingsquadsbackend/internal/data"
+	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
 )
 
 // recoverPanic is middleware that recovers from a panic by responding with a 500 Internal Server
@@ -35,6 +39,62 @@ func (app *Application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// logRequest assigns the request its ID, or takes the one from the X-Request-ID header, and
+// writes a line to the access log once it has been handled. The ID is sent back in the
+// X-Request-ID header and included in the errors logged for the request, along with the trace
+// ID if the request is traced.
+func (app *Application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id, err := requestID(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		info := &requestInfo{id: id}
+		r = app.contextSetRequestInfo(r, info)
+		w.Header().Set("X-Request-ID", id)
+
+		rec := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			fields := []jsonlog.Field{
+				jsonlog.String("request_id", id),
+				jsonlog.String("method", r.Method),
+				jsonlog.String("route", routeTemplate(r)),
+				jsonlog.Int("status", rec.statusCode()),
+				jsonlog.Int("bytes", rec.bytes),
+				jsonlog.Duration("duration", time.Since(start)),
+			}
+			if info.userID != "" {
+				fields = append(fields, jsonlog.String("user_id", info.userID))
+			}
+			if id := traceID(r); id != "" {
+				fields = append(fields, jsonlog.String("trace_id", id))
+			}
+			app.Logger.Info("request", fields...)
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// recordMetrics records the count, duration and status of requests by their route template, so
+// that "/v1/voucher/abc" and "/v1/voucher/def" are counted together. Requests which match no
+// route are counted under "unmatched".
+func (app *Application) recordMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done := app.Metrics.RequestStarted(r.Method)
+
+		rec := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			done(routeTemplate(r), rec.statusCode())
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
 func (app *Application) requireAuthenticatedUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Use the contextGetUser() helper that we made earlier to retrieve the user
@@ -59,53 +119,81 @@ func (app *Application) requireAuthenticatedUser(next http.Handler) http.Handler
 
 func (app *Application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		// Clients which can't use cookies send the session JWT, and merchants their API key, in
+		// an "Authorization: Bearer <token>" header. The header takes precedence over the
+		// cookie.
+		var token string
+		if authorizationHeader := r.Header.Get("Authorization"); authorizationHeader != "" {
+			headerParts := strings.Split(authorizationHeader, " ")
+			if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			if _, ok := data.ParseAPIKey(headerParts[1]); ok {
+				app.authenticateAPIKey(w, r, next, headerParts[1])
+				return
+			}
 
-		token, err := app.getCookie(r, "jwt")
+			token = headerParts[1]
+		} else {
+			var err error
+			token, err = app.getCookie(r, "jwt")
+			if err != nil {
+				switch {
+				case errors.Is(err, http.ErrNoCookie):
+					r = app.contextSetUser(r, data.AnonymousUser)
+					next.ServeHTTP(w, r)
+				case errors.Is(err, cookies.ErrInvalidValue):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.Logger.PrintError(err, nil)
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+		}
+
+		claims, err := app.validateJWTClaims(token)
+		if err != nil {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		// An MFA challenge token only proves the password step of login, so it can't be used
+		// as a session.
+		if isMFAChallenge(claims) {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+		// Check that the session the token belongs to hasn't been revoked or expired, so that
+		// revoking a device logs it out immediately.
+		session, err := app.Models.Sessions.Get(r.Context(), sessionID(claims))
 		if err != nil {
 			switch {
-			case errors.Is(err, http.ErrNoCookie):
-				r = app.contextSetUser(r, data.AnonymousUser)
-				next.ServeHTTP(w, r)
-			case errors.Is(err, cookies.ErrInvalidValue):
+			case errors.Is(err, data.ErrRecordNotFound):
 				app.invalidAuthenticationTokenResponse(w, r)
 			default:
-				app.Logger.PrintError(err, nil)
 				app.serverErrorResponse(w, r, err)
 			}
 			return
 		}
-
-		// w.Header().Add("Vary", "Authorization")
-		// authorizationHeader := r.Header.Get("Authorization")
-		// if authorizationHeader == "" {
-		// 	r = app.contextSetUser(r, data.AnonymousUser)
-		// 	next.ServeHTTP(w, r)
-		// 	return
-		// }
-		// headerParts := strings.Split(authorizationHeader, " ")
-		// if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-		// 	app.invalidAuthenticationTokenResponse(w, r)
-		// 	return
-		// }
-		// token := headerParts[1]
-
-		claims, err := app.validateJWTClaims(token)
-		if err != nil {
+		if session.UserID != claims.Subject {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
-		// // Check that the issuer is our Application.
-		// if claims.Issuer != "" {
-		// 	app.invalidAuthenticationTokenResponse(w, r)
-		// 	return
-		// }
-		// // Check that our Application is in the expected audiences for the JWT.
-		// if !claims.AcceptAudience("") {
-		// 	app.invalidAuthenticationTokenResponse(w, r)
-		// 	return
-		// }
+		// Record when the session was last seen, at most once a minute to avoid a database
+		// write on every request. The write outlives the request, so it can't use its context.
+		if now := time.Now(); now.Sub(session.LastSeenAt) > time.Minute {
+			app.background("touch session", func() {
+				if err := app.Models.Sessions.Touch(context.Background(), session.ID, now); err != nil {
+					app.Logger.PrintError(err, nil)
+				}
+			})
+		}
 		// Lookup the user record from the database.
-		user, err := app.Models.Users.Get(claims.Subject)
+		user, err := app.Models.Users.Get(r.Context(), claims.Subject)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -115,12 +203,106 @@ func (app *Application) authenticate(next http.Handler) http.Handler {
 			}
 			return
 		}
-		// Add the user record to the request context and continue as normal.
+		// Add the user and session records to the request context and continue as normal.
 		r = app.contextSetUser(r, user)
+		r = app.contextSetSession(r, session)
 		next.ServeHTTP(w, r)
 	})
 }
 
+// authenticateAPIKey authenticates a merchant by API key. The request continues with the
+// anonymous user and the API key in the context, so merchants can't reach user routes.
+func (app *Application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, plaintext string) {
+	id, _ := data.ParseAPIKey(plaintext)
+
+	key, err := app.Models.Merchants.GetKey(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !key.Matches(plaintext) || key.IsRevoked() {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	merchant, err := app.Models.Merchants.Get(r.Context(), key.MerchantID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if !merchant.Active {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	// Record when the key was last used, at most once a minute so that busy integrations don't
+	// cause a write on every request.
+	if now := time.Now(); now.Sub(key.LastUsedAt) > time.Minute {
+		app.background("touch API key", func() {
+			if err := app.Models.Merchants.TouchKey(context.Background(), key.ID, now); err != nil {
+				app.Logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	r = app.contextSetUser(r, data.AnonymousUser)
+	r = app.contextSetAPIKey(r, key)
+	next.ServeHTTP(w, r)
+}
+
+// requireAPIKey checks that the request was authenticated with a merchant API key, before the
+// request is validated or requireScope checks the scope of the key.
+func (app *Application) requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetAPIKey(r) == nil {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireScope checks that the request was authenticated with a merchant API key which has been
+// granted the scope.
+func (app *Application) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := app.contextGetAPIKey(r)
+		if key == nil {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		if !key.HasScope(scope) {
+			app.missingScopeResponse(w, r, scope)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireRole checks that the authenticated user has been granted the role. It must come after
+// requireAuthenticatedUser.
+func (app *Application) requireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.contextGetUser(r).HasRole(role) {
+				app.notPermittedResponse(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // enableCORS sets the Vary: Origin and Access-Control-Allow-Origin response headers in order to
 // enabled CORS for trusted origins.
 func (app *Application) enableCORS(next http.Handler) http.Handler {
@@ -151,7 +333,7 @@ func (app *Application) enableCORS(next http.Handler) http.Handler {
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						// Set the necessary preflight response headers.
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-CSRF-Token")
 
 						// Set max cached times for headers for 60 seconds.
 						w.Header().Set("Access-Control-Max-Age", "60")
@@ -1,9 +1,16 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
+	"github.com/toduluz/savingsquadsbackend/internal/metrics"
 )
 
 func TestAuthenticate(t *testing.T) {
@@ -48,3 +55,299 @@ func TestAuthenticate(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthenticateRejectsMFAChallenge(t *testing.T) {
+	app := newTestApplication(t)
+
+	challenge, err := app.createMFAChallengeToken(&data.User{ID: "testID"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write the challenge token as the "jwt" cookie and copy it onto the request.
+	rec := httptest.NewRecorder()
+	if err := app.setCookie(rec, "jwt", string(challenge), 60); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	w := httptest.NewRecorder()
+	app.authenticate(next).ServeHTTP(w, r)
+
+	if rs := w.Result(); rs.StatusCode != http.StatusUnauthorized {
+		t.Errorf("want %d; got %d", http.StatusUnauthorized, rs.StatusCode)
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name           string
+		authorization  string
+		wantStatusCode int
+	}{
+		{"Malformed header", "Token abc", http.StatusUnauthorized},
+		{"Unknown API key", "Bearer ssk_unknown_secret", http.StatusUnauthorized},
+		{"Not an API key", "Bearer abc", http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", tc.authorization)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("OK"))
+			})
+
+			app.authenticate(next).ServeHTTP(w, r)
+
+			if rs := w.Result(); rs.StatusCode != tc.wantStatusCode {
+				t.Errorf("want %d; got %d", tc.wantStatusCode, rs.StatusCode)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name           string
+		key            *data.APIKey
+		wantStatusCode int
+	}{
+		{"No API key", nil, http.StatusUnauthorized},
+		{"Missing scope", &data.APIKey{Scopes: []string{data.ScopePointsEarn}}, http.StatusForbidden},
+		{"Granted scope", &data.APIKey{Scopes: []string{data.ScopeVouchersValidate}}, http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.key != nil {
+				r = app.contextSetAPIKey(r, tc.key)
+			}
+
+			next := func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("OK"))
+			}
+
+			app.requireScope(data.ScopeVouchersValidate, next).ServeHTTP(w, r)
+
+			if rs := w.Result(); rs.StatusCode != tc.wantStatusCode {
+				t.Errorf("want %d; got %d", tc.wantStatusCode, rs.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAuthenticateBearerJWT(t *testing.T) {
+	app := newTestApplication(t)
+
+	token, err := app.createJWTClaims(&data.User{ID: "testID", Version: 1}, "testSessionID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := app.createJWTClaims(&data.User{ID: "testID", Version: 1}, "revokedSessionID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherUser, err := app.createJWTClaims(&data.User{ID: "otherID", Version: 1}, "testSessionID")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		authorization    string
+		wantStatusCode   int
+		wantAuthenticate string
+	}{
+		{"Valid token", "Bearer " + string(token), http.StatusOK, ""},
+		{"Tampered token", "Bearer " + string(token) + "x", http.StatusUnauthorized, `Bearer realm="savingsquads", error="invalid_token"`},
+		{"Revoked session", "Bearer " + string(revoked), http.StatusUnauthorized, `Bearer realm="savingsquads", error="invalid_token"`},
+		{"Session of another user", "Bearer " + string(otherUser), http.StatusUnauthorized, `Bearer realm="savingsquads", error="invalid_token"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Authorization", tc.authorization)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("OK"))
+			})
+
+			app.authenticate(next).ServeHTTP(w, r)
+
+			rs := w.Result()
+			if rs.StatusCode != tc.wantStatusCode {
+				t.Errorf("want %d; got %d", tc.wantStatusCode, rs.StatusCode)
+			}
+			if got := rs.Header.Get("WWW-Authenticate"); got != tc.wantAuthenticate {
+				t.Errorf("want WWW-Authenticate %q; got %q", tc.wantAuthenticate, got)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name           string
+		user           *data.User
+		wantStatusCode int
+	}{
+		{"Without role", &data.User{ID: "testID"}, http.StatusForbidden},
+		{"With role", &data.User{ID: "testID", Roles: []string{data.RoleAdmin}}, http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = app.contextSetUser(r, tc.user)
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("OK"))
+			})
+
+			app.requireRole(data.RoleAdmin)(next).ServeHTTP(w, r)
+
+			rs := w.Result()
+			if rs.StatusCode != tc.wantStatusCode {
+				t.Errorf("want %d; got %d", tc.wantStatusCode, rs.StatusCode)
+			}
+		})
+	}
+}
+
+// TestVoucherRoutesRequireAdmin checks that the voucher routes are gated by the admin role, so
+// that signed-in users can't create or delete vouchers.
+func TestVoucherRoutesRequireAdmin(t *testing.T) {
+	app := newTestApplication(t)
+
+	token, err := app.createJWTClaims(&data.User{ID: "testID", Version: 1}, "testSessionID")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	voucher := `{"id": "summer10", "description": "Summer sale", "start": "2026-06-01T00:00:00Z", "expires": "2026-09-01T00:00:00Z"}`
+
+	for _, route := range []struct{ method, target, body string }{
+		{http.MethodGet, "/v1/voucher", ""},
+		{http.MethodPost, "/v1/voucher", voucher},
+		{http.MethodGet, "/v1/voucher/summer10", ""},
+		{http.MethodDelete, "/v1/voucher/summer10", ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(route.method, route.target, strings.NewReader(route.body))
+		r.Header.Set("Authorization", "Bearer "+string(token))
+
+		app.Routes().ServeHTTP(w, r)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s: want %d; got %d", route.method, route.target, http.StatusForbidden, w.Code)
+		}
+	}
+}
+
+func TestRecordMetrics(t *testing.T) {
+	app := newTestApplication(t)
+	app.Metrics = metrics.New()
+
+	routes := app.Routes()
+	for _, path := range []string{"/healthz", "/v1/user/point", "/no/such/route"} {
+		routes.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	app.Metrics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/healthz",status="200"} 1`,
+		`http_requests_total{method="GET",route="/v1/user/point",status="401"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("missing %s in:\n%s", want, rr.Body)
+		}
+	}
+}
+
+func TestLogRequest(t *testing.T) {
+	app := newTestApplication(t)
+	var buf bytes.Buffer
+	app.Logger = jsonlog.NewLogger(&buf, jsonlog.LevelInfo)
+
+	tests := []struct {
+		name      string
+		requestID string
+		wantID    string
+	}{
+		{"Propagated ID", "abc-123", "abc-123"},
+		{"Invalid ID", "abc 123\n", ""},
+		{"Missing ID", "", ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.requestID != "" {
+				r.Header.Set("X-Request-ID", tc.requestID)
+			}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r = app.contextSetUser(r, &data.User{ID: "testID"})
+				w.WriteHeader(http.StatusTeapot)
+				w.Write([]byte("OK"))
+			})
+
+			app.logRequest(next).ServeHTTP(w, r)
+
+			id := w.Result().Header.Get("X-Request-ID")
+			switch {
+			case tc.wantID != "" && id != tc.wantID:
+				t.Errorf("got X-Request-ID %q; want %q", id, tc.wantID)
+			case tc.wantID == "" && (id == "" || id == tc.requestID):
+				t.Errorf("got X-Request-ID %q; want a new ID", id)
+			}
+
+			var entry struct {
+				Message    string         `json:"message"`
+				Properties map[string]any `json:"properties"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]any{
+				"request_id": id,
+				"method":     http.MethodGet,
+				"route":      "unmatched",
+				"status":     float64(http.StatusTeapot),
+				"bytes":      float64(2),
+				"user_id":    "testID",
+			}
+			for key, value := range want {
+				if entry.Properties[key] != value {
+					t.Errorf("got %s %v; want %v", key, entry.Properties[key], value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+	"github.com/toduluz/savingsquadsbackend/internal/oidc"
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
+)
+
+// oidcStateCookie is the name of the cookie which holds the state of an OpenID Connect login
+// between the redirect to the provider and the callback. It is encrypted, since the PKCE code
+// verifier must not be revealed to anyone who can read the cookie.
+const oidcStateCookie = "oidc_state"
+
+// oidcStateDuration is how long the user has to complete a login at the provider.
+const oidcStateDuration = 10 * time.Minute
+
+var errEmailNotVerified = errors.New("the email address has not been verified by the provider")
+
+// oidcState is stored in the state cookie. State protects the callback against CSRF, Nonce binds
+// the ID token to this login and Verifier is the PKCE code verifier.
+type oidcState struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Mode     string `json:"mode"`
+}
+
+// oidcLoginHandler handles the "GET /v1/user/oidc/{provider}/login" endpoint. It stores a new
+// state, nonce and code verifier in a cookie and redirects the user to the provider to sign in.
+func (app *Application) oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.Providers[app.readParam(r, "provider")]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	mode := app.readSessionMode(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	state := oidcState{Provider: provider.Name, Mode: mode}
+	for _, value := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		var err error
+		*value, err = oidc.RandomString()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state.State, state.Nonce, state.Verifier)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	js, err := json.Marshal(state)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.setOIDCStateCookie(w, string(js), int(oidcStateDuration.Seconds()))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler handles the "GET /v1/user/oidc/{provider}/callback" endpoint, which the
+// provider redirects the user back to. It exchanges the authorization code for an ID token, finds
+// or creates the user it belongs to and starts a session, or issues an MFA challenge.
+func (app *Application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.Providers[app.readParam(r, "provider")]
+	if !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	// The provider redirects back with an error if the user declined to sign in.
+	if e := qs.Get("error"); e != "" {
+		app.badRequestResponse(w, r, fmt.Errorf("sign in with %s failed: %s", provider.Name, e))
+		return
+	}
+
+	value, err := app.getCookie(r, oidcStateCookie)
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("missing or invalid login state"))
+		return
+	}
+	var state oidcState
+	err = json.Unmarshal([]byte(value), &state)
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("missing or invalid login state"))
+		return
+	}
+
+	// Clear the state cookie so that it can only be used once.
+	err = app.setOIDCStateCookie(w, "", -1)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if state.Provider != provider.Name || subtle.ConstantTimeCompare([]byte(qs.Get("state")), []byte(state.State)) != 1 {
+		app.badRequestResponse(w, r, errors.New("login state mismatch"))
+		return
+	}
+
+	v := validator.New()
+	if v.Check(qs.Get("code") != "", "code", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), qs.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrExchangeFailed):
+			app.badRequestResponse(w, r, err)
+		case errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, oidc.ErrNonceMismatch):
+			app.invalidCredentialsResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.findOrCreateOIDCUser(r.Context(), provider.Name, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errEmailNotVerified):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.IsLocked(time.Now()) {
+		app.accountLockedResponse(w, r, user.LockedUntil)
+		return
+	}
+	// Signing in with a provider replaces the password, not the second factor.
+	if user.MFA.Enabled {
+		app.mfaChallengeResponse(w, r, user, state.Mode)
+		return
+	}
+
+	env := envelope{"message": "successfully logged in"}
+	err = app.startSession(w, r, user, state.Mode, "", env)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// findOrCreateOIDCUser returns the user which the provider identity is linked to. If there is
+// none, the identity is linked to the user with the same email address, or a new user is created
+// for it. Either requires the provider to have verified the email address, since otherwise anyone
+// could take over an account by signing up at the provider with its email address.
+func (app *Application) findOrCreateOIDCUser(ctx context.Context, provider string, claims *oidc.Claims) (*data.User, error) {
+	user, err := app.Models.Users.GetByIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errEmailNotVerified
+	}
+
+	identity := data.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		LinkedAt: time.Now(),
+	}
+
+	user, err = app.Models.Users.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		err = app.Models.Users.AddIdentity(ctx, user.ID, identity)
+		if err != nil {
+			return nil, err
+		}
+
+		err = app.Models.Events.Insert(ctx, &data.Event{
+			UserID:     user.ID,
+			Type:       data.EventIdentityLinked,
+			CreatedAt:  time.Now(),
+			Properties: map[string]string{"provider": provider},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	case !errors.Is(err, data.ErrRecordNotFound):
+		return nil, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	user = &data.User{
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+		Name:       name,
+		Email:      claims.Email,
+		Addresses:  []data.Address{},
+		Phone:      []data.Phone{},
+		Vouchers:   map[string]int{},
+		Points:     0,
+		Version:    1,
+		Identities: []data.Identity{identity},
+	}
+
+	// The user signs in with the provider, so give them a random password which can't be
+	// guessed.
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	_, span := tracer.Start(ctx, "Password.Set")
+	err = user.Password.Set(password)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		return nil, fmt.Errorf("invalid profile from %s: %v", provider, v.Errors)
+	}
+
+	id, err := app.Models.Users.Insert(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	user.ID = id
+	app.Metrics.UserRegistered("oidc")
+
+	return user, nil
+}
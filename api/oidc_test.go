@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/toduluz/savingsquadsbackend/internal/oidc"
+)
+
+// newTestProvider returns a provider backed by a fake issuer which only serves its discovery
+// document, which is all that is needed before the callback.
+func newTestProvider(t *testing.T) *oidc.Provider {
+	t.Helper()
+
+	var issuer *httptest.Server
+	issuer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer.URL,
+			"authorization_endpoint": issuer.URL + "/authorize",
+			"token_endpoint":         issuer.URL + "/token",
+			"jwks_uri":               issuer.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(issuer.Close)
+
+	return oidc.NewProvider(oidc.Config{
+		Name:        "fake",
+		Issuer:      issuer.URL,
+		ClientID:    "client",
+		RedirectURL: "http://localhost:4000/v1/user/oidc/fake/callback",
+	})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	app := newTestApplication(t)
+	app.Providers = map[string]*oidc.Provider{"fake": newTestProvider(t)}
+	routes := app.Routes()
+
+	// Start a login and check that the user is redirected to the provider with PKCE.
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/user/oidc/fake/login", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusFound)
+	}
+
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs := location.Query()
+	if qs.Get("code_challenge_method") != "S256" || qs.Get("code_challenge") == "" {
+		t.Errorf("redirect %q is missing the PKCE code challenge", location)
+	}
+	if qs.Get("state") == "" || qs.Get("nonce") == "" {
+		t.Errorf("redirect %q is missing the state or nonce", location)
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie {
+		t.Fatalf("got cookies %v; want the %s cookie", cookies, oidcStateCookie)
+	}
+	// The state is encrypted, so the cookie doesn't reveal the code verifier next to it.
+	value, err := base64.URLEncoding.DecodeString(cookies[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(value), qs.Get("state")) {
+		t.Error("the state cookie isn't encrypted")
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		cookie   *http.Cookie
+		wantCode int
+	}{
+		{"Unknown provider", "/v1/user/oidc/other/callback?code=abc&state=" + qs.Get("state"), cookies[0], http.StatusNotFound},
+		{"Missing state cookie", "/v1/user/oidc/fake/callback?code=abc&state=" + qs.Get("state"), nil, http.StatusBadRequest},
+		{"State mismatch", "/v1/user/oidc/fake/callback?code=abc&state=forged", cookies[0], http.StatusBadRequest},
+		{"Provider error", "/v1/user/oidc/fake/callback?error=access_denied&state=" + qs.Get("state"), cookies[0], http.StatusBadRequest},
+		{"Missing code", "/v1/user/oidc/fake/callback?state=" + qs.Get("state"), cookies[0], http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+
+			rr := httptest.NewRecorder()
+			routes.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("got status %d; want %d: %s", rr.Code, tt.wantCode, rr.Body)
+			}
+		})
+	}
+}
+
+func TestOIDCLoginUnknownProvider(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	app.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/user/oidc/fake/login", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("got status %d; want %d", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// openAPISpec is the OpenAPI document of the API. It is written in YAML, which is easier to
+// maintain by hand, and served as JSON.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// openAPIJSON converts the OpenAPI document to JSON the first time it is served.
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	var spec map[string]any
+	if err := yaml.Unmarshal(openAPISpec, &spec); err != nil {
+		return nil, err
+	}
+	return json.Marshal(spec)
+})
+
+// openAPIDoc loads the OpenAPI document which requests are validated against the first time it is
+// needed, and checks that it is a valid document.
+var openAPIDoc = sync.OnceValues(func() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, err
+	}
+	return doc, doc.Validate(context.Background())
+})
+
+// openAPIHandler handles the "GET /v1/openapi.json" endpoint, which serves the OpenAPI document
+// that the Swagger UI at /v1/docs/ is rendered from.
+func (app *Application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	spec, err := openAPIJSON()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(spec)
+}
+
+// validateRequest is middleware which validates the path parameters, query string parameters and
+// body of a request against its operation in the OpenAPI document, before the handler reads them.
+// A body which can't be read as JSON gets a 400 Bad Request, as it would from readJSON, and values
+// which don't match their schema get a 422 Unprocessable Entity listing every invalid field. The
+// fields are given as JSON pointers into the request: "/body/points", "/query/page_size" or
+// "/path/id". Bodies without a Content-Type are taken to be JSON, as readJSON always has.
+//
+// The operation is found by the template of the matched route, so the middleware must be used on
+// routers whose routes are all in the document, which TestOpenAPIRoutes checks.
+func (app *Application) validateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, err := openAPIDoc()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		path, err := mux.CurrentRoute(r).GetPathTemplate()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		pathItem := doc.Paths.Find(path)
+		if pathItem == nil || pathItem.GetOperation(r.Method) == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		operation := pathItem.GetOperation(r.Method)
+
+		if operation.RequestBody != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+			if r.Header.Get("Content-Type") == "" {
+				r.Header.Set("Content-Type", "application/json")
+			}
+		}
+
+		ctx, span := tracer.Start(r.Context(), "validateRequest")
+		err = openapi3filter.ValidateRequest(ctx, &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: mux.Vars(r),
+			Route: &routers.Route{
+				Spec:      doc,
+				Path:      path,
+				PathItem:  pathItem,
+				Method:    r.Method,
+				Operation: operation,
+			},
+			Options: &openapi3filter.Options{
+				MultiError: true,
+				// Authentication is left to the authenticate middleware.
+				AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+				SkipSettingDefaults: true,
+			},
+		})
+		span.End()
+		if err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		errs, badRequest := requestValidationErrors(err)
+		switch {
+		case badRequest != nil:
+			app.badRequestResponse(w, r, badRequest)
+		case len(errs) > 0:
+			app.failedValidationResponse(w, r, errs)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+	})
+}
+
+// requestValidationErrors turns the error from validating a request into the invalid fields of
+// the request, keyed by their JSON pointer, or an error for a body which couldn't be read at all.
+func requestValidationErrors(err error) (map[string]string, error) {
+	errs := make(map[string]string)
+	var badRequest error
+
+	var walk func(err error)
+	walk = func(err error) {
+		var maxBytesErr *http.MaxBytesError
+		var parseErr *openapi3filter.ParseError
+
+		// The errors are matched by type rather than with errors.As, which would look through
+		// a RequestError into the schema errors it holds.
+		switch err := err.(type) {
+		case openapi3.MultiError:
+			for _, err := range err {
+				walk(err)
+			}
+
+		case *openapi3filter.RequestError:
+			switch {
+			case err.Parameter != nil:
+				param := err.Parameter
+				pointer := "/" + param.In + "/" + escapeJSONPointer(param.Name)
+				switch {
+				case errors.Is(err.Err, openapi3filter.ErrInvalidRequired):
+					addValidationError(errs, pointer, "must be provided")
+				case errors.As(err.Err, &parseErr) && param.Schema != nil && param.Schema.Value != nil:
+					addValidationError(errs, pointer, "must be a valid "+param.Schema.Value.Type)
+				default:
+					addSchemaErrors(errs, pointer, err.Err)
+				}
+
+			case badRequest != nil:
+				// Only the first problem with the body is reported.
+
+			case errors.As(err.Err, &maxBytesErr):
+				badRequest = fmt.Errorf("body must not be larger than %d bytes", maxBytesErr.Limit)
+			case errors.Is(err.Err, openapi3filter.ErrInvalidRequired):
+				badRequest = errors.New("body must not be empty")
+			case errors.As(err.Err, &parseErr):
+				badRequest = errors.New("body contains badly-formed JSON")
+			case err.Err == nil:
+				// The only error without a cause is a Content-Type other than JSON.
+				badRequest = errors.New("body must be JSON")
+			default:
+				addSchemaErrors(errs, "/body", err.Err)
+			}
+		}
+	}
+	walk(err)
+
+	return errs, badRequest
+}
+
+// addSchemaErrors adds the errors from validating a value against its schema, under the JSON
+// pointer of the value in the request.
+func addSchemaErrors(errs map[string]string, pointer string, err error) {
+	switch err := err.(type) {
+	case openapi3.MultiError:
+		for _, err := range err {
+			addSchemaErrors(errs, pointer, err)
+		}
+	case *openapi3.SchemaError:
+		key := pointer
+		for _, token := range err.JSONPointer() {
+			key += "/" + escapeJSONPointer(token)
+		}
+		message := err.Reason
+		switch err.SchemaField {
+		case "required":
+			// The pointer of a missing property is the property itself, so the reason needn't
+			// repeat its name.
+			message = "must be provided"
+		case "format":
+			// Rather than the regular expression of the format.
+			message = "must be a valid " + err.Schema.Format
+		}
+		addValidationError(errs, key, message)
+	default:
+		addValidationError(errs, pointer, err.Error())
+	}
+}
+
+// addValidationError adds an error for the field unless it already has one, like
+// validator.AddError.
+func addValidationError(errs map[string]string, key, message string) {
+	if _, exists := errs[key]; !exists {
+		errs[key] = message
+	}
+}
+
+// escapeJSONPointer escapes a reference token of a JSON pointer, as in RFC 6901.
+func escapeJSONPointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
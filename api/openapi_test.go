@@ -0,0 +1,285 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestOpenAPIRoutes checks that the OpenAPI document describes exactly the routes registered in
+// Routes(), so that neither can change without the other.
+func TestOpenAPIRoutes(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	app.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("got OpenAPI version %q; want 3.x", spec.OpenAPI)
+	}
+
+	documented := make(map[string]bool)
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	// Routes without methods are the subrouter prefixes and the Swagger UI, which aren't API
+	// operations.
+	registered := make(map[string]bool)
+	err := app.Routes().(*mux.Router).Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			registered[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var missing, stale []string
+	for op := range registered {
+		if !documented[op] {
+			missing = append(missing, op)
+		}
+	}
+	for op := range documented {
+		if !registered[op] {
+			stale = append(stale, op)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	if len(missing) > 0 {
+		t.Errorf("routes missing from the OpenAPI document:\n%s", strings.Join(missing, "\n"))
+	}
+	if len(stale) > 0 {
+		t.Errorf("operations in the OpenAPI document without a route:\n%s", strings.Join(stale, "\n"))
+	}
+}
+
+// TestOpenAPIDocument checks that the OpenAPI document is valid, with every $ref resolved, since
+// requests can't be validated against it otherwise.
+func TestOpenAPIDocument(t *testing.T) {
+	if _, err := openAPIDoc(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSwaggerUI(t *testing.T) {
+	app := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	app.Routes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/docs/", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("got status %d; want %d", rr.Code, http.StatusOK)
+	}
+	if !strings.Contains(rr.Body.String(), "/v1/openapi.json") {
+		t.Error("the Swagger UI doesn't load the OpenAPI document")
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	app := newTestApplication(t)
+
+	// Stub out the handlers of a few documented routes, to see what gets through.
+	router := mux.NewRouter()
+	router.Use(app.validateRequest)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	router.HandleFunc("/v1/user/register", ok).Methods(http.MethodPost)
+	router.HandleFunc("/v1/user/point", ok).Methods(http.MethodPut)
+	router.HandleFunc("/v1/voucher", ok).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/merchant/{id}/key", ok).Methods(http.MethodPost)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		contentType string
+		body        string
+		wantStatus  int
+		wantFields  []string
+		wantError   string
+	}{
+		{
+			name:       "valid body",
+			method:     http.MethodPost,
+			target:     "/v1/user/register?mode=token",
+			body:       `{"name": "Alice", "email": "alice@example.com", "password": "pa55word"}`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "invalid body",
+			method:     http.MethodPost,
+			target:     "/v1/user/register",
+			body:       `{"name": 1, "password": "short", "device_name": "phone"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"/body/email", "/body/name", "/body/password"},
+		},
+		{
+			name:       "unknown field",
+			method:     http.MethodPost,
+			target:     "/v1/user/register",
+			body:       `{"name": "Alice", "email": "alice@example.com", "password": "pa55word", "admin": true}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"/body"},
+		},
+		{
+			name:       "invalid query parameter",
+			method:     http.MethodPost,
+			target:     "/v1/user/register?mode=session",
+			body:       `{"name": "Alice", "email": "alice@example.com", "password": "pa55word"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"/query/mode"},
+		},
+		{
+			name:       "empty body",
+			method:     http.MethodPost,
+			target:     "/v1/user/register",
+			wantStatus: http.StatusBadRequest,
+			wantError:  "body must not be empty",
+		},
+		{
+			name:       "badly-formed body",
+			method:     http.MethodPost,
+			target:     "/v1/user/register",
+			body:       `{"name": "Alice",`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "body contains badly-formed JSON",
+		},
+		{
+			name:        "not JSON",
+			method:      http.MethodPost,
+			target:      "/v1/user/register",
+			contentType: "text/plain",
+			body:        `name=Alice`,
+			wantStatus:  http.StatusBadRequest,
+			wantError:   "body must be JSON",
+		},
+		{
+			name:       "negative points",
+			method:     http.MethodPut,
+			target:     "/v1/user/point",
+			body:       `{"points": -5}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"/body/points"},
+		},
+		{
+			name:       "array items",
+			method:     http.MethodPost,
+			target:     "/v1/admin/merchant/abc/key",
+			body:       `{"scopes": ["vouchers:use", "vouchers:delete"]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"/body/scopes/1"},
+		},
+		{
+			name:       "valid query",
+			method:     http.MethodGet,
+			target:     "/v1/voucher?page_size=50&sort=-expires&active=true",
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "invalid query",
+			method:     http.MethodGet,
+			target:     "/v1/voucher?page_size=abc&sort=price&starts=yesterday",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"/query/page_size", "/query/sort", "/query/starts"},
+		},
+		{
+			name:       "query out of range",
+			method:     http.MethodGet,
+			target:     "/v1/voucher?page_size=1000",
+			wantStatus: http.StatusUnprocessableEntity,
+			wantFields: []string{"/query/page_size"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("got status %d; want %d: %s", rr.Code, tt.wantStatus, rr.Body)
+			}
+			if rr.Code == http.StatusNoContent {
+				return
+			}
+
+			var body struct {
+				Error json.RawMessage `json:"error"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantFields != nil {
+				var errs map[string]string
+				if err := json.Unmarshal(body.Error, &errs); err != nil {
+					t.Fatal(err)
+				}
+				var fields []string
+				for field := range errs {
+					fields = append(fields, field)
+				}
+				sort.Strings(fields)
+				if !reflect.DeepEqual(fields, tt.wantFields) {
+					t.Errorf("got errors %v; want errors for %v", errs, tt.wantFields)
+				}
+			}
+			if tt.wantError != "" {
+				var message string
+				if err := json.Unmarshal(body.Error, &message); err != nil {
+					t.Fatal(err)
+				}
+				if message != tt.wantError {
+					t.Errorf("got error %q; want %q", message, tt.wantError)
+				}
+			}
+		})
+	}
+}
+
+// TestValidateRequestAfterAuthentication checks that requests to the authenticated and merchant
+// routes are only validated once they have been authenticated, so that anonymous callers get a
+// 401.
+func TestValidateRequestAfterAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+
+	for _, target := range []string{"/v1/user/point", "/v1/merchant/user/abc/point"} {
+		r := httptest.NewRequest(http.MethodPut, target, strings.NewReader(`{"points": "many"}`))
+		rr := httptest.NewRecorder()
+		app.Routes().ServeHTTP(rr, r)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d; want %d", target, rr.Code, http.StatusUnauthorized)
+		}
+	}
+}
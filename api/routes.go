@@ -4,37 +4,104 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/swaggest/swgui/v5emb"
+	"github.com/toduluz/savingsquadsbackend/internal/data"
 )
 
 // routes is our main Application's router.
 func (app *Application) Routes() http.Handler {
 	router := mux.NewRouter()
+	router.Use(app.traceRequest)
+	router.Use(app.logRequest)
+	router.Use(app.recordMetrics)
 	router.Use(app.recoverPanic)
 	router.Use(app.enableCORS)
 
-	router.NotFoundHandler = http.HandlerFunc(app.notFoundResponse)
-	router.MethodNotAllowedHandler = http.HandlerFunc(app.methodNotAllowedResponse)
+	// The router doesn't run its middleware for requests which match no route, so these are
+	// wrapped to trace, log and count them.
+	router.NotFoundHandler = app.traceRequest(app.logRequest(app.recordMetrics(http.HandlerFunc(app.notFoundResponse))))
+	router.MethodNotAllowedHandler = app.traceRequest(app.logRequest(app.recordMetrics(http.HandlerFunc(app.methodNotAllowedResponse))))
 
-	// Public routes
+	router.HandleFunc("/.well-known/jwks.json", app.jwksHandler).Methods(http.MethodGet)
+
+	// Health checks for orchestrators and load balancers.
+	router.HandleFunc("/healthz", app.livenessHandler).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", app.readinessHandler).Methods(http.MethodGet)
+	router.HandleFunc("/v1/healthcheck", app.healthcheckHandler).Methods(http.MethodGet)
+
+	// API documentation, rendered by the Swagger UI from the OpenAPI document.
+	router.HandleFunc("/v1/openapi.json", app.openAPIHandler).Methods(http.MethodGet)
+	router.PathPrefix("/v1/docs/").Handler(v5emb.New("SavingSquads API", "/v1/openapi.json", "/v1/docs/"))
+
+	// Public routes. The requests to these and to the merchant and authenticated routes are
+	// validated against the OpenAPI document once the caller has been required to authenticate,
+	// so that anonymous callers of the merchant and authenticated routes get a 401 rather than a
+	// 422 which describes the schema.
 	publicRouter := router.PathPrefix("/v1/user").Subrouter()
+	publicRouter.Use(app.validateRequest)
+	publicRouter.HandleFunc("/csrf", app.csrfTokenHandler).Methods(http.MethodGet)
 	publicRouter.HandleFunc("/register", app.registerUserHandler).Methods(http.MethodPost)
 	publicRouter.HandleFunc("/login", app.loginUserHandler).Methods(http.MethodPost)
+	publicRouter.HandleFunc("/login/mfa", app.verifyMFALoginHandler).Methods(http.MethodPost)
+	publicRouter.HandleFunc("/oidc/{provider}/login", app.oidcLoginHandler).Methods(http.MethodGet)
+	publicRouter.HandleFunc("/oidc/{provider}/callback", app.oidcCallbackHandler).Methods(http.MethodGet)
+
+	// Merchant routes, authenticated with an API key which must have the required scope.
+	merchantRouter := router.PathPrefix("/v1/merchant").Subrouter()
+	merchantRouter.Use(app.authenticate)
+	merchantRouter.Use(app.requireAPIKey)
+	merchantRouter.Use(app.validateRequest)
+	merchantRouter.HandleFunc("/voucher/{id}", app.requireScope(data.ScopeVouchersValidate, app.validateMerchantVoucherHandler)).Methods(http.MethodGet)
+	merchantRouter.HandleFunc("/voucher/{id}/use", app.requireScope(data.ScopeVouchersUse, app.useMerchantVoucherHandler)).Methods(http.MethodPut)
+	merchantRouter.HandleFunc("/user/{id}/point", app.requireScope(data.ScopePointsEarn, app.earnMerchantPointsHandler)).Methods(http.MethodPut)
 
 	// Authenticated routes
 	authRouter := router.PathPrefix("/v1").Subrouter()
 	authRouter.Use(app.authenticate)
 	authRouter.Use(app.requireAuthenticatedUser)
+	authRouter.Use(app.requireCSRFToken)
+	authRouter.Use(app.validateRequest)
 
-	// Admin routes
+	// Admin routes, which need the admin role. Admins are created with the admin command.
 	adminRouter := authRouter.PathPrefix("/voucher").Subrouter()
+	adminRouter.Use(app.requireRole(data.RoleAdmin))
 	adminRouter.HandleFunc("", app.listVouchersHandler).Methods(http.MethodGet)
 	adminRouter.HandleFunc("", app.createVoucherHandler).Methods(http.MethodPost)
 	adminRouter.HandleFunc("/{id}", app.showVoucherHandler).Methods(http.MethodGet)
 	adminRouter.HandleFunc("/{id}", app.deleteVoucherHandler).Methods(http.MethodDelete)
 
+	// Unlocking accounts needs the admin role, which is granted with the admin command.
+	adminUserRouter := authRouter.PathPrefix("/admin/user").Subrouter()
+	adminUserRouter.Use(app.requireRole(data.RoleAdmin))
+	adminUserRouter.HandleFunc("/{id}/unlock", app.unlockUserHandler).Methods(http.MethodPut)
+
+	adminLogRouter := authRouter.PathPrefix("/admin/log-level").Subrouter()
+	adminLogRouter.Use(app.requireRole(data.RoleAdmin))
+	adminLogRouter.HandleFunc("", app.showLogLevelHandler).Methods(http.MethodGet)
+	adminLogRouter.HandleFunc("", app.updateLogLevelHandler).Methods(http.MethodPut)
+
+	// Merchants and their API keys can award points to any user, so managing them needs the admin
+	// role too.
+	adminMerchantRouter := authRouter.PathPrefix("/admin/merchant").Subrouter()
+	adminMerchantRouter.Use(app.requireRole(data.RoleAdmin))
+	adminMerchantRouter.HandleFunc("", app.listMerchantsHandler).Methods(http.MethodGet)
+	adminMerchantRouter.HandleFunc("", app.createMerchantHandler).Methods(http.MethodPost)
+	adminMerchantRouter.HandleFunc("/{id}/key", app.listAPIKeysHandler).Methods(http.MethodGet)
+	adminMerchantRouter.HandleFunc("/{id}/key", app.createAPIKeyHandler).Methods(http.MethodPost)
+	adminMerchantRouter.HandleFunc("/{id}/key/{key}/rotate", app.rotateAPIKeyHandler).Methods(http.MethodPost)
+	adminMerchantRouter.HandleFunc("/{id}/key/{key}", app.revokeAPIKeyHandler).Methods(http.MethodDelete)
+
 	// User routes
 	userRouter := authRouter.PathPrefix("/user").Subrouter()
 	userRouter.HandleFunc("/logout", app.logoutUserHandler).Methods(http.MethodPost)
+	userRouter.HandleFunc("/me", app.deleteUserHandler).Methods(http.MethodDelete)
+	userRouter.HandleFunc("/me/deletion", app.cancelDeletionHandler).Methods(http.MethodDelete)
+	userRouter.HandleFunc("/me/export", app.exportUserHandler).Methods(http.MethodGet)
+	userRouter.HandleFunc("/sessions", app.listSessionsHandler).Methods(http.MethodGet)
+	userRouter.HandleFunc("/sessions/{id}", app.revokeSessionHandler).Methods(http.MethodDelete)
+	userRouter.HandleFunc("/mfa/enrol", app.enrolMFAHandler).Methods(http.MethodPost)
+	userRouter.HandleFunc("/mfa/confirm", app.confirmMFAHandler).Methods(http.MethodPost)
+	userRouter.HandleFunc("/mfa/disable", app.disableMFAHandler).Methods(http.MethodPost)
 	userRouter.HandleFunc("/voucher", app.getUserVouchersHandler).Methods(http.MethodGet)
 	userRouter.HandleFunc("/voucher/{id}/redeem", app.redeemUserVoucherHandler).Methods(http.MethodPut)
 	userRouter.HandleFunc("/voucher/{id}/use", app.useUserVoucherHandler).Methods(http.MethodPut)
@@ -5,15 +5,21 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/toduluz/savingsquadsbackend/internal/data"
 	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
+	"github.com/toduluz/savingsquadsbackend/internal/jwks"
+	"github.com/toduluz/savingsquadsbackend/internal/metrics"
+	"github.com/toduluz/savingsquadsbackend/internal/oidc"
 )
 
 // Define an application struct to hold dependencies for our HTTP handlers, helpers, and
@@ -22,7 +28,27 @@ type Application struct {
 	Config Config
 	Logger *jsonlog.Logger
 	Models data.Models
-	Wg     sync.WaitGroup
+	Keys   *jwks.KeySet
+	// Providers holds the OpenID Connect providers from Config.Oidc, keyed by name.
+	Providers map[string]*oidc.Provider
+	// Metrics collects the request and business metrics, which are served on the metrics port.
+	Metrics *metrics.Metrics
+	// HealthChecks holds the checks of the dependencies, such as the database, which must pass
+	// for the server to be ready to serve requests, keyed by name.
+	HealthChecks map[string]func(context.Context) error
+	// Closers release the dependencies, such as the database connection and the trace
+	// exporter, once the server has stopped and the background work has finished.
+	Closers Closers
+	// Wg tracks the tasks started with background, which the server waits for when it shuts
+	// down.
+	Wg sync.WaitGroup
+
+	// shuttingDown is set as soon as a shutdown signal is received.
+	shuttingDown atomic.Bool
+	// tasks counts the running background tasks by name, to report those which are abandoned
+	// at shutdown.
+	tasksMu sync.Mutex
+	tasks   map[string]int
 }
 
 func (app *Application) Serve() error {
@@ -36,9 +62,78 @@ func (app *Application) Serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	tlsConfig, err := app.tlsConfig()
+	if err != nil {
+		return err
+	}
+	srv.TLSConfig = tlsConfig
+
+	// Redirect plain HTTP to HTTPS, for clients which were given an http:// URL.
+	var redirectSrv *http.Server
+	if tlsConfig != nil && app.Config.TLS.RedirectPort != 0 {
+		redirectSrv = &http.Server{
+			Addr:         fmt.Sprintf(":%d", app.Config.TLS.RedirectPort),
+			Handler:      app.redirectToHTTPS(),
+			ErrorLog:     log.New(app.Logger, "", 0),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+
+		ln, err := net.Listen("tcp", redirectSrv.Addr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			err := redirectSrv.Serve(ln)
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.Logger.PrintError(err, nil)
+			}
+		}()
+		app.Logger.PrintInfo("starting HTTP to HTTPS redirect server", map[string]string{
+			"addr": redirectSrv.Addr,
+		})
+	}
+
+	// Serve the metrics on their own port. Listening here rather than in the goroutine makes a
+	// port which is already in use fail the startup.
+	var metricsSrv *http.Server
+	if app.Config.Metrics.Port != 0 {
+		handler := http.NewServeMux()
+		handler.Handle("/metrics", app.Metrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:         fmt.Sprintf(":%d", app.Config.Metrics.Port),
+			Handler:      handler,
+			ErrorLog:     log.New(app.Logger, "", 0),
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+
+		ln, err := net.Listen("tcp", metricsSrv.Addr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			err := metricsSrv.Serve(ln)
+			if !errors.Is(err, http.ErrServerClosed) {
+				app.Logger.PrintError(err, nil)
+			}
+		}()
+		app.Logger.PrintInfo("starting metrics server", map[string]string{
+			"addr": metricsSrv.Addr,
+		})
+	}
+
 	// Create a shutdownError channel. We will use this to receive any errors returned
 	// by the graceful Shutdown() function.
 	shutdownError := make(chan error)
+
+	// Start the background job which deletes accounts once their cooling-off period has
+	// passed. It is stopped when the server shuts down.
+	stopJobs := make(chan struct{})
+	app.background("account deletions", func() {
+		app.runAccountDeletions(stopJobs)
+	})
+
 	go func() {
 		// Intercept the signals, as before.
 		quit := make(chan os.Signal, 1)
@@ -49,25 +144,33 @@ func (app *Application) Serve() error {
 
 			"signal": s.String(),
 		})
-		// Create a context with a 20-second timeout.
-		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		// Fail the readiness check and give load balancers time to notice, while still
+		// serving the requests they send in the meantime.
+		app.shuttingDown.Store(true)
+		time.Sleep(app.Config.Shutdown.DrainDelay)
+		// Create a context with the shutdown timeout, which bounds both the requests in
+		// flight and the background work, and relay the outcome of the shutdown to the
+		// shutdownError channel.
+		ctx, cancel := context.WithTimeout(context.Background(), app.Config.Shutdown.Timeout)
 		defer cancel()
-		// Call Shutdown() on our server, passing in the context we just made.
-		// Shutdown() will return nil if the graceful shutdown was successful, or an
-		// error (which may happen because of a problem closing the listeners, or
-		// because the shutdown didn't complete before the 20-second context deadline is
-		// hit). We relay this return value to the shutdownError channel.
-		shutdownError <- srv.Shutdown(ctx)
+		shutdownError <- app.shutdown(ctx, stopJobs, srv, redirectSrv, metricsSrv)
 	}()
 	app.Logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
 		"env":  app.Config.Env,
+		"tls":  strconv.FormatBool(srv.TLSConfig != nil),
 	})
 	// Calling Shutdown() on our server will cause ListenAndServe() to immediately
 	// return a http.ErrServerClosed error. So if we see this error, it is actually a
 	// good thing and an indication that the graceful shutdown has started. So we check
 	// specifically for this, only returning the error if it is NOT http.ErrServerClosed.
-	err := srv.ListenAndServe()
+	// With TLS, the certificate comes from the TLS configuration rather than from files, and
+	// HTTP/2 is negotiated automatically.
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
+)
+
+// listSessionsHandler handles the "GET /v1/user/sessions" endpoint. It lists the devices the user
+// is logged in on, marking the one making the request as current.
+func (app *Application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.Models.Sessions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if current := app.contextGetSession(r); current != nil {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == current.ID
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeSessionHandler handles the "DELETE /v1/user/sessions/{id}" endpoint. The device loses
+// access on its next request.
+func (app *Application) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.Models.Sessions.Delete(r.Context(), user.ID, app.readIDParam(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateDeviceName checks the optional name which the client gives the device it logs in on.
+func validateDeviceName(v *validator.Validator, deviceName string) {
+	v.Check(len(deviceName) <= 100, "device_name", "must not be more than 100 bytes long")
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
+)
+
+// closeTimeout bounds closing the dependencies at shutdown. It is separate from the shutdown
+// timeout, so that the traces are flushed and the database closed even when the background work
+// used up all of that.
+const closeTimeout = 5 * time.Second
+
+// Closer releases a dependency of the application, such as the database connection or the trace
+// exporter, when the server shuts down.
+type Closer struct {
+	Name  string
+	Close func(context.Context) error
+}
+
+// Closers are closed in reverse order, like deferred calls, so that each dependency is closed
+// before the ones which were set up before it: the database before the tracer provider which
+// records its commands, for example.
+type Closers []Closer
+
+// Close closes every dependency, carrying on past the ones which fail, and returns their errors.
+func (c Closers) Close(ctx context.Context) error {
+	var errs []error
+	for i := len(c) - 1; i >= 0; i-- {
+		if err := c[i].Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s: %w", c[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// shutdown stops the servers and the background work, and then closes the dependencies of the
+// application. The API server stops first, waiting for the requests in flight, since those may
+// start background tasks. Then the scheduled jobs are stopped through stopJobs, and the
+// background tasks are given until ctx is done to finish; those which don't are abandoned and
+// reported. The metrics server stops last, so that the shutdown itself is still scraped. The
+// redirect and metrics servers may be nil.
+func (app *Application) shutdown(ctx context.Context, stopJobs chan<- struct{}, srv, redirectSrv, metricsSrv *http.Server) error {
+	var errs []error
+
+	// Shutdown() returns an error if closing the listeners failed, or if the requests in flight
+	// didn't finish before the deadline.
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if redirectSrv != nil {
+		if err := redirectSrv.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	close(stopJobs)
+	if abandoned := app.waitBackground(ctx); len(abandoned) > 0 {
+		total := 0
+		for _, n := range abandoned {
+			total += n
+		}
+		app.Logger.Warn("abandoned background tasks", jsonlog.Any("tasks", abandoned))
+		errs = append(errs, fmt.Errorf("%d background tasks abandoned", total))
+	}
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	if err := app.Closers.Close(closeCtx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(closeCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// waitBackground waits for the background tasks to finish until ctx is done. It returns the
+// number of tasks still running by name, which is empty if they all finished.
+func (app *Application) waitBackground(ctx context.Context) map[string]int {
+	done := make(chan struct{})
+	go func() {
+		app.Wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	app.tasksMu.Lock()
+	defer app.tasksMu.Unlock()
+	running := make(map[string]int, len(app.tasks))
+	for name, n := range app.tasks {
+		running[name] = n
+	}
+	return running
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClosersClose(t *testing.T) {
+	t.Parallel()
+
+	var closed []string
+	closer := func(name string, err error) Closer {
+		return Closer{Name: name, Close: func(context.Context) error {
+			closed = append(closed, name)
+			return err
+		}}
+	}
+	errDisconnect := errors.New("disconnect failed")
+
+	closers := Closers{
+		closer("tracing", nil),
+		closer("mongo", errDisconnect),
+		closer("cache", nil),
+	}
+	err := closers.Close(context.Background())
+
+	if want := []string{"cache", "mongo", "tracing"}; !reflect.DeepEqual(closed, want) {
+		t.Errorf("closed %v, want %v", closed, want)
+	}
+	if !errors.Is(err, errDisconnect) || !strings.Contains(err.Error(), "closing mongo") {
+		t.Errorf("got error %v, want the mongo error", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		blockTask     bool
+		wantAbandoned bool
+	}{
+		{name: "finished tasks"},
+		{name: "abandoned tasks", blockTask: true, wantAbandoned: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			var closed bool
+			app.Closers = Closers{{Name: "database", Close: func(context.Context) error {
+				closed = true
+				return nil
+			}}}
+
+			// The scheduled job stops when stopJobs is closed, while the email task only
+			// finishes when it is released.
+			stopJobs := make(chan struct{})
+			app.background("scheduler", func() {
+				<-stopJobs
+			})
+			release := make(chan struct{})
+			defer close(release)
+			app.background("send email", func() {
+				if tt.blockTask {
+					<-release
+				}
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			err := app.shutdown(ctx, stopJobs, &http.Server{}, nil, nil)
+
+			if tt.wantAbandoned {
+				if err == nil || !strings.Contains(err.Error(), "1 background tasks abandoned") {
+					t.Errorf("got error %v, want the abandoned task reported", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !closed {
+				t.Error("the database wasn't closed")
+			}
+		})
+	}
+}
+
+func TestWaitBackground(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApplication(t)
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		app.background("send email", func() { <-release })
+	}
+	app.background("touch session", func() {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	running := app.waitBackground(ctx)
+	if want := map[string]int{"send email": 2}; !reflect.DeepEqual(running, want) {
+		t.Errorf("got running tasks %v, want %v", running, want)
+	}
+
+	close(release)
+	if running := app.waitBackground(context.Background()); len(running) != 0 {
+		t.Errorf("got running tasks %v after they finished", running)
+	}
+}
@@ -1,19 +1,31 @@
 package api
 
 import (
+	"io"
 	"testing"
 
 	"github.com/toduluz/savingsquadsbackend/internal/data"
+	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
+	"github.com/toduluz/savingsquadsbackend/internal/jwks"
 )
 
 func newTestApplication(t *testing.T) *Application {
 	t.Helper()
 
 	var cfg Config
-	cfg.Jwt.Secret = "secret"
+	cfg.Cookie.Keys = [][]byte{[]byte("0123456789abcdef0123456789abcdef")}
+	cfg.Jwt.Issuer = "savingsquads"
+	cfg.Jwt.Audience = "savingsquads"
+
+	keys, err := jwks.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	return &Application{
 		Config: cfg,
+		Logger: jsonlog.NewLogger(io.Discard, jsonlog.LevelOff),
 		Models: data.NewMockModels(),
+		Keys:   keys,
 	}
 }
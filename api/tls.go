@@ -0,0 +1,78 @@
+package api
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/toduluz/savingsquadsbackend/internal/certs"
+)
+
+// tlsConfig returns the TLS configuration of the API server, or nil if it serves plain HTTP.
+// Only TLS 1.2 and 1.3 are accepted, and TLS 1.2 is limited to forward secret AEAD cipher
+// suites; the TLS 1.3 suites aren't configurable and are all modern.
+func (app *Application) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+
+	switch {
+	case app.Config.TLS.CertFile != "":
+		reloader, err := certs.NewReloader(app.Config.TLS.CertFile, app.Config.TLS.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		reloader.OnError = func(err error) {
+			app.Logger.PrintError(err, map[string]string{"cert_file": app.Config.TLS.CertFile})
+		}
+		cfg.GetCertificate = reloader.GetCertificate
+	case app.Config.TLS.SelfSigned:
+		cert, err := certs.SelfSigned("localhost", "127.0.0.1", "::1")
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+		app.Logger.PrintInfo("generated a self-signed TLS certificate", nil)
+	default:
+		return nil, nil
+	}
+
+	return cfg, nil
+}
+
+// redirectToHTTPS redirects every request to the same URL on the HTTPS port of the API server.
+// GET and HEAD requests are redirected with 301 Moved Permanently, and other requests with 308
+// Permanent Redirect, so that clients repeat them with the same method and body.
+func (app *Application) redirectToHTTPS() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		switch {
+		case app.Config.Port != 443:
+			host = net.JoinHostPort(host, strconv.Itoa(app.Config.Port))
+		case strings.Contains(host, ":"):
+			host = "[" + host + "]"
+		}
+
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	app := newTestApplication(t)
+
+	cfg, err := app.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != nil {
+		t.Fatal("got a TLS configuration without a certificate")
+	}
+
+	app.Config.TLS.SelfSigned = true
+	cfg, err = app.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ts.TLS = cfg
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cfg.Certificates[0].Leaf)
+
+	tests := []struct {
+		name       string
+		maxVersion uint16
+		wantErr    bool
+	}{
+		{name: "TLS 1.3", maxVersion: tls.VersionTLS13},
+		{name: "TLS 1.2", maxVersion: tls.VersionTLS12},
+		{name: "TLS 1.1", maxVersion: tls.VersionTLS11, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS10, MaxVersion: tt.maxVersion},
+				ForceAttemptHTTP2: true,
+			}}
+
+			res, err := client.Get(ts.URL)
+			if tt.wantErr {
+				if err == nil {
+					res.Body.Close()
+					t.Fatal("expected the handshake to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.ProtoMajor != 2 {
+				t.Errorf("got protocol %s, want HTTP/2", res.Proto)
+			}
+			if res.TLS.Version != tt.maxVersion {
+				t.Errorf("got TLS version %x, want %x", res.TLS.Version, tt.maxVersion)
+			}
+		})
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		port         int
+		method       string
+		host         string
+		target       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{
+			name:         "GET",
+			port:         4000,
+			method:       http.MethodGet,
+			host:         "example.com:8080",
+			target:       "/v1/healthcheck?verbose=1",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://example.com:4000/v1/healthcheck?verbose=1",
+		},
+		{
+			name:         "POST",
+			port:         4000,
+			method:       http.MethodPost,
+			host:         "example.com",
+			target:       "/v1/user/login",
+			wantStatus:   http.StatusPermanentRedirect,
+			wantLocation: "https://example.com:4000/v1/user/login",
+		},
+		{
+			name:         "default port",
+			port:         443,
+			method:       http.MethodGet,
+			host:         "example.com:80",
+			target:       "/",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://example.com/",
+		},
+		{
+			name:         "IPv6",
+			port:         443,
+			method:       http.MethodGet,
+			host:         "[::1]:80",
+			target:       "/",
+			wantStatus:   http.StatusMovedPermanently,
+			wantLocation: "https://[::1]/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.Config.Port = tt.port
+
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Host = tt.host
+			rr := httptest.NewRecorder()
+			app.redirectToHTTPS().ServeHTTP(rr, r)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rr.Code, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("got location %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
@@ -2,29 +2,48 @@ package api
 
 import (
 	"errors"
+	"net/http"
 	"time"
 
 	"github.com/pascaldekloe/jwt" //
 	"github.com/toduluz/savingsquadsbackend/internal/data"
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
 )
 
-func (app *Application) createJWTClaims(user *data.User) ([]byte, error) {
+// sessionDuration is how long a session JWT, and the cookie holding it, is valid for.
+const sessionDuration = 24 * time.Hour
+
+// mfaChallengeDuration is how long the user has to enter a code after passing the password step
+// of login.
+const mfaChallengeDuration = 5 * time.Minute
+
+// Session modes accepted in the "mode" query string parameter of the login endpoints. The session
+// JWT is signed with app.Keys in both. In cookie mode it is set as the encrypted "jwt" cookie,
+// while in token mode it is returned in the JSON response body for clients such as native mobile
+// apps and scripts, which then send it in an "Authorization: Bearer <jwt>" header.
+const (
+	sessionModeCookie = "cookie"
+	sessionModeToken  = "token"
+)
+
+func (app *Application) createJWTClaims(user *data.User, sessionID string) ([]byte, error) {
 	// Create a JWT claims struct containing the user ID as the subject, with an issued
 	// time of now and validity window of the next 24 hours. We also set the issuer and
-	// audience to a unique identifier for our Application.
+	// audience to a unique identifier for our Application, and the ID of the session which
+	// the token belongs to, so that it can be revoked.
 	var claims jwt.Claims
 	claims.Subject = user.ID
 	claims.Issued = jwt.NewNumericTime(time.Now())
 	claims.NotBefore = jwt.NewNumericTime(time.Now())
-	claims.Expires = jwt.NewNumericTime(time.Now().Add(24 * time.Hour))
-	// claims.Issuer = "greenlight.alexedwards.net"
-	// claims.Audiences = []string{"greenlight.alexedwards.net"}
-	claims.Set = map[string]interface{}{"version": user.Version}
+	claims.Expires = jwt.NewNumericTime(time.Now().Add(sessionDuration))
+	claims.Issuer = app.Config.Jwt.Issuer
+	claims.Audiences = []string{app.Config.Jwt.Audience}
+	claims.Set = map[string]interface{}{"version": user.Version, "sid": sessionID}
 
-	// Sign the JWT claims using the HMAC-SHA256 algorithm and the secret key from the
-	// Application Config. This returns a []byte slice containing the JWT as a base64-
-	// encoded string.
-	jwtBytes, err := claims.HMACSign(jwt.HS256, []byte(app.Config.Jwt.Secret))
+	// Sign the JWT claims with the current signing key from the key set. This returns a
+	// []byte slice containing the JWT as a base64-encoded string, with the ID of the key in
+	// the "kid" header so that verifiers know which key to check it against.
+	jwtBytes, err := app.Keys.Sign(&claims)
 	if err != nil {
 		return nil, err
 	}
@@ -33,9 +52,10 @@ func (app *Application) createJWTClaims(user *data.User) ([]byte, error) {
 
 func (app *Application) validateJWTClaims(token string) (*jwt.Claims, error) {
 	// Parse the JWT and extract the claims. This will return an error if the JWT
-	// contents doesn't match the signature (i.e. the token has been tampered with)
-	// or the algorithm isn't valid.
-	claims, err := jwt.HMACCheck([]byte(token), []byte(app.Config.Jwt.Secret))
+	// contents doesn't match the signature of any key in the key set (i.e. the token has
+	// been tampered with or was signed with a key that has since been removed) or the
+	// algorithm isn't valid.
+	claims, err := app.Keys.Check([]byte(token))
 	if err != nil {
 		return nil, err
 	}
@@ -43,5 +63,130 @@ func (app *Application) validateJWTClaims(token string) (*jwt.Claims, error) {
 	if !claims.Valid(time.Now()) {
 		return nil, errors.New("token has expired")
 	}
+	// Check that the issuer is our Application and that our Application is in the expected
+	// audiences for the JWT.
+	if claims.Issuer != app.Config.Jwt.Issuer {
+		return nil, errors.New("token has an unexpected issuer")
+	}
+	if !claims.AcceptAudience(app.Config.Jwt.Audience) {
+		return nil, errors.New("token has an unexpected audience")
+	}
+	return claims, nil
+}
+
+// createMFAChallengeToken returns a short-lived JWT which proves that the user has passed the
+// password step of login. It can only be exchanged for a session by verifyMFALoginHandler and is
+// rejected by the authenticate middleware.
+func (app *Application) createMFAChallengeToken(user *data.User) ([]byte, error) {
+	var claims jwt.Claims
+	claims.Subject = user.ID
+	claims.Issued = jwt.NewNumericTime(time.Now())
+	claims.NotBefore = jwt.NewNumericTime(time.Now())
+	claims.Expires = jwt.NewNumericTime(time.Now().Add(mfaChallengeDuration))
+	claims.Issuer = app.Config.Jwt.Issuer
+	claims.Audiences = []string{app.Config.Jwt.Audience}
+	claims.Set = map[string]interface{}{"mfa_challenge": true}
+
+	jwtBytes, err := app.Keys.Sign(&claims)
+	if err != nil {
+		return nil, err
+	}
+	return jwtBytes, nil
+}
+
+// validateMFAChallengeToken parses a token created by createMFAChallengeToken, returning an
+// error if it is invalid, expired or a regular session token.
+func (app *Application) validateMFAChallengeToken(token string) (*jwt.Claims, error) {
+	claims, err := app.validateJWTClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	if !isMFAChallenge(claims) {
+		return nil, errors.New("not an mfa challenge token")
+	}
 	return claims, nil
 }
+
+// isMFAChallenge reports whether the claims belong to an MFA challenge token.
+func isMFAChallenge(claims *jwt.Claims) bool {
+	challenge, _ := claims.Set["mfa_challenge"].(bool)
+	return challenge
+}
+
+// readSessionMode reads the session mode from the "mode" query string parameter, defaulting to
+// cookie mode, and records an error in the validator if it isn't a known mode.
+func (app *Application) readSessionMode(r *http.Request, v *validator.Validator) string {
+	mode := app.readStrings(r.URL.Query(), "mode", sessionModeCookie)
+	v.Check(validator.In(mode, sessionModeCookie, sessionModeToken), "mode", "must be either cookie or token")
+	return mode
+}
+
+// startSession creates a session record for the device making the request and a session JWT
+// for it. In cookie mode the JWT is set as the "jwt" cookie, otherwise it is added to the
+// envelope under the "authentication_token" key.
+func (app *Application) startSession(w http.ResponseWriter, r *http.Request, user *data.User, mode, deviceName string, env envelope) error {
+	userAgent := r.UserAgent()
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+	if deviceName == "" {
+		deviceName = userAgent
+	}
+
+	now := time.Now()
+	session := &data.Session{
+		UserID:     user.ID,
+		DeviceName: deviceName,
+		UserAgent:  userAgent,
+		IP:         clientIP(r),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(sessionDuration),
+	}
+	id, err := app.Models.Sessions.Insert(r.Context(), session)
+	if err != nil {
+		return err
+	}
+
+	jwtBytes, err := app.createJWTClaims(user, id)
+	if err != nil {
+		return err
+	}
+
+	if mode == sessionModeToken {
+		env["authentication_token"] = envelope{
+			"token":      string(jwtBytes),
+			"token_type": "Bearer",
+			"expires_in": int(sessionDuration.Seconds()),
+		}
+		return nil
+	}
+
+	return app.setCookie(w, "jwt", string(jwtBytes), int(sessionDuration.Seconds()))
+}
+
+// sessionID returns the ID of the session which the claims of a session JWT belong to.
+func sessionID(claims *jwt.Claims) string {
+	id, _ := claims.String("sid")
+	return id
+}
+
+// jwksHandler handles the "GET /.well-known/jwks.json" endpoint. It publishes the public keys
+// which tokens are verified with, so that other services can verify them too.
+func (app *Application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.Keys.JWKs()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Allow verifiers to cache the key set for a few minutes. Keys are added well before they
+	// are used for signing, so a cached copy is never missing the current signing key.
+	headers := make(http.Header)
+	headers.Set("Cache-Control", "public, max-age=300")
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"keys": keys}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/toduluz/savingsquadsbackend/internal/data"
@@ -12,9 +14,10 @@ import (
 func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	// Create an anonymous struct to hold the expected data from the request body.
 	var input struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Name       string `json:"name"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		DeviceName string `json:"device_name"`
 	}
 
 	// Parse the request body into the anonymous struct
@@ -41,14 +44,18 @@ func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Use the Password.Set() method to generate and store the hashed and plaintext
-	// passwords.
+	// passwords. Hashing is slow on purpose, so it gets a span of its own.
+	_, span := tracer.Start(r.Context(), "Password.Set")
 	err = user.Password.Set(input.Password)
+	span.End()
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	v := validator.New()
+	mode := app.readSessionMode(r, v)
+	validateDeviceName(v, input.DeviceName)
 
 	// Validate the user struct and return the error messages to the client if
 	// any of the checks fail.
@@ -58,7 +65,7 @@ func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Insert the user data into the database.
-	id, err := app.Models.Users.Insert(user)
+	id, err := app.Models.Users.Insert(r.Context(), user)
 	if err != nil {
 		switch {
 		// If we get an ErrDuplicateEmail error, use the v.AddError() method to manually add
@@ -73,14 +80,10 @@ func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 	user.ID = id
+	app.Metrics.UserRegistered("password")
 
-	jwtBytes, err := app.createJWTClaims(user)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	err = app.setCookie(w, "jwt", string(jwtBytes), 3600*24)
+	env := envelope{"user": user}
+	err = app.startSession(w, r, user, mode, input.DeviceName, env)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -89,7 +92,7 @@ func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	// Note that we also change this to send the client a 202 Accepted status code which
 	// indicates that the request has been accepted for processing, but the processing has
 	// not been completed.
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -97,8 +100,9 @@ func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 
 func (app *Application) loginUserHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		DeviceName string `json:"device_name"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -108,50 +112,90 @@ func (app *Application) loginUserHandler(w http.ResponseWriter, r *http.Request)
 	v := validator.New()
 	data.ValidateEmail(v, input.Email)
 	data.ValidatePasswordPlaintext(v, input.Password)
+	mode := app.readSessionMode(r, v)
+	validateDeviceName(v, input.DeviceName)
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	user, err := app.Models.Users.GetByEmail(input.Email)
+	user, err := app.Models.Users.GetByEmail(r.Context(), input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			// Still run a bcrypt comparison so that the response timing doesn't reveal
+			// whether an account exists for the email.
+			data.SimulateMatches(input.Password)
 			app.invalidCredentialsResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
+	// Refuse to check the password at all while the account is locked. The response is the
+	// same as for an unknown email, including the bcrypt work, so that neither its status nor
+	// its timing reveals which emails are registered.
+	if user.IsLocked(time.Now()) {
+		data.SimulateMatches(input.Password)
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+	_, span := tracer.Start(r.Context(), "Password.Matches")
 	match, err := user.Password.Matches(input.Password)
+	span.End()
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 	if !match {
+		// The failure which locks the account gets the same response as any other, for the
+		// same reason.
+		_, err := app.registerFailedLogin(r.Context(), user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
-
-	jwtBytes, err := app.createJWTClaims(user)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
+	// If two-factor authentication is enabled, don't set the session cookie yet. Instead issue
+	// a short-lived challenge token which must be exchanged along with a valid code at
+	// "POST /v1/user/login/mfa". The failed login counter is deliberately left alone until
+	// then, so that codes can't be guessed indefinitely.
+	if user.MFA.Enabled {
+		app.mfaChallengeResponse(w, r, user, mode)
 		return
 	}
+	// Reset the failed login counter now that the user has proven their identity.
+	if user.FailedLogins > 0 {
+		err = app.Models.Users.ResetFailedLogins(r.Context(), user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
 
-	err = app.setCookie(w, "jwt", string(jwtBytes), 3600*24)
+	env := envelope{"message": "successfully logged in"}
+	err = app.startSession(w, r, user, mode, input.DeviceName, env)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Convert the []byte slice to a string and return it in a JSON response.
-	err = app.writeJSON(w, http.StatusCreated, envelope{"message": "successfully logged in"}, nil)
+	err = app.writeJSON(w, http.StatusCreated, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *Application) logoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Revoke the session, so that the JWT can't be used again even if it was copied.
+	if session := app.contextGetSession(r); session != nil {
+		err := app.Models.Sessions.Delete(r.Context(), session.UserID, session.ID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
 	// Set the value of the "jwt" cookie to the empty string.
 	err := app.setCookie(w, "jwt", "", -1)
 	if err != nil {
@@ -166,6 +210,40 @@ func (app *Application) logoutUserHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// unlockUserHandler handles the "PUT /v1/admin/user/{id}/unlock" endpoint, clearing the failed
+// login counter and any lockout on the user account.
+func (app *Application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	admin := app.contextGetUser(r)
+	id := app.readIDParam(r)
+
+	err := app.Models.Users.ResetFailedLogins(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.Models.Events.Insert(r.Context(), &data.Event{
+		UserID:     id,
+		Type:       data.EventAccountUnlocked,
+		CreatedAt:  time.Now(),
+		Properties: map[string]string{"unlocked_by": admin.ID},
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user account unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *Application) getUserVouchersHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the user from the request context.
 	user := app.contextGetUser(r)
@@ -179,7 +257,7 @@ func (app *Application) getUserVouchersHandler(w http.ResponseWriter, r *http.Re
 	if len(voucherCodes) > 0 {
 
 		// Get the details of the vouchers
-		vouchersfromModel, err := app.Models.Vouchers.GetVoucherList(voucherCodes)
+		vouchersfromModel, err := app.Models.Vouchers.GetVoucherList(r.Context(), voucherCodes)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -237,7 +315,7 @@ func (app *Application) getUserVouchersHandler(w http.ResponseWriter, r *http.Re
 	}
 
 	// Update the user's voucher list
-	err := app.Models.Users.UpdateVoucherList(user.ID, user.Vouchers)
+	err := app.Models.Users.UpdateVoucherList(r.Context(), user.ID, user.Vouchers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -254,7 +332,7 @@ func (app *Application) getUserVouchersHandler(w http.ResponseWriter, r *http.Re
 func (app *Application) getUserPointsHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
-	points, err := app.Models.Users.GetPoints(user.ID)
+	points, err := app.Models.Users.GetPoints(r.Context(), user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -270,6 +348,20 @@ func (app *Application) getUserPointsHandler(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+// recordPoints adds an entry to the point history of the user. It is written before the response
+// is sent, and a failure fails the request, so that the history and the account export don't
+// silently miss a change to the balance.
+func (app *Application) recordPoints(ctx context.Context, userID, eventType string, points int, properties map[string]string) error {
+	properties["points"] = strconv.Itoa(points)
+
+	return app.Models.Events.Insert(ctx, &data.Event{
+		UserID:     userID,
+		Type:       eventType,
+		CreatedAt:  time.Now(),
+		Properties: properties,
+	})
+}
+
 func (app *Application) addUserPointsHandler(w http.ResponseWriter, r *http.Request) {
 
 	user := app.contextGetUser(r)
@@ -284,11 +376,17 @@ func (app *Application) addUserPointsHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.Models.Users.AddPoints(user.ID, input.Points)
+	err = app.Models.Users.AddPoints(r.Context(), user.ID, input.Points)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.recordPoints(r.Context(), user.ID, data.EventPointsEarned, input.Points, map[string]string{"source": "user"})
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	app.Metrics.PointsEarned("user", input.Points)
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "points added"}, nil)
 	if err != nil {
@@ -341,7 +439,7 @@ func (app *Application) exchangePointsForVoucherHandler(w http.ResponseWriter, r
 		return
 	}
 
-	err = app.Models.Users.DeductPointsAndCreateVoucher(user.ID, input.Points, &voucher)
+	err = app.Models.Users.DeductPointsAndCreateVoucher(r.Context(), user.ID, input.Points, &voucher)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrVoucherAlreadyExists):
@@ -353,6 +451,12 @@ func (app *Application) exchangePointsForVoucherHandler(w http.ResponseWriter, r
 		}
 		return
 	}
+	err = app.recordPoints(r.Context(), user.ID, data.EventPointsSpent, input.Points, map[string]string{"voucher": voucher.Code})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.Metrics.PointsSpent(input.Points)
 
 	// Send a success response
 	err = app.writeJSON(w, http.StatusOK, envelope{"message": "points redeemed and voucher added"}, nil)
@@ -368,7 +472,7 @@ func (app *Application) redeemUserVoucherHandler(w http.ResponseWriter, r *http.
 
 	code := app.readIDParam(r)
 
-	voucher, err := app.Models.Vouchers.Get(code)
+	voucher, err := app.Models.Vouchers.Get(r.Context(), code)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -384,7 +488,7 @@ func (app *Application) redeemUserVoucherHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	err = app.Models.Users.RedeemVoucher(user.ID, voucher.Code, 1)
+	err = app.Models.Users.RedeemVoucher(r.Context(), user.ID, voucher.Code, 1)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrVoucherAlreadyRedeeemed):
@@ -394,6 +498,7 @@ func (app *Application) redeemUserVoucherHandler(w http.ResponseWriter, r *http.
 		}
 		return
 	}
+	app.Metrics.VoucherRedeemed()
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"voucher": "successfully redeemed voucher"}, nil)
 	if err != nil {
@@ -407,37 +512,49 @@ func (app *Application) useUserVoucherHandler(w http.ResponseWriter, r *http.Req
 
 	voucherCode := app.readIDParam(r)
 
-	if voucherCount, ok := user.Vouchers[voucherCode]; ok {
-		if voucherCount > 0 {
-			user.Vouchers[voucherCode]--
-			err := app.Models.Users.UpdateVoucherList(user.ID, user.Vouchers)
-			if err != nil {
-				app.serverErrorResponse(w, r, err)
-				return
-			}
-			err = app.Models.Vouchers.UpdateUsageCount(voucherCode)
-			if err != nil {
-				switch {
-				case errors.Is(err, data.ErrRecordNotFound):
-					app.notFoundResponse(w, r)
-				case errors.Is(err, data.ErrEditConflict):
-					app.editConflictResponse(w, r)
-				default:
-					app.serverErrorResponse(w, r, err)
-				}
-				return
-			}
-		} else {
+	err := app.useVoucher(r.Context(), user, voucherCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, errVoucherNotAvailable):
 			app.voucherNotAvailableResponse(w, r)
-			return
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
 		}
-	} else {
-		app.voucherNotAvailableResponse(w, r)
 		return
 	}
 
-	err := app.writeJSON(w, http.StatusOK, envelope{"voucher": "successfully used voucher"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"voucher": "successfully used voucher"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// errVoucherNotAvailable is returned by useVoucher when the user has no remaining uses of the
+// voucher.
+var errVoucherNotAvailable = errors.New("voucher not available")
+
+// useVoucher decrements the user's remaining uses of the voucher and increments the usage count
+// of the voucher itself.
+func (app *Application) useVoucher(ctx context.Context, user *data.User, voucherCode string) error {
+	if voucherCount, ok := user.Vouchers[voucherCode]; !ok || voucherCount <= 0 {
+		return errVoucherNotAvailable
+	}
+
+	user.Vouchers[voucherCode]--
+	err := app.Models.Users.UpdateVoucherList(ctx, user.ID, user.Vouchers)
+	if err != nil {
+		return err
+	}
+
+	err = app.Models.Vouchers.UpdateUsageCount(ctx, voucherCode)
+	if err != nil {
+		return err
+	}
+
+	app.Metrics.VoucherUsed()
+	return nil
+}
@@ -80,7 +80,7 @@ func (app *Application) createVoucherHandler(w http.ResponseWriter, r *http.Requ
 	// Call the Insert() method on our vouchers model, passing in a pointer to the validated voucher
 	// struct. This will create a record in the database and update the voucher struct with the
 	// system-generated information.
-	err = app.Models.Vouchers.Insert(voucher)
+	err = app.Models.Vouchers.Insert(r.Context(), voucher)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -91,7 +91,7 @@ func (app *Application) createVoucherHandler(w http.ResponseWriter, r *http.Requ
 	// method to add a new Location header,
 	// interpolating the system-generated ID for our new movie in the URL.
 	headers := make(http.Header)
-	headers.Set("Location", fmt.Sprintf("/v1/vouchers/%s", voucher.Code))
+	headers.Set("Location", fmt.Sprintf("/v1/voucher/%s", voucher.Code))
 
 	// Write a JSON response with a 201 Created status code, the movie data in the response body,
 	// and the Location header.
@@ -114,7 +114,7 @@ func (app *Application) showVoucherHandler(w http.ResponseWriter, r *http.Reques
 	// We also need to use the errors.Is()
 	// function to check if it returns a data.ErrRecordNotFound error,
 	// in which case we send a 404 Not Found response to the client.
-	voucher, err := app.Models.Vouchers.Get(code)
+	voucher, err := app.Models.Vouchers.Get(r.Context(), code)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -142,7 +142,7 @@ func (app *Application) deleteVoucherHandler(w http.ResponseWriter, r *http.Requ
 
 	// Delete the voucher from the database. Send a 404 Not Found response to the client if
 	// there isn't a matching record.
-	err := app.Models.Vouchers.Delete(code)
+	err := app.Models.Vouchers.Delete(r.Context(), code)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -214,7 +214,7 @@ func (app *Application) listVouchersHandler(w http.ResponseWriter, r *http.Reque
 
 	// Call the MovieModel.GetAll method to retrieve the movies, passing in the various filter
 	// parameters.
-	vouchers, metadata, err := app.Models.Vouchers.GetAllVouchers(input.Code, input.Starts, input.Expires, input.Active, input.MinSpend, input.Category, &input.Filters)
+	vouchers, metadata, err := app.Models.Vouchers.GetAllVouchers(r.Context(), input.Code, input.Starts, input.Expires, input.Active, input.MinSpend, input.Category, &input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
+)
+
+// envelope is the JSON object printed as the result of a command.
+type envelope map[string]any
+
+// validationError holds the failed checks of a command's flags, by flag name.
+type validationError map[string]string
+
+func (e validationError) Error() string {
+	return "invalid command flags"
+}
+
+// admin holds what the commands work with. migrate applies the migrations of the storage
+// backend, or with dryRun only lists them, and returns their versions.
+type admin struct {
+	models  data.Models
+	migrate func(ctx context.Context, dryRun bool) ([]string, error)
+	dryRun  bool
+}
+
+type command struct {
+	usage string
+	run   func(a *admin, ctx context.Context, args []string) (envelope, error)
+}
+
+var commands = map[string]command{
+	"create-admin":       {"Create a user with the admin role", (*admin).createAdmin},
+	"grant-role":         {"Grant a role to a user", (*admin).grantRole},
+	"adjust-points":      {"Add points to or remove points from a user, with a reason", (*admin).adjustPoints},
+	"deactivate-voucher": {"Deactivate a voucher so that it can no longer be redeemed or used", (*admin).deactivateVoucher},
+	"migrate":            {"Apply the database migrations", (*admin).runMigrations},
+	"seed":               {"Insert demo vouchers, a demo user and a demo merchant", (*admin).seed},
+}
+
+// commandNames lists the commands in the order they are shown in the usage.
+var commandNames = []string{"create-admin", "grant-role", "adjust-points", "deactivate-voucher", "migrate", "seed"}
+
+// adminActor is recorded as the actor of the events written by the commands.
+const adminActor = "admin-cli"
+
+// parseFlags parses the flags of a command. The usage of the command is printed to stderr if
+// they can't be parsed, keeping stdout for the JSON output.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Name(), err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected arguments %q", fs.Name(), fs.Args())
+	}
+	return nil
+}
+
+// findUser looks up a user by ID, or by email address if the value contains an @.
+func (a *admin) findUser(ctx context.Context, idOrEmail string) (*data.User, error) {
+	var user *data.User
+	var err error
+	if strings.Contains(idOrEmail, "@") {
+		user, err = a.models.Users.GetByEmail(ctx, idOrEmail)
+	} else {
+		user, err = a.models.Users.Get(ctx, idOrEmail)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, fmt.Errorf("no user %q", idOrEmail)
+		default:
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+// userSummary returns the fields of a user which are shown in the output of the commands.
+func userSummary(user *data.User) envelope {
+	return envelope{
+		"id":     user.ID,
+		"name":   user.Name,
+		"email":  user.Email,
+		"points": user.Points,
+		"roles":  append([]string{}, user.Roles...),
+	}
+}
+
+func (a *admin) createAdmin(ctx context.Context, args []string) (envelope, error) {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	name := fs.String("name", "", "Name of the user")
+	email := fs.String("email", "", "Email address of the user")
+	password := fs.String("password", os.Getenv("ADMIN_PASSWORD"), "Password of the user (default: the ADMIN_PASSWORD environment variable)")
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	user := &data.User{
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Name:      *name,
+		Email:     *email,
+		Addresses: []data.Address{},
+		Phone:     []data.Phone{},
+		Vouchers:  map[string]int{},
+		Points:    0,
+		Version:   1,
+		Roles:     []string{data.RoleAdmin},
+	}
+	err := user.Password.Set(*password)
+	if err != nil {
+		return nil, err
+	}
+
+	v := validator.New()
+	if data.ValidateUser(v, user); !v.Valid() {
+		return nil, validationError(v.Errors)
+	}
+
+	if a.dryRun {
+		// Inserting would fail on a duplicate email, so check for one up front.
+		_, err = a.models.Users.GetByEmail(ctx, user.Email)
+		switch {
+		case err == nil:
+			return nil, validationError{"email": "a user with this email address already exists"}
+		case !errors.Is(err, data.ErrRecordNotFound):
+			return nil, err
+		}
+		return envelope{"dry_run": true, "user": userSummary(user)}, nil
+	}
+
+	id, err := a.models.Users.Insert(ctx, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			return nil, validationError{"email": "a user with this email address already exists"}
+		default:
+			return nil, err
+		}
+	}
+	user.ID = id
+
+	return envelope{"dry_run": false, "user": userSummary(user)}, nil
+}
+
+func (a *admin) grantRole(ctx context.Context, args []string) (envelope, error) {
+	fs := flag.NewFlagSet("grant-role", flag.ContinueOnError)
+	userFlag := fs.String("user", "", "ID or email address of the user")
+	role := fs.String("role", data.RoleAdmin, "Role to grant ("+strings.Join(data.Roles, "|")+")")
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	v := validator.New()
+	v.Check(*userFlag != "", "user", "must be provided")
+	if data.ValidateRole(v, *role); !v.Valid() {
+		return nil, validationError(v.Errors)
+	}
+
+	user, err := a.findUser(ctx, *userFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	// Granting a role the user already has changes nothing.
+	granted := !user.HasRole(*role)
+	if granted && !a.dryRun {
+		err = a.models.Users.AddRole(ctx, user.ID, *role)
+		if err != nil {
+			return nil, err
+		}
+
+		err = a.models.Events.Insert(ctx, &data.Event{
+			UserID:     user.ID,
+			Type:       data.EventRoleGranted,
+			CreatedAt:  time.Now(),
+			Properties: map[string]string{"role": *role, "granted_by": adminActor},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if granted {
+		user.Roles = append(user.Roles, *role)
+	}
+
+	return envelope{"dry_run": a.dryRun, "granted": granted, "user": userSummary(user)}, nil
+}
+
+func (a *admin) adjustPoints(ctx context.Context, args []string) (envelope, error) {
+	fs := flag.NewFlagSet("adjust-points", flag.ContinueOnError)
+	userFlag := fs.String("user", "", "ID or email address of the user")
+	points := fs.Int("points", 0, "Points to add, or remove if negative")
+	reason := fs.String("reason", "", "Reason for the adjustment, which is recorded with it")
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	v := validator.New()
+	v.Check(*userFlag != "", "user", "must be provided")
+	v.Check(*points != 0, "points", "must not be zero")
+	v.Check(strings.TrimSpace(*reason) != "", "reason", "must be provided")
+	v.Check(len(*reason) <= 500, "reason", "must not be more than 500 bytes long")
+	if !v.Valid() {
+		return nil, validationError(v.Errors)
+	}
+
+	user, err := a.findUser(ctx, *userFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	before := user.Points
+	if before+*points < 0 {
+		return nil, validationError{"points": fmt.Sprintf("must not remove more than the user's %d points", before)}
+	}
+
+	if !a.dryRun {
+		// The balance may have changed since it was read, so AddPoints checks it again.
+		err = a.models.Users.AddPoints(ctx, user.ID, *points)
+		if err != nil {
+			if errors.Is(err, data.ErrInsufficientPoints) {
+				return nil, validationError{"points": "must not remove more than the user's points"}
+			}
+			return nil, err
+		}
+
+		err = a.models.Events.Insert(ctx, &data.Event{
+			UserID:    user.ID,
+			Type:      data.EventPointsAdjusted,
+			CreatedAt: time.Now(),
+			Properties: map[string]string{
+				"points":      strconv.Itoa(*points),
+				"reason":      *reason,
+				"adjusted_by": adminActor,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return envelope{
+		"dry_run":       a.dryRun,
+		"user_id":       user.ID,
+		"points":        *points,
+		"points_before": before,
+		"points_after":  before + *points,
+		"reason":        *reason,
+	}, nil
+}
+
+func (a *admin) deactivateVoucher(ctx context.Context, args []string) (envelope, error) {
+	fs := flag.NewFlagSet("deactivate-voucher", flag.ContinueOnError)
+	code := fs.String("code", "", "Code of the voucher")
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	if *code == "" {
+		return nil, validationError{"code": "must be provided"}
+	}
+
+	// Voucher codes are stored in lowercase.
+	voucher, err := a.models.Vouchers.Get(ctx, strings.ToLower(*code))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil, fmt.Errorf("no voucher %q", *code)
+		default:
+			return nil, err
+		}
+	}
+
+	// Deactivating an inactive voucher changes nothing.
+	deactivated := voucher.Active
+	if deactivated && !a.dryRun {
+		err = a.models.Vouchers.Deactivate(ctx, voucher.Code)
+		if err != nil {
+			return nil, err
+		}
+	}
+	voucher.Active = false
+
+	return envelope{"dry_run": a.dryRun, "deactivated": deactivated, "voucher": voucher}, nil
+}
+
+func (a *admin) runMigrations(ctx context.Context, args []string) (envelope, error) {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	if a.migrate == nil {
+		return nil, errors.New("the storage backend has no migrations")
+	}
+
+	migrations, err := a.migrate(ctx, a.dryRun)
+	if err != nil {
+		return nil, err
+	}
+	if migrations == nil {
+		migrations = []string{}
+	}
+
+	// A dry run lists the pending migrations instead of applying them.
+	if a.dryRun {
+		return envelope{"dry_run": true, "pending": migrations}, nil
+	}
+	return envelope{"dry_run": false, "applied": migrations}, nil
+}
+
+// seed inserts demo data for development, skipping any record which already exists so that it
+// can be run more than once.
+func (a *admin) seed(ctx context.Context, args []string) (envelope, error) {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	password := fs.String("password", "demo-password", "Password of the demo user")
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	vouchers := []data.Voucher{
+		{Code: "demo10off", Description: "$10 off any order", Discount: 10, MinSpend: 50, Category: "general"},
+		{Code: "demo15pct", Description: "15% off food", Discount: 15, IsPercentage: true, Category: "food"},
+		{Code: "demotravel", Description: "$25 off travel bookings", Discount: 25, MinSpend: 200, UsageLimit: 100, Category: "travel"},
+	}
+
+	created := map[string][]string{"vouchers": {}, "users": {}, "merchants": {}}
+	skipped := map[string][]string{"vouchers": {}, "users": {}, "merchants": {}}
+
+	for _, voucher := range vouchers {
+		_, err := a.models.Vouchers.Get(ctx, voucher.Code)
+		switch {
+		case err == nil:
+			skipped["vouchers"] = append(skipped["vouchers"], voucher.Code)
+			continue
+		case !errors.Is(err, data.ErrRecordNotFound):
+			return nil, err
+		}
+
+		voucher.CreatedAt = now
+		voucher.ModifiedAt = now
+		voucher.Starts = now
+		voucher.Expires = now.AddDate(1, 0, 0)
+		voucher.Active = true
+		if !a.dryRun {
+			if err = a.models.Vouchers.Insert(ctx, &voucher); err != nil {
+				return nil, err
+			}
+		}
+		created["vouchers"] = append(created["vouchers"], voucher.Code)
+	}
+
+	const demoEmail = "demo@example.com"
+	_, err := a.models.Users.GetByEmail(ctx, demoEmail)
+	switch {
+	case err == nil:
+		skipped["users"] = append(skipped["users"], demoEmail)
+	case errors.Is(err, data.ErrRecordNotFound):
+		user := &data.User{
+			CreatedAt: now,
+			UpdatedAt: now,
+			Name:      "Demo User",
+			Email:     demoEmail,
+			Addresses: []data.Address{},
+			Phone:     []data.Phone{},
+			Vouchers:  map[string]int{},
+			Points:    500,
+			Version:   1,
+		}
+		if err = user.Password.Set(*password); err != nil {
+			return nil, err
+		}
+		v := validator.New()
+		if data.ValidateUser(v, user); !v.Valid() {
+			return nil, validationError(v.Errors)
+		}
+		if !a.dryRun {
+			if _, err = a.models.Users.Insert(ctx, user); err != nil {
+				return nil, err
+			}
+		}
+		created["users"] = append(created["users"], demoEmail)
+	default:
+		return nil, err
+	}
+
+	const demoMerchant = "Demo Store"
+	merchants, err := a.models.Merchants.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exists := false
+	for _, merchant := range merchants {
+		exists = exists || merchant.Name == demoMerchant
+	}
+	if exists {
+		skipped["merchants"] = append(skipped["merchants"], demoMerchant)
+	} else {
+		if !a.dryRun {
+			_, err = a.models.Merchants.Insert(ctx, &data.Merchant{
+				CreatedAt: now,
+				UpdatedAt: now,
+				Name:      demoMerchant,
+				Active:    true,
+				Version:   1,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		created["merchants"] = append(created["merchants"], demoMerchant)
+	}
+
+	return envelope{"dry_run": a.dryRun, "created": created, "skipped": skipped}, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+)
+
+func newTestAdmin(t *testing.T) *admin {
+	t.Helper()
+	return &admin{models: data.NewMemoryModels()}
+}
+
+func TestCreateAdmin(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAdmin(t)
+	args := []string{"-name", "Admin", "-email", "admin@example.com", "-password", "pa55word1234"}
+
+	// A dry run validates without creating the user.
+	a.dryRun = true
+	if _, err := a.createAdmin(ctx, args); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.models.Users.GetByEmail(ctx, "admin@example.com"); !errors.Is(err, data.ErrRecordNotFound) {
+		t.Fatalf("dry run created the user: %v", err)
+	}
+
+	a.dryRun = false
+	if _, err := a.createAdmin(ctx, args); err != nil {
+		t.Fatal(err)
+	}
+	user, err := a.models.Users.GetByEmail(ctx, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.HasRole(data.RoleAdmin) {
+		t.Errorf("got roles %v; want %q", user.Roles, data.RoleAdmin)
+	}
+
+	var verr validationError
+	if _, err = a.createAdmin(ctx, args); !errors.As(err, &verr) || verr["email"] == "" {
+		t.Errorf("create-admin with a duplicate email: got error %v; want an email validation error", err)
+	}
+	if _, err = a.createAdmin(ctx, []string{"-email", "other@example.com"}); !errors.As(err, &verr) {
+		t.Errorf("create-admin without a name or password: got error %v; want a validation error", err)
+	}
+}
+
+func TestGrantRole(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAdmin(t)
+	id, err := a.models.Users.Insert(ctx, &data.User{Name: "Test User", Email: "test@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantGranted bool
+		wantErr     bool
+	}{
+		{"Unknown role", []string{"-user", id, "-role", "owner"}, false, true},
+		{"Unknown user", []string{"-user", "nobody@example.com"}, false, true},
+		{"By email", []string{"-user", "test@example.com"}, true, false},
+		{"Already granted", []string{"-user", id}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := a.grantRole(ctx, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+			if err == nil && result["granted"] != tt.wantGranted {
+				t.Errorf("got granted %v; want %t", result["granted"], tt.wantGranted)
+			}
+		})
+	}
+
+	events, err := a.models.Events.GetAllForUser(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Type != data.EventRoleGranted {
+		t.Errorf("got events %v; want one %q event", events, data.EventRoleGranted)
+	}
+}
+
+func TestAdjustPoints(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAdmin(t)
+	id, err := a.models.Users.Insert(ctx, &data.User{Name: "Test User", Email: "test@example.com", Points: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		dryRun     bool
+		args       []string
+		wantErr    bool
+		wantPoints int
+	}{
+		{"Without reason", false, []string{"-user", id, "-points", "10"}, true, 100},
+		{"Too many removed", false, []string{"-user", id, "-points", "-101", "-reason", "refund"}, true, 100},
+		{"Dry run", true, []string{"-user", id, "-points", "50", "-reason", "goodwill"}, false, 100},
+		{"Added", false, []string{"-user", id, "-points", "50", "-reason", "goodwill"}, false, 150},
+		{"Removed", false, []string{"-user", id, "-points", "-150", "-reason", "fraud"}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.dryRun = tt.dryRun
+			_, err := a.adjustPoints(ctx, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+
+			points, err := a.models.Users.GetPoints(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if points != tt.wantPoints {
+				t.Errorf("got %d points; want %d", points, tt.wantPoints)
+			}
+		})
+	}
+
+	// Every applied adjustment is recorded with its reason.
+	events, err := a.models.Events.GetAllForUser(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Properties["reason"] != "fraud" {
+		t.Errorf("got events %v; want the two adjustments, newest first", events)
+	}
+}
+
+func TestDeactivateVoucher(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAdmin(t)
+	err := a.models.Vouchers.Insert(ctx, &data.Voucher{Code: "code", Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.dryRun = true
+	if _, err = a.deactivateVoucher(ctx, []string{"-code", "CODE"}); err != nil {
+		t.Fatal(err)
+	}
+	voucher, err := a.models.Vouchers.Get(ctx, "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !voucher.Active {
+		t.Fatal("dry run deactivated the voucher")
+	}
+
+	a.dryRun = false
+	for _, wantDeactivated := range []bool{true, false} {
+		result, err := a.deactivateVoucher(ctx, []string{"-code", "code"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result["deactivated"] != wantDeactivated {
+			t.Errorf("got deactivated %v; want %t", result["deactivated"], wantDeactivated)
+		}
+	}
+
+	if _, err = a.deactivateVoucher(ctx, []string{"-code", "unknown"}); err == nil {
+		t.Error("deactivate-voucher of an unknown voucher: got no error")
+	}
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAdmin(t)
+
+	if _, err := a.seed(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Seeding again skips everything which already exists.
+	result, err := a.seed(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := result["created"].(map[string][]string)
+	for kind, names := range created {
+		if len(names) != 0 {
+			t.Errorf("seeding twice created %s %v", kind, names)
+		}
+	}
+
+	if _, err := a.models.Users.GetByEmail(ctx, "demo@example.com"); err != nil {
+		t.Errorf("the demo user wasn't created: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+// Command admin runs operational tasks against the database of the API server, such as creating
+// admin users or adjusting points. Every command prints its result as JSON, and with -dry-run
+// checks and reports what it would do without changing anything.
+//
+// Usage:
+//
+//	admin [flags] <command> [command flags]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/api"
+	"github.com/toduluz/savingsquadsbackend/internal/config"
+	"github.com/toduluz/savingsquadsbackend/internal/data"
+)
+
+func main() {
+	var cfg api.Config
+	var dryRun bool
+
+	flag.StringVar(&cfg.Storage, "storage", "mongo", "Storage backend (mongo|postgres)")
+	flag.StringVar(&cfg.Db.ConnectionString, "db-connection-string", "", "MongoDB connection string")
+	flag.StringVar(&cfg.Db.DatabaseName, "db-database-name", "testDB", "MongoDB database name")
+	flag.StringVar(&cfg.Postgres.DSN, "postgres-dsn", "", "PostgreSQL DSN")
+	flag.DurationVar(&cfg.Db.QueryTimeout, "db-query-timeout", data.DefaultQueryTimeout,
+		"Maximum duration of a single database query")
+	flag.DurationVar(&cfg.Db.MigrateTimeout, "db-migrate-timeout", 10*time.Minute,
+		"Maximum duration of the database migrations, including waiting for another instance to finish them")
+	flag.BoolVar(&dryRun, "dry-run", false, "Report what would be done without changing anything")
+	flag.Usage = usage
+
+	// The admin command shares the configuration file and environment of the server, and
+	// ignores the settings which it has no use for.
+	loader := config.Loader{
+		EnvPrefix: config.DefaultEnvPrefix,
+		Aliases: map[string]string{
+			"db-connection-string": "MONGOURILOCAL",
+			"postgres-dsn":         "POSTGRESURILOCAL",
+		},
+		AllowUnknown: true,
+	}
+	if err := loader.Load(flag.CommandLine, os.Args[1:]); err != nil {
+		fail(err)
+	}
+
+	// A single connection is plenty for one command at a time.
+	cfg.Db.MaxOpenConns = 1
+	cfg.Db.MaxIdleTime = "1m"
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	a := &admin{dryRun: dryRun}
+	switch cfg.Storage {
+	case "mongo":
+		db, err := api.OpenDB(cfg)
+		if err != nil {
+			fail(err)
+		}
+		defer db.Client().Disconnect(context.Background())
+
+		a.models = data.NewModels(db, cfg.Db.QueryTimeout)
+		a.migrate = func(ctx context.Context, dryRun bool) ([]string, error) {
+			var migrations []data.Migration
+			var err error
+			if dryRun {
+				var applied []data.AppliedMigration
+				applied, err = data.AppliedMongoMigrations(ctx, db)
+				if err == nil {
+					migrations, err = data.PendingMigrations(data.MongoMigrations, applied)
+				}
+			} else {
+				migrations, err = data.MigrateMongo(ctx, db)
+			}
+
+			var versions []string
+			for _, migration := range migrations {
+				versions = append(versions, fmt.Sprintf("%d %s", migration.Version, migration.Name))
+			}
+			return versions, err
+		}
+	case "postgres":
+		db, err := api.OpenPostgres(cfg)
+		if err != nil {
+			fail(err)
+		}
+		defer db.Close()
+
+		a.models = data.NewPostgresModels(db, cfg.Db.QueryTimeout)
+		a.migrate = func(ctx context.Context, dryRun bool) ([]string, error) {
+			if dryRun {
+				return data.PendingPostgresMigrations(ctx, db)
+			}
+			return data.MigratePostgres(ctx, db)
+		}
+	default:
+		fail(fmt.Errorf("unknown storage backend %q", cfg.Storage))
+	}
+
+	// Migrations may wait for another instance, so they get their own timeout.
+	timeout := time.Minute
+	if flag.Arg(0) == "migrate" {
+		timeout = cfg.Db.MigrateTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := cmd.run(a, ctx, flag.Args()[1:])
+	if err != nil {
+		fail(err)
+	}
+	if err = writeJSON(os.Stdout, result); err != nil {
+		fail(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: admin [flags] <command> [command flags]\n\nCommands:\n")
+	for _, name := range commandNames {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %-20s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// fail prints the error as JSON and exits. Validation errors are printed field by field, in the
+// same format as the API uses.
+func fail(err error) {
+	var message any = err.Error()
+	var verr validationError
+	if errors.As(err, &verr) {
+		message = map[string]string(verr)
+	}
+	writeJSON(os.Stdout, envelope{"error": message})
+	os.Exit(1)
+}
+
+func writeJSON(w io.Writer, env envelope) error {
+	js, err := json.MarshalIndent(env, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	_, err = w.Write(js)
+	return err
+}
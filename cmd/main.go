@@ -2,15 +2,34 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"log/slog"
 	"os"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/toduluz/savingsquadsbackend/api"
+	"github.com/toduluz/savingsquadsbackend/internal/config"
 	"github.com/toduluz/savingsquadsbackend/internal/data"
 	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
+	"github.com/toduluz/savingsquadsbackend/internal/jwks"
+	"github.com/toduluz/savingsquadsbackend/internal/metrics"
+	"github.com/toduluz/savingsquadsbackend/internal/oidc"
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
+// version is the version of the server, set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
 	// Declare an instance of the config struct.
 	var cfg api.Config
@@ -29,15 +48,40 @@ func main() {
 	// corresponding flags are provided.
 	flag.IntVar(&cfg.Port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.Env, "env", "development", "Environment (development|staging|production")
+	flag.TextVar(&cfg.Log.Level, "log-level", jsonlog.LevelInfo, "Minimum log level (debug|info|warn|error|off)")
+	flag.IntVar(&cfg.Log.SampleFirst, "log-sample-first", 100,
+		"Entries with the same message logged each second before sampling (0 disables sampling)")
+	flag.IntVar(&cfg.Log.SampleThereafter, "log-sample-thereafter", 100,
+		"Once sampling, log one in this many entries with the same message")
+	flag.DurationVar(&cfg.Shutdown.DrainDelay, "shutdown-drain-delay", 5*time.Second,
+		"Time between failing the readiness check and shutting down, for load balancers to stop sending requests")
+	flag.DurationVar(&cfg.Shutdown.Timeout, "shutdown-timeout", 20*time.Second,
+		"Maximum time to wait for requests in flight and background work when shutting down")
+	flag.StringVar(&cfg.Tracing.Exporter, "otel-exporter", "none", "OpenTelemetry trace exporter (none|stdout|otlp)")
+	flag.StringVar(&cfg.Tracing.Endpoint, "otel-endpoint", "",
+		"OTLP/HTTP endpoint URL, such as http://localhost:4318 (default: OTEL_EXPORTER_OTLP_ENDPOINT)")
+	flag.Float64Var(&cfg.Tracing.SampleRatio, "otel-sample-ratio", 1, "Share of new traces which are recorded")
+	flag.IntVar(&cfg.Metrics.Port, "metrics-port", 9090, "Admin server port for Prometheus metrics (0 disables)")
+	flag.StringVar(&cfg.TLS.CertFile, "tls-cert-file", "", "TLS certificate PEM file, to serve HTTPS")
+	flag.StringVar(&cfg.TLS.KeyFile, "tls-key-file", "", "TLS private key PEM file")
+	flag.BoolVar(&cfg.TLS.SelfSigned, "tls-self-signed", false,
+		"Serve HTTPS with a generated self-signed certificate (development only)")
+	flag.IntVar(&cfg.TLS.RedirectPort, "tls-redirect-port", 0, "Port which redirects HTTP to HTTPS (0 disables)")
+	flag.StringVar(&cfg.Storage, "storage", "mongo", "Storage backend (mongo|postgres|memory)")
 
-	mongoConnectionString := os.Getenv("MONGOURILOCAL")
 	// Read the connection pool settings from command-line flags into the config struct.
 	flag.IntVar(&cfg.Db.MaxOpenConns, "db-max-open-conns", 25,
-		"MongoDB max open connections")
+		"Database max open connections")
 	flag.StringVar(&cfg.Db.MaxIdleTime, "db-max-idle-time", "15m",
-		"MongoDB max connection idle time")
-	flag.StringVar(&cfg.Db.ConnectionString, "db-connection-string", mongoConnectionString, "MongoDB connection string")
+		"Database max connection idle time")
+	flag.StringVar(&cfg.Db.ConnectionString, "db-connection-string", "", "MongoDB connection string")
 	flag.StringVar(&cfg.Db.DatabaseName, "db-database-name", "testDB", "MongoDB database name")
+	flag.DurationVar(&cfg.Db.QueryTimeout, "db-query-timeout", data.DefaultQueryTimeout,
+		"Maximum duration of a single database query")
+	flag.BoolVar(&cfg.Db.Migrate, "db-migrate", true, "Apply database migrations at startup")
+	flag.DurationVar(&cfg.Db.MigrateTimeout, "db-migrate-timeout", 10*time.Minute,
+		"Maximum duration of the database migrations, including waiting for another instance to finish them")
+	flag.StringVar(&cfg.Postgres.DSN, "postgres-dsn", "", "PostgreSQL DSN")
 
 	// Use flag.Func function to process the -cors-trusted-origins command line flag. In this we
 	// use the strings.Field function to split the flag value into slice based on whitespace
@@ -49,36 +93,277 @@ func main() {
 		return nil
 	})
 
-	jwtSecret := os.Getenv("JWTSECRET")
-	// Parse the JWT signing secret from the command-line-flag. Notice that we leave the
-	// default value as the empty string if no flag is provided.
-	flag.StringVar(&cfg.Jwt.Secret, "jwt-secret", jwtSecret, "JWT secret")
+	// Read the cookie encryption keys, newest first. Each key is a hex-encoded 32-byte AES
+	// key, which can be generated with "openssl rand -hex 32".
+	flag.Func("cookie-keys", "Cookie encryption keys, newest first (space separated hex)", func(val string) error {
+		cfg.Cookie.Keys = nil
+		for _, field := range strings.Fields(val) {
+			key, err := hex.DecodeString(field)
+			if err != nil {
+				return errors.New("cookie keys must be hex-encoded")
+			}
+			cfg.Cookie.Keys = append(cfg.Cookie.Keys, key)
+		}
+		return nil
+	})
+
+	// Read the JWT signing key settings. The key files are PEM-encoded Ed25519 or RSA keys; to
+	// rotate keys, add the new key file alongside the old one, then switch the signing key ID
+	// once other services have picked up the new key from the JWKS endpoint, and finally
+	// remove the old key once the tokens it signed have expired.
+	flag.Func("jwt-key-files", "JWT signing key PEM files (space separated)", func(val string) error {
+		cfg.Jwt.KeyFiles = strings.Fields(val)
+		return nil
+	})
+	flag.StringVar(&cfg.Jwt.SigningKeyID, "jwt-signing-key-id", "", "ID of the key to sign JWTs with (default: the first key)")
+	flag.StringVar(&cfg.Jwt.Issuer, "jwt-issuer", "savingsquads", "JWT issuer")
+	flag.StringVar(&cfg.Jwt.Audience, "jwt-audience", "savingsquads", "JWT audience")
+
+	// Read the login lockout settings from command-line flags into the config struct.
+	flag.IntVar(&cfg.Lockout.MaxAttempts, "lockout-max-attempts", 5,
+		"Failed logins before an account is locked (0 disables lockout)")
+	flag.DurationVar(&cfg.Lockout.BaseDuration, "lockout-base-duration", time.Minute,
+		"Initial account lockout duration")
+	flag.DurationVar(&cfg.Lockout.MaxDuration, "lockout-max-duration", time.Hour,
+		"Maximum account lockout duration")
+
+	flag.StringVar(&cfg.Mfa.Issuer, "mfa-issuer", "SavingSquads", "Issuer name shown in authenticator apps")
+
+	// Read the account deletion settings from command-line flags into the config struct.
+	flag.DurationVar(&cfg.Deletion.CoolingOff, "deletion-cooling-off", 30*24*time.Hour,
+		"Time before a deleted account is anonymized, during which the deletion can be cancelled")
+	flag.DurationVar(&cfg.Deletion.Interval, "deletion-interval", time.Hour,
+		"How often to anonymize accounts whose deletion is due")
+
+	// Read the OpenID Connect providers. The flag can be repeated to configure several providers.
+	flag.Func("oidc-provider", "OpenID Connect provider, as name=...,issuer=...,client-id=...,client-secret=...,redirect-url=...[,scopes=...] (repeatable)", func(val string) error {
+		provider, err := oidc.ParseConfig(val)
+		if err != nil {
+			return err
+		}
+		cfg.Oidc.Providers = append(cfg.Oidc.Providers, provider)
+		return nil
+	})
+
+	// Each flag can also be set in the configuration file or the environment, with the command
+	// line taking precedence over the environment, and the environment over the file. The
+	// environment variables which were read before are still honoured.
+	loader := config.Loader{
+		EnvPrefix: config.DefaultEnvPrefix,
+		Aliases: map[string]string{
+			"db-connection-string": "MONGOURILOCAL",
+			"postgres-dsn":         "POSTGRESURILOCAL",
+			"cookie-keys":          "COOKIEKEYS",
+		},
+	}
+	if err := loader.Load(flag.CommandLine, os.Args[1:]); err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	// Apply the logging settings, and route the log/slog output of libraries through the logger.
+	logger.SetLevel(cfg.Log.Level)
+	if cfg.Log.SampleFirst > 0 {
+		logger = logger.WithSampling(cfg.Log.SampleFirst, cfg.Log.SampleThereafter, time.Second)
+	}
+	slog.SetDefault(slog.New(logger.Handler()))
+
+	// The "migrate" subcommand applies the database migrations and exits, for deployments which
+	// run migrations as a separate step, and the "config" subcommand prints the effective
+	// configuration and exits.
+	command := flag.Arg(0)
+	if command != "" && command != "migrate" && command != "config" {
+		logger.PrintFatal(fmt.Errorf("unknown command %q", command), nil)
+	}
+	migrate := cfg.Db.Migrate || command == "migrate"
+
+	v := validator.New()
+	if api.ValidateConfig(v, cfg); !v.Valid() {
+		logger.PrintFatal(errors.New("invalid configuration"), v.Errors)
+	}
+
+	cfg.Build.Version = version
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				cfg.Build.Commit = setting.Value
+			case "vcs.time":
+				cfg.Build.Time = setting.Value
+			}
+		}
+	}
+
+	// Secrets, such as the keys and the database password, are redacted.
+	if command == "config" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(config.Redacted(cfg)); err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		return
+	}
+	logger.PrintInfo("effective configuration", config.Redacted(cfg))
+
+	// The readiness check fails unless the database is reachable and its migrations are applied,
+	// which another instance may still be doing when migrations at startup are turned off.
+	appMetrics := metrics.New()
 
-	flag.Parse()
+	// The dependencies are closed by the application when the server shuts down, in reverse
+	// order.
+	var closers api.Closers
 
-	// Call the openDB() helper function (see below) to create teh connection pool,
-	// passing in the config struct. If this returns an error,
-	// we log it and exit the Application immediately.
-	db, err := api.OpenDB(cfg)
+	// Set up tracing before connecting to the database, so that the command monitor picks up the
+	// tracer provider. The remaining spans are flushed on the way out.
+	shutdownTracing, err := api.SetupTracing(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
+	closers = append(closers, api.Closer{Name: "tracing", Close: shutdownTracing})
 
-	// Defer a call to db.Close() so that the connection pool is closed before the main()
-	// function exits.
-	defer func() {
-		if err := db.Client().Disconnect(context.Background()); err != nil {
+	var models data.Models
+	var healthChecks map[string]func(context.Context) error
+	switch cfg.Storage {
+	case "memory":
+		logger.PrintInfo("using in-memory storage, data will be lost on restart", nil)
+		models = data.NewMemoryModels()
+	case "mongo":
+		// Call the openDB() helper function (see below) to create teh connection pool,
+		// passing in the config struct. If this returns an error,
+		// we log it and exit the Application immediately.
+		db, err := api.OpenDB(cfg, appMetrics.MongoMonitor(), otelmongo.NewMonitor(otelmongo.WithCommandAttributeDisabled(true)))
+		if err != nil {
 			logger.PrintFatal(err, nil)
 		}
-	}()
 
-	logger.PrintInfo("database connection pool established", nil)
+		closers = append(closers, api.Closer{Name: "mongo", Close: db.Client().Disconnect})
+
+		logger.PrintInfo("database connection pool established", nil)
+
+		// Bring the indexes and documents up to date before serving any requests.
+		if migrate {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Db.MigrateTimeout)
+			applied, err := data.MigrateMongo(ctx, db)
+			cancel()
+			for _, migration := range applied {
+				logger.PrintInfo("applied migration", map[string]string{
+					"version": strconv.Itoa(migration.Version),
+					"name":    migration.Name,
+				})
+			}
+			if err != nil {
+				logger.PrintFatal(err, nil)
+			}
+		}
+
+		models = data.NewModels(db, cfg.Db.QueryTimeout)
+		healthChecks = map[string]func(context.Context) error{
+			"database": func(ctx context.Context) error {
+				return db.Client().Ping(ctx, readpref.Primary())
+			},
+			"migrations": func(ctx context.Context) error {
+				applied, err := data.AppliedMongoMigrations(ctx, db)
+				if err != nil {
+					return err
+				}
+				pending, err := data.PendingMigrations(data.MongoMigrations, applied)
+				if err != nil {
+					return err
+				}
+				return pendingMigrationsError(len(pending))
+			},
+		}
+	case "postgres":
+		db, err := api.OpenPostgres(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		closers = append(closers, api.Closer{Name: "postgres", Close: func(context.Context) error {
+			return db.Close()
+		}})
+
+		logger.PrintInfo("database connection pool established", nil)
+
+		// Bring the schema up to date before serving any requests.
+		if migrate {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Db.MigrateTimeout)
+			applied, err := data.MigratePostgres(ctx, db)
+			cancel()
+			for _, version := range applied {
+				logger.PrintInfo("applied migration", map[string]string{
+					"version": version,
+				})
+			}
+			if err != nil {
+				logger.PrintFatal(err, nil)
+			}
+		}
+
+		models = data.NewPostgresModels(db, cfg.Db.QueryTimeout)
+		healthChecks = map[string]func(context.Context) error{
+			"database": db.PingContext,
+			"migrations": func(ctx context.Context) error {
+				pending, err := data.PendingPostgresMigrations(ctx, db)
+				if err != nil {
+					return err
+				}
+				return pendingMigrationsError(len(pending))
+			},
+		}
+	default:
+		logger.PrintFatal(fmt.Errorf("unknown storage backend %q", cfg.Storage), nil)
+	}
+
+	if command == "migrate" {
+		logger.PrintInfo("migrations are up to date", nil)
+		if err := closers.Close(context.Background()); err != nil {
+			logger.PrintError(err, nil)
+		}
+		return
+	}
+
+	// Load the JWT signing keys. Outside of development they must be configured, while in
+	// development we fall back to a throwaway key so that the server runs without any setup.
+	var keys *jwks.KeySet
+	if len(cfg.Jwt.KeyFiles) == 0 && cfg.Env == "development" {
+		logger.PrintInfo("no JWT key files configured, generating a temporary signing key", nil)
+		keys, err = jwks.Generate()
+	} else {
+		keys, err = jwks.Load(cfg.Jwt.KeyFiles, cfg.Jwt.SigningKeyID)
+	}
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	logger.PrintInfo("loaded JWT signing keys", map[string]string{
+		"signing_key_id": keys.SigningKeyID(),
+	})
+
+	// As with the JWT keys, development falls back to a throwaway cookie key, which logs
+	// everyone out when the server restarts.
+	// ValidateConfig has already made sure that they are configured outside of development.
+	if len(cfg.Cookie.Keys) == 0 {
+		logger.PrintInfo("no cookie keys configured, generating a temporary key", nil)
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		cfg.Cookie.Keys = [][]byte{key}
+	}
+
+	providers := make(map[string]*oidc.Provider, len(cfg.Oidc.Providers))
+	for _, provider := range cfg.Oidc.Providers {
+		providers[provider.Name] = oidc.NewProvider(provider)
+	}
 
 	// Declare an instance of the Application struct, containing the config struct and the infoLog.
 	app := &api.Application{
-		Config: cfg,
-		Logger: logger,
-		Models: data.NewModels(db),
+		Config:       cfg,
+		Logger:       logger,
+		Models:       data.NewTracedModels(models),
+		Keys:         keys,
+		Providers:    providers,
+		Metrics:      appMetrics,
+		HealthChecks: healthChecks,
+		Closers:      closers,
 	}
 
 	// Call app.server() to start the server.
@@ -86,3 +371,11 @@ func main() {
 		logger.PrintFatal(err, nil)
 	}
 }
+
+// pendingMigrationsError returns an error for the readiness check if there are pending migrations.
+func pendingMigrationsError(pending int) error {
+	if pending > 0 {
+		return fmt.Errorf("%d migrations pending", pending)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Package certs provides the TLS certificates which the server serves HTTPS with: certificates
+// loaded from files, which are reloaded when the files change, and generated self-signed
+// certificates for development.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// CheckInterval is how often a Reloader checks whether its files have changed.
+const CheckInterval = 10 * time.Second
+
+// Reloader serves a certificate and key loaded from PEM files, and loads them again when they
+// change, so that renewed certificates are picked up without restarting the server. The files
+// are checked on the first handshake after CheckInterval has passed, by their modification
+// times. If they can't be loaded, such as while they are being replaced, the previous
+// certificate is kept and the error is passed to OnError.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	// OnError, if set, is called with the errors of reloading the files.
+	OnError func(error)
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// NewReloader loads the certificate and key from the files.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate and key from the files, whether or not they have changed.
+func (r *Reloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.checked = time.Now()
+	return nil
+}
+
+// GetCertificate returns the current certificate. It satisfies tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	cert := r.cert
+	stale := time.Since(r.checked) >= CheckInterval
+	if stale {
+		// Only one handshake checks the files, while the others carry on with the current
+		// certificate.
+		r.checked = time.Now()
+	}
+	modTime := r.modTime
+	r.mu.Unlock()
+
+	if stale {
+		latest, err := r.latestModTime()
+		if err == nil && latest.After(modTime) {
+			err = r.Reload()
+		}
+		if err != nil {
+			if r.OnError != nil {
+				r.OnError(err)
+			}
+		} else {
+			r.mu.Lock()
+			cert = r.cert
+			r.mu.Unlock()
+		}
+	}
+
+	return cert, nil
+}
+
+// latestModTime returns the modification time of whichever of the files changed last.
+func (r *Reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// SelfSigned generates a self-signed ECDSA certificate for the hosts, which are DNS names or IP
+// addresses, valid for a year. Clients won't trust it unless told to, so it is only meant for
+// development.
+func SelfSigned(hosts ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"SavingSquads development"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
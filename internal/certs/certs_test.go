@@ -0,0 +1,144 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert generates a self-signed certificate for the host and writes it and its key to PEM
+// files, with the modification time.
+func writeCert(t *testing.T, certFile, keyFile, host string, modTime time.Time) {
+	t.Helper()
+
+	cert, err := SelfSigned(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: cert.Certificate[0]},
+		keyFile:  {Type: "PRIVATE KEY", Bytes: key},
+	}
+	for file, block := range files {
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func dnsName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.DNSNames[0]
+}
+
+func TestReloader(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+	writeCert(t, certFile, keyFile, "old.example", start)
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reloadErr error
+	r.OnError = func(err error) { reloadErr = err }
+
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dnsName(t, cert); got != "old.example" {
+		t.Fatalf("got certificate for %s, want old.example", got)
+	}
+
+	// The new files aren't picked up until the check interval has passed.
+	writeCert(t, certFile, keyFile, "new.example", start.Add(time.Minute))
+	cert, _ = r.GetCertificate(nil)
+	if got := dnsName(t, cert); got != "old.example" {
+		t.Fatalf("got certificate for %s before the check interval, want old.example", got)
+	}
+
+	r.mu.Lock()
+	r.checked = time.Time{}
+	r.mu.Unlock()
+	cert, _ = r.GetCertificate(nil)
+	if got := dnsName(t, cert); got != "new.example" {
+		t.Fatalf("got certificate for %s, want new.example", got)
+	}
+
+	// A broken file keeps the current certificate.
+	if err := os.WriteFile(keyFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := start.Add(2 * time.Minute)
+	if err := os.Chtimes(keyFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	r.mu.Lock()
+	r.checked = time.Time{}
+	r.mu.Unlock()
+	cert, _ = r.GetCertificate(nil)
+	if got := dnsName(t, cert); got != "new.example" {
+		t.Fatalf("got certificate for %s after a failed reload, want new.example", got)
+	}
+	if reloadErr == nil {
+		t.Error("the failed reload wasn't reported")
+	}
+}
+
+func TestNewReloaderMissingFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	_, err := NewReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("got error %v, want os.ErrNotExist", err)
+	}
+}
+
+func TestSelfSigned(t *testing.T) {
+	t.Parallel()
+
+	cert, err := SelfSigned("localhost", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cert.Leaf.VerifyHostname("localhost"); err != nil {
+		t.Error(err)
+	}
+	if err := cert.Leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Error(err)
+	}
+	if err := cert.Leaf.VerifyHostname("example.com"); err == nil {
+		t.Error("certificate is valid for example.com")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{Roots: pool, DNSName: "localhost"}); err != nil {
+		t.Error(err)
+	}
+}
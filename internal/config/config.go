@@ -0,0 +1,217 @@
+// Package config loads the settings of a command from a configuration file, environment variables
+// and command-line flags, in increasing order of precedence. Every setting is a flag of the
+// command, and the file and the environment are just other ways of setting flags: the flag
+// "db-max-open-conns" is set by the "db-max-open-conns" key of the file and by the
+// SAVINGSQUADS_DB_MAX_OPEN_CONNS environment variable, for the default prefix.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables which set flags.
+const DefaultEnvPrefix = "SAVINGSQUADS_"
+
+// Loader sets the flags of a FlagSet from a YAML configuration file, the environment and the
+// command line.
+type Loader struct {
+	// EnvPrefix is prepended to the environment variable names derived from flag names.
+	EnvPrefix string
+	// Aliases maps flag names to further environment variables which set them, for the
+	// variables which were read before the configuration was layered. The variable derived from
+	// the flag name takes precedence over its alias.
+	Aliases map[string]string
+	// AllowUnknown ignores keys of the file which aren't flags of the set, for commands which
+	// share the configuration file of the server but only use some of its settings.
+	AllowUnknown bool
+}
+
+// Load adds the -config flag to fs, which names the YAML configuration file, and parses args. It
+// then sets each flag which wasn't given on the command line from its environment variable, or
+// failing that from the file. The file can also be named by the CONFIG environment variable,
+// with the prefix. Its keys are flag names, and lists set repeatable flags once per item:
+//
+//	port: 4000
+//	db-query-timeout: 5s
+//	oidc-provider:
+//	  - name=google,issuer=https://accounts.google.com,...
+func (l Loader) Load(fs *flag.FlagSet, args []string) error {
+	path := fs.String("config", "", fmt.Sprintf("YAML configuration file (env %sCONFIG)", l.EnvPrefix))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	// The environment comes before the file, so that anything the environment sets is no longer
+	// open to the file.
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] || f.Name == "config" {
+			return
+		}
+		value, ok := os.LookupEnv(l.envName(f.Name))
+		if !ok && l.Aliases[f.Name] != "" {
+			value, ok = os.LookupEnv(l.Aliases[f.Name])
+		}
+		if !ok {
+			return
+		}
+		if serr := fs.Set(f.Name, value); serr != nil {
+			err = fmt.Errorf("invalid value %q for environment variable %s: %w", value, l.envName(f.Name), serr)
+		}
+		set[f.Name] = true
+	})
+	if err != nil {
+		return err
+	}
+
+	if *path == "" {
+		*path = os.Getenv(l.envName("config"))
+	}
+	if *path == "" {
+		return nil
+	}
+	return l.loadFile(fs, *path, set)
+}
+
+// envName returns the name of the environment variable which sets the flag.
+func (l Loader) envName(flagName string) string {
+	return l.EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func (l Loader) loadFile(fs *flag.FlagSet, path string, set map[string]bool) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]any
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Go through the keys in order, so that the first error is always the same.
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if fs.Lookup(key) == nil || key == "config" {
+			if l.AllowUnknown {
+				continue
+			}
+			return fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+		if set[key] {
+			continue
+		}
+
+		items, ok := values[key].([]any)
+		if !ok {
+			items = []any{values[key]}
+		}
+		for _, item := range items {
+			value, err := scalar(item)
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+			if err := fs.Set(key, value); err != nil {
+				return fmt.Errorf("%s: invalid value %q for %s: %w", path, value, key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// scalar returns the value of a YAML scalar as the string form which flags parse.
+func scalar(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case int, int64, uint64, float64, bool:
+		return fmt.Sprint(value), nil
+	case time.Time:
+		return value.Format(time.RFC3339), nil
+	default:
+		return "", fmt.Errorf("must be a string, number, boolean or list of those")
+	}
+}
+
+// Redacted flattens the configuration struct into a map from dotted field names, such as
+// "Db.MaxOpenConns", to printable values, for logging the effective configuration. Fields tagged
+// `secret:"true"` are redacted: URLs keep everything but their password, and anything else is
+// replaced altogether.
+func Redacted(cfg any) map[string]string {
+	out := make(map[string]string)
+	flatten(out, "", reflect.ValueOf(cfg), false)
+	return out
+}
+
+const redacted = "REDACTED"
+
+func flatten(out map[string]string, name string, v reflect.Value, secret bool) {
+	switch {
+	case v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{}):
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			key := field.Name
+			if name != "" {
+				key = name + "." + key
+			}
+			flatten(out, key, v.Field(i), secret || field.Tag.Get("secret") == "true")
+		}
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		// Secret lists only show how many items there are, such as the number of keys.
+		if secret {
+			out[name] = fmt.Sprintf("%s (%d)", redacted, v.Len())
+			return
+		}
+		if v.Len() == 0 {
+			out[name] = "[]"
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			flatten(out, name+"["+strconv.Itoa(i)+"]", v.Index(i), secret)
+		}
+	case secret:
+		out[name] = redactValue(v)
+	default:
+		out[name] = fmt.Sprint(v.Interface())
+	}
+}
+
+func redactValue(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		if v.String() == "" {
+			return ""
+		}
+		if u, err := url.Parse(v.String()); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				return u.Redacted()
+			}
+		}
+	}
+	return redacted
+}
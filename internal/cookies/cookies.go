@@ -1,16 +1,21 @@
 package cookies
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"errors"
+	"io"
 	"net/http"
 )
 
 var (
 	ErrValueTooLong = errors.New("cookie value too long")
 	ErrInvalidValue = errors.New("invalid cookie value")
+	ErrNoKeys       = errors.New("no cookie encryption keys")
 )
 
 func Write(w http.ResponseWriter, cookie http.Cookie) error {
@@ -100,3 +105,80 @@ func ReadSigned(r *http.Request, name string, secretKey []byte) (string, error)
 	// Return the original cookie value.
 	return value, nil
 }
+
+func WriteEncrypted(w http.ResponseWriter, cookie http.Cookie, keys [][]byte) error {
+	// Encrypt with the first key in the list, which is the newest. The older keys are only
+	// used for decrypting cookies which were written before the keys were rotated.
+	if len(keys) == 0 {
+		return ErrNoKeys
+	}
+
+	// Create a new AES cipher block from the key, and wrap it in GCM mode, which both
+	// encrypts and authenticates the data.
+	aesGCM, err := newGCM(keys[0])
+	if err != nil {
+		return err
+	}
+
+	// Create a unique nonce containing random bytes. GCM nonces must never be reused with
+	// the same key.
+	nonce := make([]byte, aesGCM.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+
+	// Encrypt the cookie value, passing the cookie name as additional data so that an
+	// encrypted value can't be moved into a cookie with another name. Seal appends the
+	// ciphertext to the nonce, so the value is in the format "{nonce}{encrypted value}".
+	encryptedValue := aesGCM.Seal(nonce, nonce, []byte(cookie.Value), []byte(cookie.Name))
+
+	// Set the cookie value to the encrypted value and write it using our Write() helper,
+	// which base64-encodes it.
+	cookie.Value = string(encryptedValue)
+
+	return Write(w, cookie)
+}
+
+func ReadEncrypted(r *http.Request, name string, keys [][]byte) (string, error) {
+	// Read the encrypted value from the cookie as normal.
+	encryptedValue, err := Read(r, name)
+	if err != nil {
+		return "", err
+	}
+
+	// Try to decrypt the value with each key in turn, so that cookies written with a key
+	// which has since been rotated out of first place can still be read.
+	for _, key := range keys {
+		aesGCM, err := newGCM(key)
+		if err != nil {
+			return "", err
+		}
+
+		// Avoid an 'index out of range' panic when splitting off the nonce.
+		nonceSize := aesGCM.NonceSize()
+		if len(encryptedValue) < nonceSize {
+			return "", ErrInvalidValue
+		}
+
+		// Split apart the nonce and the encrypted data, and decrypt it. Open fails if the
+		// value was encrypted with another key, or has been tampered with.
+		nonce := encryptedValue[:nonceSize]
+		ciphertext := encryptedValue[nonceSize:]
+		plaintext, err := aesGCM.Open(nil, []byte(nonce), []byte(ciphertext), []byte(name))
+		if err == nil {
+			return string(plaintext), nil
+		}
+	}
+
+	return "", ErrInvalidValue
+}
+
+// newGCM returns an AES-GCM cipher for the key, which must be 16, 24 or 32 bytes long.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
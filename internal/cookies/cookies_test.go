@@ -0,0 +1,102 @@
+package cookies
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// roundTrip writes the cookie with write and returns a request carrying it.
+func roundTrip(t *testing.T, write func(w http.ResponseWriter) error) *http.Request {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	if err := write(w); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestEncrypted(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	otherKey := bytes.Repeat([]byte{3}, 32)
+
+	tests := []struct {
+		name      string
+		writeKeys [][]byte
+		readKeys  [][]byte
+		wantErr   error
+	}{
+		{"Same key", [][]byte{newKey}, [][]byte{newKey}, nil},
+		{"Rotated key", [][]byte{oldKey}, [][]byte{newKey, oldKey}, nil},
+		{"Removed key", [][]byte{oldKey}, [][]byte{newKey}, ErrInvalidValue},
+		{"Unknown key", [][]byte{otherKey}, [][]byte{newKey, oldKey}, ErrInvalidValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := roundTrip(t, func(w http.ResponseWriter) error {
+				return WriteEncrypted(w, http.Cookie{Name: "session", Value: "secret value"}, tt.writeKeys)
+			})
+
+			value, err := ReadEncrypted(r, "session", tt.readKeys)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if err == nil && value != "secret value" {
+				t.Errorf("got value %q; want %q", value, "secret value")
+			}
+		})
+	}
+}
+
+func TestEncryptedHidesValue(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	r := roundTrip(t, func(w http.ResponseWriter) error {
+		return WriteEncrypted(w, http.Cookie{Name: "session", Value: "secret value"}, [][]byte{key})
+	})
+
+	value, err := Read(r, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains([]byte(value), []byte("secret value")) {
+		t.Error("encrypted cookie contains the plaintext value")
+	}
+}
+
+func TestEncryptedRenamed(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	w := httptest.NewRecorder()
+	err := WriteEncrypted(w, http.Cookie{Name: "session", Value: "secret value"}, [][]byte{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Move the encrypted value into a cookie with another name.
+	cookie := w.Result().Cookies()[0]
+	cookie.Name = "other"
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+
+	if _, err := ReadEncrypted(r, "other", [][]byte{key}); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("got error %v; want %v", err, ErrInvalidValue)
+	}
+}
+
+func TestWriteEncryptedNoKeys(t *testing.T) {
+	err := WriteEncrypted(httptest.NewRecorder(), http.Cookie{Name: "session"}, nil)
+	if !errors.Is(err, ErrNoKeys) {
+		t.Errorf("got error %v; want %v", err, ErrNoKeys)
+	}
+}
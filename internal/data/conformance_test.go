@@ -0,0 +1,318 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// forEachBackend runs fn against empty models of every storage backend, so that the backends are
+// held to the same behaviour. MongoDB and PostgreSQL are skipped unless MONGOURILOCAL and
+// POSTGRESURILOCAL are set.
+func forEachBackend(t *testing.T, fn func(t *testing.T, m Models)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemoryModels())
+	})
+
+	t.Run("mongo", func(t *testing.T) {
+		if os.Getenv("MONGOURILOCAL") == "" {
+			t.Skip("MONGOURILOCAL not set")
+		}
+		db, teardown := newTestDB(t)
+		defer teardown()
+		fn(t, NewTestModels(db))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		if os.Getenv("POSTGRESURILOCAL") == "" {
+			t.Skip("POSTGRESURILOCAL not set")
+		}
+		db, teardown := newTestPostgres(t)
+		defer teardown()
+		fn(t, NewPostgresModels(db, DefaultQueryTimeout))
+	})
+}
+
+func newTestUser(t *testing.T, m Models, email string, points int) string {
+	t.Helper()
+
+	user := &User{
+		Name:      "Test User",
+		Email:     email,
+		Addresses: []Address{},
+		Phone:     []Phone{},
+		Vouchers:  map[string]int{},
+		Points:    points,
+		Version:   1,
+	}
+	if err := user.Password.Set("password"); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := m.Users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestConformanceUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m Models) {
+		ctx := context.Background()
+		id := newTestUser(t, m, "test@example.com", 0)
+
+		_, err := m.Users.Insert(ctx, &User{Email: "test@example.com"})
+		if !errors.Is(err, ErrDuplicateEmail) {
+			t.Errorf("Insert with a duplicate email: got error %v; want %v", err, ErrDuplicateEmail)
+		}
+
+		for _, id := range []string{"invalid", newID()} {
+			if _, err := m.Users.Get(ctx, id); !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("Get(%q): got error %v; want %v", id, err, ErrRecordNotFound)
+			}
+		}
+
+		err = m.Users.RedeemVoucher(ctx, id, "code", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.Users.RedeemVoucher(ctx, id, "code", 1)
+		if !errors.Is(err, ErrVoucherAlreadyRedeeemed) {
+			t.Errorf("RedeemVoucher twice: got error %v; want %v", err, ErrVoucherAlreadyRedeeemed)
+		}
+
+		// Changing a returned user mustn't change the stored one.
+		user, err := m.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.Vouchers["code"] = 100
+		user, err = m.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Vouchers["code"] != 1 {
+			t.Errorf("got %d uses of the voucher; want 1", user.Vouchers["code"])
+		}
+		if user.Password.plaintext != nil {
+			t.Error("the plaintext password was stored")
+		}
+
+		// Granting a role twice grants it once.
+		for i := 0; i < 2; i++ {
+			if err := m.Users.AddRole(ctx, id, RoleAdmin); err != nil {
+				t.Fatal(err)
+			}
+		}
+		user, err = m.Users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(user.Roles) != 1 || !user.HasRole(RoleAdmin) {
+			t.Errorf("got roles %v; want only %q", user.Roles, RoleAdmin)
+		}
+
+		err = m.Users.UseMFAStep(ctx, id, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = m.Users.UseMFAStep(ctx, id, 10)
+		if !errors.Is(err, ErrMFACodeReused) {
+			t.Errorf("UseMFAStep twice: got error %v; want %v", err, ErrMFACodeReused)
+		}
+	})
+}
+
+func TestConformanceDeductPointsAndCreateVoucher(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m Models) {
+		ctx := context.Background()
+		id := newTestUser(t, m, "test@example.com", 100)
+
+		err := m.Vouchers.Insert(ctx, &Voucher{Code: "taken"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name       string
+			points     int
+			code       string
+			wantErr    error
+			wantPoints int
+		}{
+			{"Not enough points", 200, "first", ErrExchangePointsForVoucher, 100},
+			{"Existing voucher", 50, "taken", ErrVoucherAlreadyExists, 100},
+			{"Valid", 50, "first", nil, 50},
+			{"Already owned", 10, "first", ErrExchangePointsForVoucher, 50},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := m.Users.DeductPointsAndCreateVoucher(ctx, id, tt.points, &Voucher{Code: tt.code})
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %v; want %v", err, tt.wantErr)
+				}
+
+				// A failed exchange must leave the points untouched.
+				points, err := m.Users.GetPoints(ctx, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if points != tt.wantPoints {
+					t.Errorf("got %d points; want %d", points, tt.wantPoints)
+				}
+			})
+		}
+
+		if _, err := m.Vouchers.Get(ctx, "first"); err != nil {
+			t.Errorf("the exchanged voucher wasn't created: %v", err)
+		}
+	})
+}
+
+func TestConformanceAddPoints(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m Models) {
+		ctx := context.Background()
+		id := newTestUser(t, m, "test@example.com", 50)
+
+		tests := []struct {
+			name       string
+			points     int
+			wantErr    error
+			wantPoints int
+		}{
+			{"Add", 30, nil, 80},
+			{"Remove too many", -100, ErrInsufficientPoints, 80},
+			{"Remove", -30, nil, 50},
+			{"Remove all", -50, nil, 0},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := m.Users.AddPoints(ctx, id, tt.points)
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %v; want %v", err, tt.wantErr)
+				}
+
+				points, err := m.Users.GetPoints(ctx, id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if points != tt.wantPoints {
+					t.Errorf("got %d points; want %d", points, tt.wantPoints)
+				}
+			})
+		}
+
+		// Adding points to an unknown user isn't an error.
+		if err := m.Users.AddPoints(ctx, newID(), 10); err != nil {
+			t.Errorf("AddPoints to an unknown user: got error %v; want nil", err)
+		}
+	})
+}
+
+func TestConformanceDeductPointsConcurrently(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m Models) {
+		ctx := context.Background()
+		id := newTestUser(t, m, "test@example.com", 50)
+
+		// Only five of the exchanges can be paid for.
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		succeeded := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				voucher := &Voucher{}
+				if err := voucher.VocuherCodeGenerator(); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := m.Users.DeductPointsAndCreateVoucher(ctx, id, 10, voucher); err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		// MongoDB aborts conflicting transactions instead of waiting for them, so fewer exchanges
+		// may succeed there, but points must never be spent twice.
+		if succeeded > 5 {
+			t.Errorf("got %d successful exchanges; want at most 5", succeeded)
+		}
+		points, err := m.Users.GetPoints(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if points != 50-10*succeeded {
+			t.Errorf("got %d points after %d exchanges; want %d", points, succeeded, 50-10*succeeded)
+		}
+	})
+}
+
+func TestConformanceUpdateUsageCount(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m Models) {
+		ctx := context.Background()
+
+		err := m.Vouchers.Insert(ctx, &Voucher{Code: "code", Active: true, UsageLimit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantErrs := []error{nil, nil, ErrRecordNotFound}
+		for i, wantErr := range wantErrs {
+			if err := m.Vouchers.UpdateUsageCount(ctx, "code"); !errors.Is(err, wantErr) {
+				t.Errorf("use %d: got error %v; want %v", i+1, err, wantErr)
+			}
+		}
+
+		voucher, err := m.Vouchers.Get(ctx, "code")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if voucher.UsageCount != 2 || voucher.Active {
+			t.Errorf("got usage count %d and active %t; want 2 and false", voucher.UsageCount, voucher.Active)
+		}
+
+		if err := m.Vouchers.Deactivate(ctx, "unknown"); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("Deactivate of an unknown voucher: got error %v; want %v", err, ErrRecordNotFound)
+		}
+	})
+}
+
+func TestConformanceSessions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m Models) {
+		ctx := context.Background()
+
+		now := time.Now()
+		id, err := m.Sessions.Insert(ctx, &Session{UserID: "user", ExpiresAt: now.Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expired, err := m.Sessions.Insert(ctx, &Session{UserID: "user", ExpiresAt: now.Add(-time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := m.Sessions.Get(ctx, expired); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("Get of an expired session: got error %v; want %v", err, ErrRecordNotFound)
+		}
+		if err := m.Sessions.Delete(ctx, "other", id); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf("Delete of another user's session: got error %v; want %v", err, ErrRecordNotFound)
+		}
+
+		sessions, err := m.Sessions.GetAllForUser(ctx, "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 1 || sessions[0].ID != id {
+			t.Errorf("got sessions %v; want only %s", sessions, id)
+		}
+	})
+}
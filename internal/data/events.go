@@ -0,0 +1,51 @@
+package data
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Insert inserts a new record in the events collection and sets the ID of the event.
+func (m EventModel) Insert(ctx context.Context, event *Event) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.Collection("events").InsertOne(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	event.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	return nil
+}
+
+// GetAllForUser returns every event recorded for the user, newest first.
+func (m EventModel) GetAllForUser(ctx context.Context, userID string) ([]Event, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Execute the find operation sorted by creation time in descending order.
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := m.DB.Collection("events").Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// Decode the results into a slice of Events.
+	events := []Event{}
+	for cursor.Next(ctx) {
+		var event Event
+		if err = cursor.Decode(&event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,34 @@
+package data
+
+import "context"
+
+// MemoryEventModel is the in-memory implementation of the Events model.
+type MemoryEventModel struct {
+	store *memoryStore
+}
+
+func (m MemoryEventModel) Insert(ctx context.Context, event *Event) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	event.ID = newID()
+	m.store.events = append(m.store.events, copyEvent(event))
+
+	return nil
+}
+
+func (m MemoryEventModel) GetAllForUser(ctx context.Context, userID string) ([]Event, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	// Events are appended in the order they are inserted, so walk them backwards to return the
+	// newest first.
+	events := []Event{}
+	for i := len(m.store.events) - 1; i >= 0; i-- {
+		if event := m.store.events[i]; event.UserID == userID {
+			events = append(events, *copyEvent(event))
+		}
+	}
+
+	return events, nil
+}
@@ -0,0 +1,21 @@
+package data
+
+import "context"
+
+type MockEventModel struct{}
+
+func (m MockEventModel) Insert(ctx context.Context, event *Event) error {
+	return nil
+}
+
+func (m MockEventModel) GetAllForUser(ctx context.Context, userID string) ([]Event, error) {
+	switch userID {
+	case "testID":
+		return []Event{
+			{ID: "pointsID", UserID: userID, Type: EventPointsEarned, Properties: map[string]string{"points": "10"}},
+			{ID: "lockedID", UserID: userID, Type: EventAccountLocked},
+		}, nil
+	default:
+		return nil, nil
+	}
+}
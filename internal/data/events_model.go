@@ -0,0 +1,44 @@
+package data
+
+import (
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Event types written to the events collection. Besides security events, the points earned and
+// spent by the user are recorded, which make up their point history.
+const (
+	EventAccountLocked     = "account_locked"
+	EventAccountUnlocked   = "account_unlocked"
+	EventMFAEnabled        = "mfa_enabled"
+	EventMFADisabled       = "mfa_disabled"
+	EventIdentityLinked    = "identity_linked"
+	EventDeletionRequested = "deletion_requested"
+	EventDeletionCancelled = "deletion_cancelled"
+	EventAccountDeleted    = "account_deleted"
+	EventPointsEarned      = "points_earned"
+	EventPointsSpent       = "points_spent"
+	EventRoleGranted       = "role_granted"
+	EventPointsAdjusted    = "points_adjusted"
+)
+
+// Event type whose fields describe a security-relevant event for a user, such as an account
+// being locked after too many failed login attempts.
+type Event struct {
+	ID         string            `json:"id" bson:"_id,omitempty"`
+	UserID     string            `json:"userId" bson:"user_id"`
+	Type       string            `json:"type" bson:"type"`
+	CreatedAt  time.Time         `json:"createdAt" bson:"created_at"`
+	Properties map[string]string `json:"properties,omitempty" bson:"properties,omitempty"`
+}
+
+// EventModel struct wraps the DB and allows us to work with the Event struct type
+// and the events collection in our database.
+type EventModel struct {
+	DB       *mongo.Database
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	Timeout  time.Duration
+}
@@ -0,0 +1,77 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// PostgresEventModel is the PostgreSQL implementation of the Events model.
+type PostgresEventModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	Timeout  time.Duration
+}
+
+func (m PostgresEventModel) Insert(ctx context.Context, event *Event) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Events without properties store NULL, as the properties are left out in MongoDB.
+	var properties sql.NullString
+	if len(event.Properties) > 0 {
+		js, err := json.Marshal(event.Properties)
+		if err != nil {
+			return err
+		}
+		properties = sql.NullString{String: string(js), Valid: true}
+	}
+
+	id := newID()
+	_, err := m.DB.ExecContext(ctx, `
+		INSERT INTO events (id, user_id, type, created_at, properties)
+		VALUES ($1, $2, $3, $4, $5)`,
+		id, event.UserID, event.Type, event.CreatedAt, properties)
+	if err != nil {
+		return err
+	}
+
+	event.ID = id
+	return nil
+}
+
+func (m PostgresEventModel) GetAllForUser(ctx context.Context, userID string) ([]Event, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT id, user_id, type, created_at, properties FROM events
+		WHERE user_id = $1
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		var properties []byte
+		if err = rows.Scan(&event.ID, &event.UserID, &event.Type, &event.CreatedAt, &properties); err != nil {
+			return nil, err
+		}
+		if properties != nil {
+			if err = json.Unmarshal(properties, &event.Properties); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
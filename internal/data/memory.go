@@ -0,0 +1,81 @@
+package data
+
+import (
+	"maps"
+	"slices"
+	"sync"
+)
+
+// memoryStore holds the records of the in-memory backend. A single mutex guards every collection,
+// so that operations which span collections, such as DeductPointsAndCreateVoucher, are atomic in
+// the same way as a MongoDB transaction.
+type memoryStore struct {
+	mu        sync.RWMutex
+	users     map[string]*User
+	vouchers  map[string]*Voucher
+	events    []*Event
+	merchants map[string]*Merchant
+	keys      map[string]*APIKey
+	sessions  map[string]*Session
+}
+
+// NewMemoryModels returns models which keep every record in memory. They behave like the MongoDB
+// models, including their errors, so the API can run without a database, but all data is lost
+// when the process exits.
+func NewMemoryModels() Models {
+	store := &memoryStore{
+		users:     make(map[string]*User),
+		vouchers:  make(map[string]*Voucher),
+		merchants: make(map[string]*Merchant),
+		keys:      make(map[string]*APIKey),
+		sessions:  make(map[string]*Session),
+	}
+
+	return Models{
+		Vouchers:  MemoryVoucherModel{store: store},
+		Users:     MemoryUserModel{store: store},
+		Events:    MemoryEventModel{store: store},
+		Merchants: MemoryMerchantModel{store: store},
+		Sessions:  MemorySessionModel{store: store},
+	}
+}
+
+// The copy functions below make sure that callers never share maps or slices with the store, as
+// they wouldn't with records decoded from MongoDB.
+
+func copyUser(user *User) *User {
+	c := *user
+	// The plaintext password is never stored, only its hash.
+	c.Password = Password{Hash: slices.Clone(user.Password.Hash)}
+	c.Addresses = slices.Clone(user.Addresses)
+	c.Phone = slices.Clone(user.Phone)
+	c.Identities = slices.Clone(user.Identities)
+	c.Roles = slices.Clone(user.Roles)
+	c.Vouchers = maps.Clone(user.Vouchers)
+	c.MFA.RecoveryCodes = cloneByteSlices(user.MFA.RecoveryCodes)
+	return &c
+}
+
+func copyEvent(event *Event) *Event {
+	c := *event
+	c.Properties = maps.Clone(event.Properties)
+	return &c
+}
+
+func copyAPIKey(key *APIKey) *APIKey {
+	c := *key
+	c.Hash = slices.Clone(key.Hash)
+	c.Scopes = slices.Clone(key.Scopes)
+	return &c
+}
+
+func cloneByteSlices(s [][]byte) [][]byte {
+	if s == nil {
+		return nil
+	}
+	c := make([][]byte, len(s))
+	for i, b := range s {
+		c[i] = slices.Clone(b)
+	}
+	return c
+}
@@ -0,0 +1,187 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Insert inserts a new record in the merchants collection and returns its ID.
+func (m MerchantModel) Insert(ctx context.Context, merchant *Merchant) (string, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.Collection("merchants").InsertOne(ctx, merchant)
+	if err != nil {
+		return "", err
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get returns a specific Merchant based on its id.
+func (m MerchantModel) Get(ctx context.Context, id string) (*Merchant, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Convert the id string to a MongoDB ObjectId.
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	// Execute the find operation
+	var merchant Merchant
+	err = m.DB.Collection("merchants").FindOne(ctx, bson.M{"_id": oid}).Decode(&merchant)
+	if err != nil {
+		// If the error is a NoDocument error, return ErrRecordNotFound
+		switch {
+		case err == mongo.ErrNoDocuments:
+			return nil, ErrRecordNotFound
+		default:
+			// Otherwise, return the error
+			return nil, err
+		}
+	}
+
+	return &merchant, nil
+}
+
+// GetAll returns every merchant sorted by name.
+func (m MerchantModel) GetAll(ctx context.Context) ([]Merchant, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := m.DB.Collection("merchants").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// Decode the results into a slice of Merchants.
+	merchants := []Merchant{}
+	for cursor.Next(ctx) {
+		var merchant Merchant
+		if err = cursor.Decode(&merchant); err != nil {
+			return nil, err
+		}
+		merchants = append(merchants, merchant)
+	}
+
+	return merchants, nil
+}
+
+// InsertKey inserts a new record in the api_keys collection.
+func (m MerchantModel) InsertKey(ctx context.Context, key *APIKey) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.Collection("api_keys").InsertOne(ctx, key)
+	return err
+}
+
+// GetKey returns a specific APIKey based on its id, including revoked keys.
+func (m MerchantModel) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Execute the find operation
+	var key APIKey
+	err := m.DB.Collection("api_keys").FindOne(ctx, bson.M{"_id": id}).Decode(&key)
+	if err != nil {
+		// If the error is a NoDocument error, return ErrRecordNotFound
+		switch {
+		case err == mongo.ErrNoDocuments:
+			return nil, ErrRecordNotFound
+		default:
+			// Otherwise, return the error
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// GetKeys returns every API key of the merchant, newest first.
+func (m MerchantModel) GetKeys(ctx context.Context, merchantID string) ([]APIKey, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := m.DB.Collection("api_keys").Find(ctx, bson.M{"merchant_id": merchantID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// Decode the results into a slice of APIKeys.
+	keys := []APIKey{}
+	for cursor.Next(ctx) {
+		var key APIKey
+		if err = cursor.Decode(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// RevokeKey marks an unrevoked API key of the merchant as revoked. It returns ErrRecordNotFound
+// if the merchant has no such key or it was already revoked.
+func (m MerchantModel) RevokeKey(ctx context.Context, merchantID string, id string, at time.Time) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Define the filter to match an unrevoked key belonging to the merchant.
+	filter := bson.M{"_id": id, "merchant_id": merchantID, "revoked_at": bson.M{"$exists": false}}
+
+	// Define the update document to set the new values of the fields.
+	update := bson.M{
+		"$set": bson.M{
+			"revoked_at": at,
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("api_keys").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// TouchKey records the time at which the API key was last used.
+func (m MerchantModel) TouchKey(ctx context.Context, id string, at time.Time) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Define the update document to set the new values of the fields.
+	update := bson.M{
+		"$set": bson.M{
+			"last_used_at": at,
+		},
+	}
+
+	// Execute the update operation.
+	_, err := m.DB.Collection("api_keys").UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
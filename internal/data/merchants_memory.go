@@ -0,0 +1,122 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MemoryMerchantModel is the in-memory implementation of the Merchants model. Its methods return
+// the same errors as those of MerchantModel in the same situations.
+type MemoryMerchantModel struct {
+	store *memoryStore
+}
+
+func (m MemoryMerchantModel) Insert(ctx context.Context, merchant *Merchant) (string, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	stored := *merchant
+	stored.ID = newID()
+	m.store.merchants[stored.ID] = &stored
+
+	return stored.ID, nil
+}
+
+func (m MemoryMerchantModel) Get(ctx context.Context, id string) (*Merchant, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	merchant, ok := m.store.merchants[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	c := *merchant
+	return &c, nil
+}
+
+func (m MemoryMerchantModel) GetAll(ctx context.Context) ([]Merchant, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	merchants := []Merchant{}
+	for _, merchant := range m.store.merchants {
+		merchants = append(merchants, *merchant)
+	}
+
+	slices.SortFunc(merchants, func(a, b Merchant) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return merchants, nil
+}
+
+func (m MemoryMerchantModel) InsertKey(ctx context.Context, key *APIKey) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.keys[key.ID]; ok {
+		return errors.New("an api key with the provided id already exists")
+	}
+	m.store.keys[key.ID] = copyAPIKey(key)
+
+	return nil
+}
+
+func (m MemoryMerchantModel) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	key, ok := m.store.keys[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyAPIKey(key), nil
+}
+
+func (m MemoryMerchantModel) GetKeys(ctx context.Context, merchantID string) ([]APIKey, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	keys := []APIKey{}
+	for _, key := range m.store.keys {
+		if key.MerchantID == merchantID {
+			keys = append(keys, *copyAPIKey(key))
+		}
+	}
+
+	// Return the newest keys first.
+	slices.SortFunc(keys, func(a, b APIKey) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (m MemoryMerchantModel) RevokeKey(ctx context.Context, merchantID string, id string, at time.Time) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	key, ok := m.store.keys[id]
+	if !ok || key.MerchantID != merchantID || key.IsRevoked() {
+		return ErrRecordNotFound
+	}
+	key.RevokedAt = at
+
+	return nil
+}
+
+func (m MemoryMerchantModel) TouchKey(ctx context.Context, id string, at time.Time) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if key, ok := m.store.keys[id]; ok {
+		key.LastUsedAt = at
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+type MockMerchantModel struct{}
+
+func (m MockMerchantModel) Insert(ctx context.Context, merchant *Merchant) (string, error) {
+	return "testID", nil
+}
+
+func (m MockMerchantModel) Get(ctx context.Context, id string) (*Merchant, error) {
+	return nil, ErrRecordNotFound
+}
+
+func (m MockMerchantModel) GetAll(ctx context.Context) ([]Merchant, error) {
+	return nil, nil
+}
+
+func (m MockMerchantModel) InsertKey(ctx context.Context, key *APIKey) error {
+	return nil
+}
+
+func (m MockMerchantModel) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	return nil, ErrRecordNotFound
+}
+
+func (m MockMerchantModel) GetKeys(ctx context.Context, merchantID string) ([]APIKey, error) {
+	return nil, nil
+}
+
+func (m MockMerchantModel) RevokeKey(ctx context.Context, merchantID string, id string, at time.Time) error {
+	return nil
+}
+
+func (m MockMerchantModel) TouchKey(ctx context.Context, id string, at time.Time) error {
+	return nil
+}
@@ -0,0 +1,147 @@
+package data
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/toduluz/savingsquadsbackend/internal/validator"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Scopes which can be granted to a merchant API key.
+const (
+	ScopeVouchersValidate = "vouchers:validate"
+	ScopeVouchersUse      = "vouchers:use"
+	ScopePointsEarn       = "points:earn"
+)
+
+// Scopes is the list of every scope which can be granted to a merchant API key.
+var Scopes = []string{ScopeVouchersValidate, ScopeVouchersUse, ScopePointsEarn}
+
+// apiKeyPrefix is prepended to every API key so that keys are recognisable (for example by
+// secret scanners) and can be told apart from JWTs in the Authorization header.
+const apiKeyPrefix = "ssk_"
+
+// Merchant type whose fields describe a merchant, such as a POS or e-commerce backend, which
+// integrates with the API using API keys.
+type Merchant struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	CreatedAt time.Time `json:"-" bson:"created_at"`
+	UpdatedAt time.Time `json:"-" bson:"updated_at"`
+	Name      string    `json:"name" bson:"name"`
+	Active    bool      `json:"active" bson:"active"`
+	Version   int       `json:"version" bson:"version"`
+}
+
+// APIKey type whose fields describe an API key of a merchant. Only the SHA-256 hash of the key
+// is stored; the ID is the public part of the key which is used to look it up.
+type APIKey struct {
+	ID         string    `json:"id" bson:"_id"`
+	MerchantID string    `json:"merchantId" bson:"merchant_id"`
+	Hash       []byte    `json:"-" bson:"hash"`
+	Scopes     []string  `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time `json:"createdAt" bson:"created_at"`
+	LastUsedAt time.Time `json:"lastUsedAt,omitempty" bson:"last_used_at,omitempty"`
+	RevokedAt  time.Time `json:"revokedAt,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// MerchantModel struct wraps the DB and allows us to work with the Merchant and APIKey struct
+// types and the merchants and api_keys collections in our database.
+type MerchantModel struct {
+	DB       *mongo.Database
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	Timeout  time.Duration
+}
+
+// GenerateAPIKey returns a new API key for the merchant with the given scopes. The plaintext key
+// has the format "ssk_{id}_{secret}" and is only ever available at this point.
+func GenerateAPIKey(merchantID string, scopes []string) (string, *APIKey, error) {
+	id, err := randomString(12)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return "", nil, err
+	}
+
+	plaintext := apiKeyPrefix + id + "_" + secret
+	hash := sha256.Sum256([]byte(plaintext))
+
+	key := &APIKey{
+		ID:         id,
+		MerchantID: merchantID,
+		Hash:       hash[:],
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+	}
+
+	return plaintext, key, nil
+}
+
+// ParseAPIKey extracts the ID from a plaintext API key. It returns false if the token doesn't
+// look like an API key at all.
+func ParseAPIKey(plaintext string) (string, bool) {
+	if !strings.HasPrefix(plaintext, apiKeyPrefix) {
+		return "", false
+	}
+	id, _, ok := strings.Cut(strings.TrimPrefix(plaintext, apiKeyPrefix), "_")
+	if !ok || id == "" {
+		return "", false
+	}
+	return id, true
+}
+
+// Matches reports whether the plaintext key hashes to the stored hash, using a constant-time
+// comparison.
+func (k *APIKey) Matches(plaintext string) bool {
+	hash := sha256.Sum256([]byte(plaintext))
+	return subtle.ConstantTimeCompare(hash[:], k.Hash) == 1
+}
+
+// IsRevoked reports whether the API key has been revoked.
+func (k *APIKey) IsRevoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// HasScope reports whether the API key has been granted the scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return validator.In(scope, k.Scopes...)
+}
+
+// randomString returns a cryptographically random string of lowercase letters and digits.
+func randomString(n int) (string, error) {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+	b := make([]byte, n)
+	for i := range b {
+		randNum, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = letters[randNum.Int64()]
+	}
+
+	return string(b), nil
+}
+
+// ValidateMerchant runs validation checks on the Merchant type.
+func ValidateMerchant(v *validator.Validator, merchant *Merchant) {
+	v.Check(merchant.Name != "", "name", "must be provided")
+	v.Check(len(merchant.Name) <= 500, "name", "must not be more than 500 bytes long")
+}
+
+// ValidateScopes checks that at least one scope is given and that every scope is known.
+func ValidateScopes(v *validator.Validator, scopes []string) {
+	v.Check(len(scopes) > 0, "scopes", "must contain at least one scope")
+	v.Check(validator.Unique(scopes), "scopes", "must not contain duplicate values")
+	for _, scope := range scopes {
+		v.Check(validator.In(scope, Scopes...), "scopes", "must only contain "+strings.Join(Scopes, ", "))
+	}
+}
@@ -0,0 +1,188 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresMerchantModel is the PostgreSQL implementation of the Merchants model. Its methods
+// return the same errors as those of MerchantModel in the same situations.
+type PostgresMerchantModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	Timeout  time.Duration
+}
+
+func (m PostgresMerchantModel) Insert(ctx context.Context, merchant *Merchant) (string, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	id := newID()
+	_, err := m.DB.ExecContext(ctx, `
+		INSERT INTO merchants (id, created_at, updated_at, name, active, version)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		id, merchant.CreatedAt, merchant.UpdatedAt, merchant.Name, merchant.Active, merchant.Version)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (m PostgresMerchantModel) Get(ctx context.Context, id string) (*Merchant, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var merchant Merchant
+	err := m.DB.QueryRowContext(ctx, `
+		SELECT id, created_at, updated_at, name, active, version FROM merchants
+		WHERE id = $1`, id).Scan(
+		&merchant.ID, &merchant.CreatedAt, &merchant.UpdatedAt, &merchant.Name, &merchant.Active,
+		&merchant.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &merchant, nil
+}
+
+func (m PostgresMerchantModel) GetAll(ctx context.Context) ([]Merchant, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		SELECT id, created_at, updated_at, name, active, version FROM merchants
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	merchants := []Merchant{}
+	for rows.Next() {
+		var merchant Merchant
+		err = rows.Scan(&merchant.ID, &merchant.CreatedAt, &merchant.UpdatedAt, &merchant.Name,
+			&merchant.Active, &merchant.Version)
+		if err != nil {
+			return nil, err
+		}
+		merchants = append(merchants, merchant)
+	}
+
+	return merchants, rows.Err()
+}
+
+// apiKeyColumns lists the columns of an API key in the order expected by scanAPIKey.
+const apiKeyColumns = `id, merchant_id, hash, scopes, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (*APIKey, error) {
+	var key APIKey
+	var lastUsed, revoked sql.NullTime
+	err := row.Scan(&key.ID, &key.MerchantID, &key.Hash, (*pq.StringArray)(&key.Scopes),
+		&key.CreatedAt, &lastUsed, &revoked)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	key.LastUsedAt = lastUsed.Time
+	key.RevokedAt = revoked.Time
+
+	return &key, nil
+}
+
+func (m PostgresMerchantModel) InsertKey(ctx context.Context, key *APIKey) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `INSERT INTO api_keys (`+apiKeyColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		key.ID, key.MerchantID, key.Hash, pq.StringArray(nonNil(key.Scopes)), key.CreatedAt,
+		nullTime(key.LastUsedAt), nullTime(key.RevokedAt))
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "api_keys_pkey"):
+			return errors.New("an api key with the provided id already exists")
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m PostgresMerchantModel) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return scanAPIKey(m.DB.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id))
+}
+
+func (m PostgresMerchantModel) GetKeys(ctx context.Context, merchantID string) ([]APIKey, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE merchant_id = $1
+		ORDER BY created_at DESC`, merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (m PostgresMerchantModel) RevokeKey(ctx context.Context, merchantID string, id string, at time.Time) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = $3
+		WHERE id = $1 AND merchant_id = $2 AND revoked_at IS NULL`, id, merchantID, at)
+	if err != nil {
+		return err
+	}
+
+	return rowsAffected(result)
+}
+
+func (m PostgresMerchantModel) TouchKey(ctx context.Context, id string, at time.Time) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, at)
+	return err
+}
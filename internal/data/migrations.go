@@ -0,0 +1,305 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is a change to the MongoDB schema, such as creating an index or backfilling a field
+// which was added to a model. Migrations only go up: once released, a migration must never be
+// changed or removed, and further changes go in a new migration with the next version. Indexes
+// and updates are described by data, so that the checksum of the migration covers them. Changes
+// which they can't describe, such as a backfill computed in Go, go in Up.
+type Migration struct {
+	Version int    `bson:"version"`
+	Name    string `bson:"name"`
+	// Indexes are created first, then the Updates are run in order, then Up is called.
+	Indexes []MigrationIndex  `bson:"indexes"`
+	Updates []MigrationUpdate `bson:"updates"`
+	// Up makes the changes which indexes and updates can't describe. Code can't be hashed, so
+	// UpVersion stands in for Up in the checksum: it must be set whenever Up is, and changed
+	// whenever Up is.
+	Up        func(ctx context.Context, db *mongo.Database) error `bson:"-"`
+	UpVersion string                                              `bson:"up_version,omitempty"`
+}
+
+// MigrationIndex is an index which a migration creates. Index names are left to MongoDB, so that
+// indexes created before migrations existed are recognised.
+type MigrationIndex struct {
+	Collection string `bson:"collection"`
+	Keys       bson.D `bson:"keys"`
+	Unique     bool   `bson:"unique"`
+	Sparse     bool   `bson:"sparse"`
+	// TTL makes MongoDB remove documents once the time in the indexed field has passed.
+	TTL bool `bson:"ttl"`
+}
+
+// MigrationUpdate is an update which a migration runs on every document matching the filter.
+// Filters and updates are bson.D rather than bson.M, so that their encoding is stable.
+type MigrationUpdate struct {
+	Collection string `bson:"collection"`
+	Filter     bson.D `bson:"filter"`
+	Update     bson.D `bson:"update"`
+}
+
+// ErrMigrationUpVersion is returned for a migration which has an Up function but no UpVersion.
+var ErrMigrationUpVersion = errors.New("migration has an Up function but no UpVersion")
+
+// Apply applies the migration to the database.
+func (m Migration) Apply(ctx context.Context, db *mongo.Database) error {
+	if m.Up != nil && m.UpVersion == "" {
+		return ErrMigrationUpVersion
+	}
+
+	for _, index := range m.Indexes {
+		opts := options.Index()
+		if index.Unique {
+			opts.SetUnique(true)
+		}
+		if index.Sparse {
+			opts.SetSparse(true)
+		}
+		if index.TTL {
+			opts.SetExpireAfterSeconds(0)
+		}
+
+		model := mongo.IndexModel{Keys: index.Keys, Options: opts}
+		_, err := db.Collection(index.Collection).Indexes().CreateOne(ctx, model)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, update := range m.Updates {
+		_, err := db.Collection(update.Collection).UpdateMany(ctx, update.Filter, update.Update)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.Up != nil {
+		return m.Up(ctx, db)
+	}
+
+	return nil
+}
+
+// Checksum is a hash of the BSON encoding of the migration, so it changes with its indexes,
+// updates and UpVersion. A migration which was applied under another checksum has been changed since,
+// which MigrateMongo refuses to run with. It panics if the migration can't be encoded, which is
+// a mistake in MongoMigrations.
+func (m Migration) Checksum() string {
+	b, err := bson.Marshal(m)
+	if err != nil {
+		panic(fmt.Sprintf("migration %d (%s): %v", m.Version, m.Name, err))
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// AppliedMigration is the record of a migration in the migrations collection.
+type AppliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	Checksum  string    `bson:"checksum"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// ErrMigrationLocked is returned when another process held the migration lock for the whole time
+// MigrateMongo was allowed to wait for it.
+var ErrMigrationLocked = errors.New("migrations are locked by another process")
+
+// migrationLockTimeout is how long the migration lock is held at most. A lock older than this is
+// assumed to have been left behind by a process which crashed, and is taken over.
+const migrationLockTimeout = 10 * time.Minute
+
+// MongoMigrations is the ordered list of migrations of the MongoDB database.
+var MongoMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create unique index on users email",
+		Indexes: []MigrationIndex{
+			{Collection: "users", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true},
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create TTL index on sessions expires_at",
+		Indexes: []MigrationIndex{
+			{Collection: "sessions", Keys: bson.D{{Key: "expires_at", Value: 1}}, TTL: true},
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create index on vouchers active, category and expires",
+		Indexes: []MigrationIndex{
+			{
+				Collection: "vouchers",
+				Keys:       bson.D{{Key: "active", Value: 1}, {Key: "category", Value: 1}, {Key: "expires", Value: 1}},
+			},
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create indexes for user lookups",
+		Indexes: []MigrationIndex{
+			{
+				Collection: "users",
+				Keys:       bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+			},
+			{Collection: "users", Keys: bson.D{{Key: "deletion_scheduled_at", Value: 1}}, Sparse: true},
+			{Collection: "sessions", Keys: bson.D{{Key: "user_id", Value: 1}}},
+			{Collection: "events", Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Collection: "api_keys", Keys: bson.D{{Key: "merchant_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+	},
+	{
+		Version: 5,
+		Name:    "backfill users vouchers and mfa",
+		Updates: []MigrationUpdate{
+			// Redeeming a voucher sets a field of the vouchers document, which fails if it is null.
+			{
+				Collection: "users",
+				Filter:     bson.D{{Key: "vouchers", Value: nil}},
+				Update:     bson.D{{Key: "$set", Value: bson.D{{Key: "vouchers", Value: bson.D{}}}}},
+			},
+			// Users created before two-factor authentication have no mfa document, which the
+			// last step check of UseMFAStep never matches.
+			{
+				Collection: "users",
+				Filter:     bson.D{{Key: "mfa", Value: bson.D{{Key: "$exists", Value: false}}}},
+				Update: bson.D{{Key: "$set", Value: bson.D{
+					{Key: "mfa.enabled", Value: false},
+					{Key: "mfa.last_step", Value: 0},
+				}}},
+			},
+		},
+	},
+}
+
+// PendingMigrations checks the applied migrations against the known ones and returns those which
+// haven't been applied yet, in order. It fails if an applied migration is unknown or has changed.
+func PendingMigrations(migrations []Migration, applied []AppliedMigration) ([]Migration, error) {
+	known := make(map[int]Migration, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	done := make(map[int]bool, len(applied))
+	for _, a := range applied {
+		migration, ok := known[a.Version]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("migration %d (%s) was applied but is unknown to this version", a.Version, a.Name)
+		case migration.Checksum() != a.Checksum:
+			return nil, fmt.Errorf("migration %d (%s) has changed since it was applied", a.Version, a.Name)
+		}
+		done[a.Version] = true
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if !done[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// AppliedMongoMigrations returns the migrations which have been applied to the database, in order.
+func AppliedMongoMigrations(ctx context.Context, db *mongo.Database) ([]AppliedMigration, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := db.Collection("migrations").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	applied := []AppliedMigration{}
+	if err = cursor.All(ctx, &applied); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// MigrateMongo applies the migrations in MongoMigrations which haven't been applied to the
+// database yet, in order, and returns them. Only one process migrates at a time; the others wait
+// for the lock until ctx is done. A migration which fails isn't recorded, so it must be safe to
+// run again.
+func MigrateMongo(ctx context.Context, db *mongo.Database) ([]Migration, error) {
+	unlock, err := lockMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := AppliedMongoMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := PendingMigrations(MongoMigrations, applied)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, migration := range pending {
+		if err = migration.Apply(ctx, db); err != nil {
+			return pending[:i], fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Name, err)
+		}
+
+		_, err = db.Collection("migrations").InsertOne(ctx, AppliedMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Checksum:  migration.Checksum(),
+			AppliedAt: time.Now(),
+		})
+		if err != nil {
+			return pending[:i], err
+		}
+	}
+
+	return pending, nil
+}
+
+// lockMigrations takes the migration lock, which is a document in the migration_lock collection,
+// and returns a function which releases it.
+func lockMigrations(ctx context.Context, db *mongo.Database) (func(), error) {
+	locks := db.Collection("migration_lock")
+
+	// The owner makes sure that only the lock this process took is released, even if it was
+	// taken over in the meantime.
+	owner := newID()
+
+	for {
+		// Take the lock if nobody holds it, or if it was left behind. The upsert fails with a
+		// duplicate key error while the lock is held.
+		now := time.Now()
+		filter := bson.M{"_id": "lock", "locked_at": bson.M{"$lt": now.Add(-migrationLockTimeout)}}
+		update := bson.M{"$set": bson.M{"owner": owner, "locked_at": now}}
+		_, err := locks.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err == nil {
+			return func() {
+				locks.DeleteOne(context.Background(), bson.M{"_id": "lock", "owner": owner})
+			}, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ErrMigrationLocked
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,108 @@
+-- Users, with the vouchers they own and the external identities linked to them in their own
+-- tables. Times which are unset in MongoDB are NULL.
+CREATE TABLE users (
+    id                    text PRIMARY KEY,
+    created_at            timestamptz NOT NULL,
+    updated_at            timestamptz NOT NULL,
+    name                  text NOT NULL,
+    email                 text NOT NULL CONSTRAINT users_email_key UNIQUE,
+    password_hash         bytea NOT NULL,
+    addresses             jsonb NOT NULL DEFAULT '[]',
+    phone                 jsonb NOT NULL DEFAULT '[]',
+    points                integer NOT NULL DEFAULT 0,
+    version               integer NOT NULL DEFAULT 1,
+    failed_logins         integer NOT NULL DEFAULT 0,
+    locked_until          timestamptz,
+    mfa_enabled           boolean NOT NULL DEFAULT false,
+    mfa_secret            text NOT NULL DEFAULT '',
+    mfa_pending_secret    text NOT NULL DEFAULT '',
+    mfa_recovery_codes    bytea[] NOT NULL DEFAULT '{}',
+    mfa_last_step         bigint NOT NULL DEFAULT 0,
+    deletion_scheduled_at timestamptz,
+    deleted_at            timestamptz
+);
+
+CREATE INDEX users_deletion_scheduled_at_idx ON users (deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL;
+
+-- Vouchers aren't referenced with a foreign key, since a user keeps the vouchers they own when
+-- an admin deletes the voucher itself.
+CREATE TABLE user_vouchers (
+    user_id   text NOT NULL REFERENCES users ON DELETE CASCADE,
+    code      text NOT NULL,
+    remaining integer NOT NULL,
+    PRIMARY KEY (user_id, code)
+);
+
+CREATE TABLE user_identities (
+    provider  text NOT NULL,
+    subject   text NOT NULL,
+    user_id   text NOT NULL REFERENCES users ON DELETE CASCADE,
+    linked_at timestamptz NOT NULL,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+
+CREATE TABLE vouchers (
+    code          text PRIMARY KEY,
+    created_at    timestamptz NOT NULL,
+    updated_at    timestamptz NOT NULL,
+    description   text NOT NULL,
+    discount      integer NOT NULL,
+    is_percentage boolean NOT NULL,
+    starts        timestamptz NOT NULL,
+    expires       timestamptz NOT NULL,
+    active        boolean NOT NULL,
+    usage_limit   integer NOT NULL,
+    usage_count   integer NOT NULL,
+    min_spend     integer NOT NULL,
+    category      text NOT NULL
+);
+
+CREATE INDEX vouchers_active_category_expires_idx ON vouchers (active, category, expires);
+
+CREATE TABLE events (
+    id         text PRIMARY KEY,
+    user_id    text NOT NULL,
+    type       text NOT NULL,
+    created_at timestamptz NOT NULL,
+    properties jsonb
+);
+
+CREATE INDEX events_user_id_created_at_idx ON events (user_id, created_at DESC);
+
+CREATE TABLE merchants (
+    id         text PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    updated_at timestamptz NOT NULL,
+    name       text NOT NULL,
+    active     boolean NOT NULL,
+    version    integer NOT NULL
+);
+
+CREATE TABLE api_keys (
+    id           text PRIMARY KEY,
+    merchant_id  text NOT NULL REFERENCES merchants ON DELETE CASCADE,
+    hash         bytea NOT NULL,
+    scopes       text[] NOT NULL,
+    created_at   timestamptz NOT NULL,
+    last_used_at timestamptz,
+    revoked_at   timestamptz
+);
+
+CREATE INDEX api_keys_merchant_id_idx ON api_keys (merchant_id, created_at DESC);
+
+CREATE TABLE sessions (
+    id           text PRIMARY KEY,
+    user_id      text NOT NULL,
+    device_name  text NOT NULL,
+    user_agent   text NOT NULL,
+    ip           text NOT NULL,
+    created_at   timestamptz NOT NULL,
+    last_seen_at timestamptz NOT NULL,
+    expires_at   timestamptz NOT NULL
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
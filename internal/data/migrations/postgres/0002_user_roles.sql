@@ -0,0 +1,2 @@
+-- The roles granted to a user, such as admin.
+ALTER TABLE users ADD COLUMN roles text[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,153 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestPendingMigrations(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "first"},
+		{Version: 2, Name: "second"},
+		{Version: 3, Name: "third"},
+	}
+	applied := func(m Migration) AppliedMigration {
+		return AppliedMigration{Version: m.Version, Name: m.Name, Checksum: m.Checksum()}
+	}
+
+	tests := []struct {
+		name        string
+		applied     []AppliedMigration
+		wantPending []int
+		wantErr     bool
+	}{
+		{"None applied", nil, []int{1, 2, 3}, false},
+		{"Some applied", []AppliedMigration{applied(migrations[0])}, []int{2, 3}, false},
+		{"All applied", []AppliedMigration{applied(migrations[0]), applied(migrations[1]), applied(migrations[2])}, nil, false},
+		{"Gap", []AppliedMigration{applied(migrations[0]), applied(migrations[2])}, []int{2}, false},
+		{"Changed", []AppliedMigration{{Version: 1, Name: "first", Checksum: "other"}}, nil, true},
+		{"Unknown", []AppliedMigration{applied(Migration{Version: 4, Name: "fourth"})}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending, err := PendingMigrations(migrations, tt.applied)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v; want error %t", err, tt.wantErr)
+			}
+
+			var versions []int
+			for _, migration := range pending {
+				versions = append(versions, migration.Version)
+			}
+			if len(versions) != len(tt.wantPending) {
+				t.Fatalf("got pending versions %v; want %v", versions, tt.wantPending)
+			}
+			for i := range versions {
+				if versions[i] != tt.wantPending[i] {
+					t.Fatalf("got pending versions %v; want %v", versions, tt.wantPending)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrationChecksum(t *testing.T) {
+	migration := Migration{
+		Version: 1,
+		Name:    "first",
+		Indexes: []MigrationIndex{{Collection: "users", Keys: bson.D{{Key: "email", Value: 1}}, Unique: true}},
+	}
+	if migration.Checksum() != migration.Checksum() {
+		t.Fatal("got different checksums for the same migration")
+	}
+
+	// Changing what the migration does must change its checksum, not only its version or name.
+	changed := migration
+	changed.Indexes = []MigrationIndex{{Collection: "users", Keys: bson.D{{Key: "email", Value: 1}}}}
+	if changed.Checksum() == migration.Checksum() {
+		t.Error("got the same checksum after changing an index")
+	}
+
+	changed = migration
+	changed.Updates = []MigrationUpdate{{
+		Collection: "users",
+		Filter:     bson.D{{Key: "vouchers", Value: nil}},
+		Update:     bson.D{{Key: "$set", Value: bson.D{{Key: "vouchers", Value: bson.D{}}}}},
+	}}
+	if changed.Checksum() == migration.Checksum() {
+		t.Error("got the same checksum after adding an update")
+	}
+
+	// Up can't be hashed, so its version is.
+	changed = migration
+	changed.Up = func(ctx context.Context, db *mongo.Database) error { return nil }
+	changed.UpVersion = "1"
+	if changed.Checksum() == migration.Checksum() {
+		t.Error("got the same checksum after adding an Up function")
+	}
+	changedUp := changed
+	changedUp.UpVersion = "2"
+	if changedUp.Checksum() == changed.Checksum() {
+		t.Error("got the same checksum after changing the Up version")
+	}
+}
+
+func TestMigrationApplyWithoutUpVersion(t *testing.T) {
+	migration := Migration{
+		Version: 1,
+		Name:    "first",
+		Up:      func(ctx context.Context, db *mongo.Database) error { return nil },
+	}
+
+	// The migration is refused before the database is touched.
+	err := migration.Apply(context.Background(), nil)
+	if !errors.Is(err, ErrMigrationUpVersion) {
+		t.Errorf("got error %v; want %v", err, ErrMigrationUpVersion)
+	}
+}
+
+func TestMongoMigrationVersions(t *testing.T) {
+	// Versions must be unique and in order, since they are applied in the order of the list.
+	for i, migration := range MongoMigrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration %q has version %d; want %d", migration.Name, migration.Version, i+1)
+		}
+		if migration.Up != nil && migration.UpVersion == "" {
+			t.Errorf("migration %q has an Up function but no UpVersion", migration.Name)
+		}
+		// Checksum panics if the migration can't be encoded.
+		migration.Checksum()
+	}
+}
+
+func TestMigrateMongo(t *testing.T) {
+	if os.Getenv("MONGOURILOCAL") == "" {
+		t.Skip("MONGOURILOCAL not set")
+	}
+
+	// The test database has already been migrated, so migrating again must do nothing.
+	db, teardown := newTestDB(t)
+	defer teardown()
+
+	applied, err := MigrateMongo(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("got %d migrations applied twice; want 0", len(applied))
+	}
+
+	records, err := AppliedMongoMigrations(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(MongoMigrations) {
+		t.Errorf("got %d applied migrations; want %d", len(records), len(MongoMigrations))
+	}
+}
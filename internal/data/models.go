@@ -1,12 +1,14 @@
 package data
 
 import (
+	"context"
 	"errors"
 	"io"
 	"log"
 	"os"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -18,30 +20,79 @@ var (
 	ErrEditConflict = errors.New("edit conflict")
 )
 
+// DefaultQueryTimeout is how long a single query may take unless configured otherwise.
+const DefaultQueryTimeout = 3 * time.Second
+
+// newID returns a new record ID in the same format as the IDs generated by MongoDB, for the
+// backends which generate their own IDs.
+func newID() string {
+	return primitive.NewObjectID().Hex()
+}
+
 // Models struct is a single convenient container to hold and represent all our database models.
 type Models struct {
 	Vouchers interface {
-		Insert(voucher *Voucher) error
-		Get(string) (*Voucher, error)
-		GetVoucherList([]string) ([]Voucher, error)
-		UpdateUsageCount(string) error
-		Delete(string) error
-		GetAllVouchers(string, time.Time, time.Time, bool, int, string, *Filters) ([]Voucher, *Metadata, error)
+		Insert(ctx context.Context, voucher *Voucher) error
+		Get(context.Context, string) (*Voucher, error)
+		GetVoucherList(context.Context, []string) ([]Voucher, error)
+		UpdateUsageCount(context.Context, string) error
+		Delete(context.Context, string) error
+		Deactivate(context.Context, string) error
+		GetAllVouchers(context.Context, string, time.Time, time.Time, bool, int, string, *Filters) ([]Voucher, *Metadata, error)
 	}
 	Users interface {
-		Insert(user *User) (string, error)
-		Get(string) (*User, error)
-		GetByEmail(string) (*User, error)
-		GetAllVouchers(string) (map[string]int, error)
-		RedeemVoucher(string, string, int) error
-		GetPoints(string) (int, error)
-		AddPoints(string, int) error
-		DeductPointsAndCreateVoucher(string, int, *Voucher) error
-		UpdateVoucherList(string, map[string]int) error
+		Insert(ctx context.Context, user *User) (string, error)
+		Get(context.Context, string) (*User, error)
+		GetByEmail(context.Context, string) (*User, error)
+		GetAllVouchers(context.Context, string) (map[string]int, error)
+		RedeemVoucher(context.Context, string, string, int) error
+		GetPoints(context.Context, string) (int, error)
+		AddPoints(context.Context, string, int) error
+		DeductPointsAndCreateVoucher(context.Context, string, int, *Voucher) error
+		UpdateVoucherList(context.Context, string, map[string]int) error
+		IncrementFailedLogins(context.Context, string) (int, error)
+		Lock(context.Context, string, time.Time) error
+		ResetFailedLogins(context.Context, string) error
+		SetMFAPendingSecret(context.Context, string, string) error
+		EnableMFA(context.Context, string, string, [][]byte, int64) error
+		DisableMFA(context.Context, string) error
+		UseMFAStep(context.Context, string, int64) error
+		ConsumeRecoveryCode(context.Context, string, []byte) error
+		GetByIdentity(context.Context, string, string) (*User, error)
+		AddIdentity(context.Context, string, Identity) error
+		ScheduleDeletion(context.Context, string, time.Time) error
+		CancelDeletion(context.Context, string) error
+		GetAllDueForDeletion(context.Context, time.Time) ([]string, error)
+		Anonymize(context.Context, string, time.Time) error
+		AddRole(context.Context, string, string) error
+	}
+	Events interface {
+		Insert(ctx context.Context, event *Event) error
+		GetAllForUser(context.Context, string) ([]Event, error)
+	}
+	Merchants interface {
+		Insert(ctx context.Context, merchant *Merchant) (string, error)
+		Get(context.Context, string) (*Merchant, error)
+		GetAll(context.Context) ([]Merchant, error)
+		InsertKey(ctx context.Context, key *APIKey) error
+		GetKey(context.Context, string) (*APIKey, error)
+		GetKeys(context.Context, string) ([]APIKey, error)
+		RevokeKey(context.Context, string, string, time.Time) error
+		TouchKey(context.Context, string, time.Time) error
+	}
+	Sessions interface {
+		Insert(ctx context.Context, session *Session) (string, error)
+		Get(context.Context, string) (*Session, error)
+		GetAllForUser(context.Context, string) ([]Session, error)
+		Touch(context.Context, string, time.Time) error
+		Delete(context.Context, string, string) error
+		DeleteAllForUser(context.Context, string) error
 	}
 }
 
-func NewModels(db *mongo.Database) Models {
+// NewModels returns the models backed by db. Every query is bounded by timeout, on top of any
+// deadline of the context which is passed in.
+func NewModels(db *mongo.Database, timeout time.Duration) Models {
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 	return Models{
@@ -49,23 +100,47 @@ func NewModels(db *mongo.Database) Models {
 			DB:       db,
 			InfoLog:  infoLog,
 			ErrorLog: errorLog,
+			Timeout:  timeout,
 		},
 		Users: UserModel{
 			DB:       db,
 			InfoLog:  infoLog,
 			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Events: EventModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Merchants: MerchantModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Sessions: SessionModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
 		},
 	}
 }
 
 func NewMockModels() Models {
 	return Models{
-		Vouchers: MockVoucherModel{},
-		Users:    MockUserModel{},
+		Vouchers:  MockVoucherModel{},
+		Users:     MockUserModel{},
+		Events:    MockEventModel{},
+		Merchants: MockMerchantModel{},
+		Sessions:  MockSessionModel{},
 	}
 }
 
 func NewTestModels(db *mongo.Database) Models {
+	timeout := DefaultQueryTimeout
 	infoLog := log.New(io.Discard, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(io.Discard, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 	return Models{
@@ -73,11 +148,31 @@ func NewTestModels(db *mongo.Database) Models {
 			DB:       db,
 			InfoLog:  infoLog,
 			ErrorLog: errorLog,
+			Timeout:  timeout,
 		},
 		Users: UserModel{
 			DB:       db,
 			InfoLog:  infoLog,
 			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Events: EventModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Merchants: MerchantModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Sessions: SessionModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
 		},
 	}
 }
@@ -0,0 +1,413 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans of the data layer.
+const tracerName = "github.com/toduluz/savingsquadsbackend/internal/data"
+
+// NewTracedModels wraps the models so that every method call is recorded as a span, named after
+// the model and method such as "Users.DeductPointsAndCreateVoucher". The spans of the MongoDB
+// commands which the method runs are recorded as its children by the command monitor of the
+// client. Spans go to the global tracer provider, which discards them unless tracing is set up.
+func NewTracedModels(models Models) Models {
+	tracer := otel.Tracer(tracerName)
+	return Models{
+		Vouchers:  tracedVoucherModel{models, tracer},
+		Users:     tracedUserModel{models, tracer},
+		Events:    tracedEventModel{models, tracer},
+		Merchants: tracedMerchantModel{models, tracer},
+		Sessions:  tracedSessionModel{models, tracer},
+	}
+}
+
+// recordError marks the span as failed if err isn't nil, and returns err. ErrRecordNotFound is
+// an expected outcome of lookups, so it isn't treated as a failure.
+func recordError(span trace.Span, err error) error {
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+type tracedVoucherModel struct {
+	next   Models
+	tracer trace.Tracer
+}
+
+func (m tracedVoucherModel) Insert(ctx context.Context, voucher *Voucher) error {
+	ctx, span := m.tracer.Start(ctx, "Vouchers.Insert")
+	defer span.End()
+
+	return recordError(span, m.next.Vouchers.Insert(ctx, voucher))
+}
+
+func (m tracedVoucherModel) Get(ctx context.Context, code string) (*Voucher, error) {
+	ctx, span := m.tracer.Start(ctx, "Vouchers.Get")
+	defer span.End()
+
+	result, err := m.next.Vouchers.Get(ctx, code)
+	return result, recordError(span, err)
+}
+
+func (m tracedVoucherModel) GetVoucherList(ctx context.Context, voucherCodes []string) ([]Voucher, error) {
+	ctx, span := m.tracer.Start(ctx, "Vouchers.GetVoucherList")
+	defer span.End()
+
+	result, err := m.next.Vouchers.GetVoucherList(ctx, voucherCodes)
+	return result, recordError(span, err)
+}
+
+func (m tracedVoucherModel) UpdateUsageCount(ctx context.Context, code string) error {
+	ctx, span := m.tracer.Start(ctx, "Vouchers.UpdateUsageCount")
+	defer span.End()
+
+	return recordError(span, m.next.Vouchers.UpdateUsageCount(ctx, code))
+}
+
+func (m tracedVoucherModel) Delete(ctx context.Context, code string) error {
+	ctx, span := m.tracer.Start(ctx, "Vouchers.Delete")
+	defer span.End()
+
+	return recordError(span, m.next.Vouchers.Delete(ctx, code))
+}
+
+func (m tracedVoucherModel) Deactivate(ctx context.Context, code string) error {
+	ctx, span := m.tracer.Start(ctx, "Vouchers.Deactivate")
+	defer span.End()
+
+	return recordError(span, m.next.Vouchers.Deactivate(ctx, code))
+}
+
+func (m tracedVoucherModel) GetAllVouchers(ctx context.Context, code string, starts time.Time, expires time.Time, active bool, minSpend int, category string, f *Filters) ([]Voucher, *Metadata, error) {
+	ctx, span := m.tracer.Start(ctx, "Vouchers.GetAllVouchers")
+	defer span.End()
+
+	result, metadata, err := m.next.Vouchers.GetAllVouchers(ctx, code, starts, expires, active, minSpend, category, f)
+	return result, metadata, recordError(span, err)
+}
+
+type tracedUserModel struct {
+	next   Models
+	tracer trace.Tracer
+}
+
+func (m tracedUserModel) Insert(ctx context.Context, user *User) (string, error) {
+	ctx, span := m.tracer.Start(ctx, "Users.Insert")
+	defer span.End()
+
+	id, err := m.next.Users.Insert(ctx, user)
+	return id, recordError(span, err)
+}
+
+func (m tracedUserModel) Get(ctx context.Context, id string) (*User, error) {
+	ctx, span := m.tracer.Start(ctx, "Users.Get")
+	defer span.End()
+
+	result, err := m.next.Users.Get(ctx, id)
+	return result, recordError(span, err)
+}
+
+func (m tracedUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	ctx, span := m.tracer.Start(ctx, "Users.GetByEmail")
+	defer span.End()
+
+	result, err := m.next.Users.GetByEmail(ctx, email)
+	return result, recordError(span, err)
+}
+
+func (m tracedUserModel) GetAllVouchers(ctx context.Context, id string) (map[string]int, error) {
+	ctx, span := m.tracer.Start(ctx, "Users.GetAllVouchers")
+	defer span.End()
+
+	result, err := m.next.Users.GetAllVouchers(ctx, id)
+	return result, recordError(span, err)
+}
+
+func (m tracedUserModel) RedeemVoucher(ctx context.Context, id string, code string, number int) error {
+	ctx, span := m.tracer.Start(ctx, "Users.RedeemVoucher")
+	defer span.End()
+
+	return recordError(span, m.next.Users.RedeemVoucher(ctx, id, code, number))
+}
+
+func (m tracedUserModel) GetPoints(ctx context.Context, id string) (int, error) {
+	ctx, span := m.tracer.Start(ctx, "Users.GetPoints")
+	defer span.End()
+
+	result, err := m.next.Users.GetPoints(ctx, id)
+	return result, recordError(span, err)
+}
+
+func (m tracedUserModel) AddPoints(ctx context.Context, id string, points int) error {
+	ctx, span := m.tracer.Start(ctx, "Users.AddPoints")
+	defer span.End()
+
+	return recordError(span, m.next.Users.AddPoints(ctx, id, points))
+}
+
+func (m tracedUserModel) DeductPointsAndCreateVoucher(ctx context.Context, id string, points int, voucher *Voucher) error {
+	ctx, span := m.tracer.Start(ctx, "Users.DeductPointsAndCreateVoucher")
+	defer span.End()
+
+	return recordError(span, m.next.Users.DeductPointsAndCreateVoucher(ctx, id, points, voucher))
+}
+
+func (m tracedUserModel) UpdateVoucherList(ctx context.Context, id string, vouchers map[string]int) error {
+	ctx, span := m.tracer.Start(ctx, "Users.UpdateVoucherList")
+	defer span.End()
+
+	return recordError(span, m.next.Users.UpdateVoucherList(ctx, id, vouchers))
+}
+
+func (m tracedUserModel) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
+	ctx, span := m.tracer.Start(ctx, "Users.IncrementFailedLogins")
+	defer span.End()
+
+	result, err := m.next.Users.IncrementFailedLogins(ctx, id)
+	return result, recordError(span, err)
+}
+
+func (m tracedUserModel) Lock(ctx context.Context, id string, until time.Time) error {
+	ctx, span := m.tracer.Start(ctx, "Users.Lock")
+	defer span.End()
+
+	return recordError(span, m.next.Users.Lock(ctx, id, until))
+}
+
+func (m tracedUserModel) ResetFailedLogins(ctx context.Context, id string) error {
+	ctx, span := m.tracer.Start(ctx, "Users.ResetFailedLogins")
+	defer span.End()
+
+	return recordError(span, m.next.Users.ResetFailedLogins(ctx, id))
+}
+
+func (m tracedUserModel) SetMFAPendingSecret(ctx context.Context, id string, secret string) error {
+	ctx, span := m.tracer.Start(ctx, "Users.SetMFAPendingSecret")
+	defer span.End()
+
+	return recordError(span, m.next.Users.SetMFAPendingSecret(ctx, id, secret))
+}
+
+func (m tracedUserModel) EnableMFA(ctx context.Context, id string, secret string, recoveryCodes [][]byte, step int64) error {
+	ctx, span := m.tracer.Start(ctx, "Users.EnableMFA")
+	defer span.End()
+
+	return recordError(span, m.next.Users.EnableMFA(ctx, id, secret, recoveryCodes, step))
+}
+
+func (m tracedUserModel) DisableMFA(ctx context.Context, id string) error {
+	ctx, span := m.tracer.Start(ctx, "Users.DisableMFA")
+	defer span.End()
+
+	return recordError(span, m.next.Users.DisableMFA(ctx, id))
+}
+
+func (m tracedUserModel) UseMFAStep(ctx context.Context, id string, step int64) error {
+	ctx, span := m.tracer.Start(ctx, "Users.UseMFAStep")
+	defer span.End()
+
+	return recordError(span, m.next.Users.UseMFAStep(ctx, id, step))
+}
+
+func (m tracedUserModel) ConsumeRecoveryCode(ctx context.Context, id string, hash []byte) error {
+	ctx, span := m.tracer.Start(ctx, "Users.ConsumeRecoveryCode")
+	defer span.End()
+
+	return recordError(span, m.next.Users.ConsumeRecoveryCode(ctx, id, hash))
+}
+
+func (m tracedUserModel) GetByIdentity(ctx context.Context, provider string, subject string) (*User, error) {
+	ctx, span := m.tracer.Start(ctx, "Users.GetByIdentity")
+	defer span.End()
+
+	result, err := m.next.Users.GetByIdentity(ctx, provider, subject)
+	return result, recordError(span, err)
+}
+
+func (m tracedUserModel) AddIdentity(ctx context.Context, id string, identity Identity) error {
+	ctx, span := m.tracer.Start(ctx, "Users.AddIdentity")
+	defer span.End()
+
+	return recordError(span, m.next.Users.AddIdentity(ctx, id, identity))
+}
+
+func (m tracedUserModel) ScheduleDeletion(ctx context.Context, id string, at time.Time) error {
+	ctx, span := m.tracer.Start(ctx, "Users.ScheduleDeletion")
+	defer span.End()
+
+	return recordError(span, m.next.Users.ScheduleDeletion(ctx, id, at))
+}
+
+func (m tracedUserModel) CancelDeletion(ctx context.Context, id string) error {
+	ctx, span := m.tracer.Start(ctx, "Users.CancelDeletion")
+	defer span.End()
+
+	return recordError(span, m.next.Users.CancelDeletion(ctx, id))
+}
+
+func (m tracedUserModel) GetAllDueForDeletion(ctx context.Context, now time.Time) ([]string, error) {
+	ctx, span := m.tracer.Start(ctx, "Users.GetAllDueForDeletion")
+	defer span.End()
+
+	result, err := m.next.Users.GetAllDueForDeletion(ctx, now)
+	return result, recordError(span, err)
+}
+
+func (m tracedUserModel) Anonymize(ctx context.Context, id string, at time.Time) error {
+	ctx, span := m.tracer.Start(ctx, "Users.Anonymize")
+	defer span.End()
+
+	return recordError(span, m.next.Users.Anonymize(ctx, id, at))
+}
+
+func (m tracedUserModel) AddRole(ctx context.Context, id string, role string) error {
+	ctx, span := m.tracer.Start(ctx, "Users.AddRole")
+	defer span.End()
+
+	return recordError(span, m.next.Users.AddRole(ctx, id, role))
+}
+
+type tracedEventModel struct {
+	next   Models
+	tracer trace.Tracer
+}
+
+func (m tracedEventModel) Insert(ctx context.Context, event *Event) error {
+	ctx, span := m.tracer.Start(ctx, "Events.Insert")
+	defer span.End()
+
+	return recordError(span, m.next.Events.Insert(ctx, event))
+}
+
+func (m tracedEventModel) GetAllForUser(ctx context.Context, userID string) ([]Event, error) {
+	ctx, span := m.tracer.Start(ctx, "Events.GetAllForUser")
+	defer span.End()
+
+	result, err := m.next.Events.GetAllForUser(ctx, userID)
+	return result, recordError(span, err)
+}
+
+type tracedMerchantModel struct {
+	next   Models
+	tracer trace.Tracer
+}
+
+func (m tracedMerchantModel) Insert(ctx context.Context, merchant *Merchant) (string, error) {
+	ctx, span := m.tracer.Start(ctx, "Merchants.Insert")
+	defer span.End()
+
+	id, err := m.next.Merchants.Insert(ctx, merchant)
+	return id, recordError(span, err)
+}
+
+func (m tracedMerchantModel) Get(ctx context.Context, id string) (*Merchant, error) {
+	ctx, span := m.tracer.Start(ctx, "Merchants.Get")
+	defer span.End()
+
+	result, err := m.next.Merchants.Get(ctx, id)
+	return result, recordError(span, err)
+}
+
+func (m tracedMerchantModel) GetAll(ctx context.Context) ([]Merchant, error) {
+	ctx, span := m.tracer.Start(ctx, "Merchants.GetAll")
+	defer span.End()
+
+	result, err := m.next.Merchants.GetAll(ctx)
+	return result, recordError(span, err)
+}
+
+func (m tracedMerchantModel) InsertKey(ctx context.Context, key *APIKey) error {
+	ctx, span := m.tracer.Start(ctx, "Merchants.InsertKey")
+	defer span.End()
+
+	return recordError(span, m.next.Merchants.InsertKey(ctx, key))
+}
+
+func (m tracedMerchantModel) GetKey(ctx context.Context, id string) (*APIKey, error) {
+	ctx, span := m.tracer.Start(ctx, "Merchants.GetKey")
+	defer span.End()
+
+	result, err := m.next.Merchants.GetKey(ctx, id)
+	return result, recordError(span, err)
+}
+
+func (m tracedMerchantModel) GetKeys(ctx context.Context, merchantID string) ([]APIKey, error) {
+	ctx, span := m.tracer.Start(ctx, "Merchants.GetKeys")
+	defer span.End()
+
+	result, err := m.next.Merchants.GetKeys(ctx, merchantID)
+	return result, recordError(span, err)
+}
+
+func (m tracedMerchantModel) RevokeKey(ctx context.Context, merchantID string, id string, at time.Time) error {
+	ctx, span := m.tracer.Start(ctx, "Merchants.RevokeKey")
+	defer span.End()
+
+	return recordError(span, m.next.Merchants.RevokeKey(ctx, merchantID, id, at))
+}
+
+func (m tracedMerchantModel) TouchKey(ctx context.Context, id string, at time.Time) error {
+	ctx, span := m.tracer.Start(ctx, "Merchants.TouchKey")
+	defer span.End()
+
+	return recordError(span, m.next.Merchants.TouchKey(ctx, id, at))
+}
+
+type tracedSessionModel struct {
+	next   Models
+	tracer trace.Tracer
+}
+
+func (m tracedSessionModel) Insert(ctx context.Context, session *Session) (string, error) {
+	ctx, span := m.tracer.Start(ctx, "Sessions.Insert")
+	defer span.End()
+
+	id, err := m.next.Sessions.Insert(ctx, session)
+	return id, recordError(span, err)
+}
+
+func (m tracedSessionModel) Get(ctx context.Context, id string) (*Session, error) {
+	ctx, span := m.tracer.Start(ctx, "Sessions.Get")
+	defer span.End()
+
+	result, err := m.next.Sessions.Get(ctx, id)
+	return result, recordError(span, err)
+}
+
+func (m tracedSessionModel) GetAllForUser(ctx context.Context, userID string) ([]Session, error) {
+	ctx, span := m.tracer.Start(ctx, "Sessions.GetAllForUser")
+	defer span.End()
+
+	result, err := m.next.Sessions.GetAllForUser(ctx, userID)
+	return result, recordError(span, err)
+}
+
+func (m tracedSessionModel) Touch(ctx context.Context, id string, at time.Time) error {
+	ctx, span := m.tracer.Start(ctx, "Sessions.Touch")
+	defer span.End()
+
+	return recordError(span, m.next.Sessions.Touch(ctx, id, at))
+}
+
+func (m tracedSessionModel) Delete(ctx context.Context, userID string, id string) error {
+	ctx, span := m.tracer.Start(ctx, "Sessions.Delete")
+	defer span.End()
+
+	return recordError(span, m.next.Sessions.Delete(ctx, userID, id))
+}
+
+func (m tracedSessionModel) DeleteAllForUser(ctx context.Context, userID string) error {
+	ctx, span := m.tracer.Start(ctx, "Sessions.DeleteAllForUser")
+	defer span.End()
+
+	return recordError(span, m.next.Sessions.DeleteAllForUser(ctx, userID))
+}
@@ -0,0 +1,47 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracedModels(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	m := NewTracedModels(NewMemoryModels())
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	id := newTestUser(t, m, "traced@example.com", 10)
+	if err := m.Users.DeductPointsAndCreateVoucher(ctx, id, 20, &Voucher{Code: "TRACED"}); err == nil {
+		t.Fatal("want an error for too few points")
+	}
+	if _, err := m.Users.Get(ctx, "missing"); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("got %v; want ErrRecordNotFound", err)
+	}
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	deduct, ok := spans["Users.DeductPointsAndCreateVoucher"]
+	if !ok {
+		t.Fatal("missing Users.DeductPointsAndCreateVoucher span")
+	}
+	if deduct.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("want Users.DeductPointsAndCreateVoucher to be a child of the caller's span")
+	}
+	if deduct.Status().Code != codes.Error {
+		t.Error("want Users.DeductPointsAndCreateVoucher to be marked as failed")
+	}
+	if get := spans["Users.Get"]; get == nil || get.Status().Code == codes.Error {
+		t.Error("want a Users.Get span which isn't marked as failed for a missing record")
+	}
+}
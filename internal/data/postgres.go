@@ -0,0 +1,190 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+const postgresMigrationsDir = "migrations/postgres/"
+
+// postgresMigrationLock is the key of the advisory lock which is held while migrating, so that
+// several instances starting at once don't apply the same migration twice.
+const postgresMigrationLock = 7263540211
+
+// MigratePostgres applies the embedded SQL migrations which haven't been applied to the database
+// yet, in the order of their file names, and returns their versions. Each migration runs in its
+// own transaction and is recorded in the schema_migrations table.
+func MigratePostgres(ctx context.Context, db *sql.DB) ([]string, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, postgresMigrationLock)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, postgresMigrationLock)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    text PRIMARY KEY,
+			applied_at timestamptz NOT NULL
+		)`)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := pendingPostgresMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, version := range pending {
+		query, err := postgresMigrations.ReadFile(postgresMigrationsDir + version)
+		if err != nil {
+			return pending[:i], err
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return pending[:i], err
+		}
+		_, err = tx.ExecContext(ctx, string(query))
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, version, time.Now())
+		}
+		if err != nil {
+			tx.Rollback()
+			return pending[:i], fmt.Errorf("migration %s: %w", version, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return pending[:i], err
+		}
+	}
+
+	return pending, nil
+}
+
+// PendingPostgresMigrations returns the versions of the embedded SQL migrations which haven't
+// been applied to the database yet, in order, without applying them.
+func PendingPostgresMigrations(ctx context.Context, db *sql.DB) ([]string, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return pendingPostgresMigrations(ctx, conn)
+}
+
+func pendingPostgresMigrations(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	names, err := fs.Glob(postgresMigrations, postgresMigrationsDir+"*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	// Nothing has been applied to a database which has never been migrated.
+	var migrated bool
+	err = conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&migrated)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, name := range names {
+		version := strings.TrimPrefix(name, postgresMigrationsDir)
+
+		var applied bool
+		if migrated {
+			err = conn.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&applied)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !applied {
+			pending = append(pending, version)
+		}
+	}
+
+	return pending, nil
+}
+
+// NewPostgresModels returns the models backed by the PostgreSQL database db, which must have been
+// migrated with MigratePostgres. Every query is bounded by timeout, on top of any deadline of the
+// context which is passed in.
+func NewPostgresModels(db *sql.DB, timeout time.Duration) Models {
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+	return Models{
+		Vouchers: PostgresVoucherModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Users: PostgresUserModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Events: PostgresEventModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Merchants: PostgresMerchantModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+		Sessions: PostgresSessionModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+			Timeout:  timeout,
+		},
+	}
+}
+
+// isUniqueViolation reports whether err is a violation of the given unique constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// nullTime stores the zero time as NULL, the way unset times are left out of MongoDB documents.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// rowsAffected returns ErrRecordNotFound if the result of an update or delete affected no rows.
+func rowsAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
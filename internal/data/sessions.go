@@ -0,0 +1,142 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Insert inserts a new record in the sessions collection and returns its ID. Sessions are removed
+// by MongoDB once they have expired, using the TTL index created by the migrations.
+func (m SessionModel) Insert(ctx context.Context, session *Session) (string, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.Collection("sessions").InsertOne(ctx, session)
+	if err != nil {
+		return "", err
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves an unexpired session by ID, returning ErrRecordNotFound if it doesn't exist or
+// has been revoked.
+func (m SessionModel) Get(ctx context.Context, id string) (*Session, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	// MongoDB only removes expired documents periodically, so filter on the expiry too.
+	filter := bson.M{"_id": oid, "expires_at": bson.M{"$gt": time.Now()}}
+
+	var session Session
+	err = m.DB.Collection("sessions").FindOne(ctx, filter).Decode(&session)
+	if err != nil {
+		switch {
+		case err == mongo.ErrNoDocuments:
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &session, nil
+}
+
+// GetAllForUser returns the unexpired sessions of the user, most recently seen first.
+func (m SessionModel) GetAllForUser(ctx context.Context, userID string) ([]Session, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	filter := bson.M{"user_id": userID, "expires_at": bson.M{"$gt": time.Now()}}
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+	cursor, err := m.DB.Collection("sessions").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// Decode the results into a slice of Sessions.
+	sessions := []Session{}
+	for cursor.Next(ctx) {
+		var session Session
+		if err = cursor.Decode(&session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// Touch records that the session was used at the given time.
+func (m SessionModel) Touch(ctx context.Context, id string, at time.Time) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the update document to set the new values of the fields.
+	update := bson.M{
+		"$set": bson.M{
+			"last_seen_at": at,
+		},
+	}
+
+	// Execute the update operation.
+	_, err = m.DB.Collection("sessions").UpdateOne(ctx, bson.M{"_id": oid}, update)
+	return err
+}
+
+// Delete revokes a session of the user. It returns ErrRecordNotFound if the user has no such
+// session.
+func (m SessionModel) Delete(ctx context.Context, userID string, id string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrRecordNotFound
+	}
+
+	// Define the filter to match the session only if it belongs to the user.
+	filter := bson.M{"_id": oid, "user_id": userID}
+
+	result, err := m.DB.Collection("sessions").DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllForUser revokes every session of the user.
+func (m SessionModel) DeleteAllForUser(ctx context.Context, userID string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.Collection("sessions").DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -0,0 +1,108 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemorySessionModel is the in-memory implementation of the Sessions model. Expired sessions are
+// removed whenever a new session is inserted, in place of the MongoDB TTL index.
+type MemorySessionModel struct {
+	store *memoryStore
+}
+
+func (m MemorySessionModel) Insert(ctx context.Context, session *Session) (string, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	now := time.Now()
+	for id, s := range m.store.sessions {
+		if !s.ExpiresAt.After(now) {
+			delete(m.store.sessions, id)
+		}
+	}
+
+	stored := *session
+	stored.ID = newID()
+	stored.Current = false
+	m.store.sessions[stored.ID] = &stored
+
+	return stored.ID, nil
+}
+
+func (m MemorySessionModel) Get(ctx context.Context, id string) (*Session, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	session, ok := m.store.sessions[id]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	c := *session
+	return &c, nil
+}
+
+func (m MemorySessionModel) GetAllForUser(ctx context.Context, userID string) ([]Session, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	now := time.Now()
+	sessions := []Session{}
+	for _, session := range m.store.sessions {
+		if session.UserID == userID && session.ExpiresAt.After(now) {
+			sessions = append(sessions, *session)
+		}
+	}
+
+	// Return the most recently seen sessions first.
+	slices.SortFunc(sessions, func(a, b Session) int {
+		return b.LastSeenAt.Compare(a.LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+func (m MemorySessionModel) Touch(ctx context.Context, id string, at time.Time) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if session, ok := m.store.sessions[id]; ok {
+		session.LastSeenAt = at
+	}
+
+	return nil
+}
+
+func (m MemorySessionModel) Delete(ctx context.Context, userID string, id string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	session, ok := m.store.sessions[id]
+	if !ok || session.UserID != userID {
+		return ErrRecordNotFound
+	}
+	delete(m.store.sessions, id)
+
+	return nil
+}
+
+func (m MemorySessionModel) DeleteAllForUser(ctx context.Context, userID string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for id, session := range m.store.sessions {
+		if session.UserID == userID {
+			delete(m.store.sessions, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+type MockSessionModel struct{}
+
+func (m MockSessionModel) Insert(ctx context.Context, session *Session) (string, error) {
+	return "testSessionID", nil
+}
+
+func (m MockSessionModel) Get(ctx context.Context, id string) (*Session, error) {
+	switch id {
+	case "testSessionID":
+		return &Session{ID: id, UserID: "testID", LastSeenAt: time.Now()}, nil
+	default:
+		return nil, ErrRecordNotFound
+	}
+}
+
+func (m MockSessionModel) GetAllForUser(ctx context.Context, userID string) ([]Session, error) {
+	return nil, nil
+}
+
+func (m MockSessionModel) Touch(ctx context.Context, id string, at time.Time) error {
+	return nil
+}
+
+func (m MockSessionModel) Delete(ctx context.Context, userID string, id string) error {
+	return nil
+}
+
+func (m MockSessionModel) DeleteAllForUser(ctx context.Context, userID string) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+package data
+
+import (
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Session type whose fields describe a logged in device of a user. Every session JWT carries the
+// ID of its session, so deleting the session revokes the JWT immediately.
+type Session struct {
+	ID         string    `json:"id" bson:"_id,omitempty"`
+	UserID     string    `json:"-" bson:"user_id"`
+	DeviceName string    `json:"device_name" bson:"device_name"`
+	UserAgent  string    `json:"user_agent" bson:"user_agent"`
+	IP         string    `json:"ip" bson:"ip"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at" bson:"expires_at"`
+	// Current is set when listing sessions to mark the session of the request.
+	Current bool `json:"current" bson:"-"`
+}
+
+// SessionModel struct wraps the DB and allows us to work with the Session struct type
+// and the sessions collection in our database.
+type SessionModel struct {
+	DB       *mongo.Database
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	Timeout  time.Duration
+}
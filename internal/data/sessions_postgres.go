@@ -0,0 +1,130 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PostgresSessionModel is the PostgreSQL implementation of the Sessions model. Expired sessions
+// are removed whenever a new session is inserted, in place of the MongoDB TTL index.
+type PostgresSessionModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	Timeout  time.Duration
+}
+
+// sessionColumns lists the columns of a session in the order expected by scanSession.
+const sessionColumns = `id, user_id, device_name, user_agent, ip, created_at, last_seen_at, expires_at`
+
+func scanSession(row interface{ Scan(...any) error }) (*Session, error) {
+	var session Session
+	err := row.Scan(&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent,
+		&session.IP, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &session, nil
+}
+
+func (m PostgresSessionModel) Insert(ctx context.Context, session *Session) (string, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at <= $1`, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	id := newID()
+	_, err = m.DB.ExecContext(ctx, `INSERT INTO sessions (`+sessionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		id, session.UserID, session.DeviceName, session.UserAgent, session.IP, session.CreatedAt,
+		session.LastSeenAt, session.ExpiresAt)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (m PostgresSessionModel) Get(ctx context.Context, id string) (*Session, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return scanSession(m.DB.QueryRowContext(ctx, `SELECT `+sessionColumns+` FROM sessions
+		WHERE id = $1 AND expires_at > $2`, id, time.Now()))
+}
+
+func (m PostgresSessionModel) GetAllForUser(ctx context.Context, userID string) ([]Session, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT `+sessionColumns+` FROM sessions
+		WHERE user_id = $1 AND expires_at > $2
+		ORDER BY last_seen_at DESC`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (m PostgresSessionModel) Touch(ctx context.Context, id string, at time.Time) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE sessions SET last_seen_at = $2 WHERE id = $1`, id, at)
+	return err
+}
+
+func (m PostgresSessionModel) Delete(ctx context.Context, userID string, id string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return rowsAffected(result)
+}
+
+func (m PostgresSessionModel) DeleteAllForUser(ctx context.Context, userID string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, userID)
+	return err
+}
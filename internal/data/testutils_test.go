@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"database/sql"
 	"os"
 	"testing"
 
@@ -24,8 +25,11 @@ func newTestDB(t *testing.T) (*mongo.Database, func()) {
 		t.Fatal(err)
 	}
 
-	// Create a new database.
+	// Create a new database with the indexes the models rely on.
 	db := client.Database("test")
+	if _, err := MigrateMongo(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
 
 	// Return the database handle and a function to close it.
 	return db, func() {
@@ -39,3 +43,41 @@ func newTestDB(t *testing.T) (*mongo.Database, func()) {
 		}
 	}
 }
+
+func newTestPostgres(t *testing.T) (*sql.DB, func()) {
+	t.Helper()
+
+	// Get the PostgreSQL DSN from the environment variable.
+	dsn := os.Getenv("POSTGRESURILOCAL")
+	if dsn == "" {
+		t.Fatal("POSTGRESURILOCAL not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the tables left behind by an earlier run which didn't finish, then create them.
+	drop := func() error {
+		_, err := db.Exec(`DROP TABLE IF EXISTS api_keys, merchants, sessions, events, user_identities,
+			user_vouchers, users, vouchers, schema_migrations CASCADE`)
+		return err
+	}
+	if err = drop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = MigratePostgres(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Return the database handle and a function to drop the tables and close it.
+	return db, func() {
+		if err := drop(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -13,21 +13,13 @@ import (
 
 // Insert inserts a new record in the users table in our database for the user. Also, we check
 // if our table already contains the same email address and if so return ErrDuplicateEmail error.
-func (m UserModel) Insert(user *User) (string, error) {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m UserModel) Insert(ctx context.Context, user *User) (string, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	// Create a unique index on the email field if it doesn't exist.
-	opts := options.CreateIndexes().SetMaxTime(3 * time.Second)
-	keys := bson.D{{Key: "email", Value: 1}} // 1 for ascending order
-	indexModel := mongo.IndexModel{Keys: keys, Options: options.Index().SetUnique(true)}
-	_, err := m.DB.Collection("users").Indexes().CreateOne(ctx, indexModel, opts)
-	if err != nil {
-		return "", err
-	}
-
-	// Insert the user data into the users table.
+	// Insert the user data into the users table. The unique index on the email field is created
+	// by the migrations.
 	result, err := m.DB.Collection("users").InsertOne(ctx, user)
 	if err != nil {
 		// Check if it's a duplicate key error (which means the email already exists).
@@ -44,15 +36,15 @@ func (m UserModel) Insert(user *User) (string, error) {
 	return result.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
-func (m UserModel) Get(id string) (*User, error) {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m UserModel) Get(ctx context.Context, id string) (*User, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
-	// Convert the id string to a MongoDB ObjectId.
+	// Convert the id string to a MongoDB ObjectId. An invalid id can't match any user.
 	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return nil, err
+		return nil, ErrRecordNotFound
 	}
 
 	// Define a User struct to hold the data returned by the query.
@@ -80,9 +72,9 @@ func (m UserModel) Get(id string) (*User, error) {
 // GetByEmail retrieves the User details from the database based on the user's email address.
 // Because we have a UNIQUE constraint on the email column, this query will only return one record,
 // or none at all, upon which we return a ErrRecordNotFound error).
-func (m UserModel) GetByEmail(email string) (*User, error) {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	// Define a User struct to hold the data returned by the query.
@@ -107,9 +99,9 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-func (m UserModel) GetAllVouchers(id string) (map[string]int, error) {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m UserModel) GetAllVouchers(ctx context.Context, id string) (map[string]int, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -137,9 +129,9 @@ func (m UserModel) GetAllVouchers(id string) (map[string]int, error) {
 	return user.Vouchers, nil
 }
 
-func (m UserModel) RedeemVoucher(id string, code string, number int) error {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m UserModel) RedeemVoucher(ctx context.Context, id string, code string, number int) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -169,9 +161,9 @@ func (m UserModel) RedeemVoucher(id string, code string, number int) error {
 	return nil
 }
 
-func (m UserModel) GetPoints(id string) (int, error) {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m UserModel) GetPoints(ctx context.Context, id string) (int, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -202,9 +194,12 @@ func (m UserModel) GetPoints(id string) (int, error) {
 	return user.Points, nil
 }
 
-func (m UserModel) AddPoints(id string, points int) error {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// AddPoints adds points to the user, or removes them if points is negative. Removing points only
+// matches a user who has at least that many, so that a concurrent exchange can't leave the
+// balance negative; ErrInsufficientPoints is returned otherwise.
+func (m UserModel) AddPoints(ctx context.Context, id string, points int) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -214,6 +209,9 @@ func (m UserModel) AddPoints(id string, points int) error {
 
 	// Define the filter to match documents where id is id.
 	filter := bson.M{"_id": oid}
+	if points < 0 {
+		filter["points"] = bson.M{"$gte": -points}
+	}
 
 	// Define the update document to set the new values of the fields.
 	update := bson.M{
@@ -223,17 +221,20 @@ func (m UserModel) AddPoints(id string, points int) error {
 	}
 
 	// Execute the update operation.
-	_, err = m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
 	if err != nil {
 		return err
 	}
+	if points < 0 && result.MatchedCount == 0 {
+		return ErrInsufficientPoints
+	}
 
 	return nil
 }
 
-func (m UserModel) DeductPointsAndCreateVoucher(id string, points int, voucher *Voucher) error {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m UserModel) DeductPointsAndCreateVoucher(ctx context.Context, id string, points int, voucher *Voucher) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -246,13 +247,15 @@ func (m UserModel) DeductPointsAndCreateVoucher(id string, points int, voucher *
 	if err != nil {
 		return err
 	}
-	defer session.EndSession(ctx)
+	defer session.EndSession(context.Background())
 
-	// Start a transaction.
+	// Start a transaction. The operations below run with a session context so that they are part
+	// of it. Ending the session aborts the transaction if it wasn't committed.
 	err = session.StartTransaction()
 	if err != nil {
 		return err
 	}
+	sctx := mongo.NewSessionContext(ctx, session)
 
 	// Define the filter to match documents where id is id and points is greater than or equal to points.
 	filter := bson.M{"_id": oid, "points": bson.M{"$gte": points}, "vouchers." + voucher.Code: bson.M{"$exists": false}}
@@ -268,7 +271,7 @@ func (m UserModel) DeductPointsAndCreateVoucher(id string, points int, voucher *
 	}
 
 	// Execute the update operation.
-	res, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	res, err := m.DB.Collection("users").UpdateOne(sctx, filter, update)
 	if err != nil {
 		return err
 	}
@@ -278,7 +281,7 @@ func (m UserModel) DeductPointsAndCreateVoucher(id string, points int, voucher *
 	}
 
 	// Create a new voucher.
-	_, err = m.DB.Collection("vouchers").InsertOne(ctx, voucher)
+	_, err = m.DB.Collection("vouchers").InsertOne(sctx, voucher)
 	if err != nil {
 		var writeException mongo.WriteException
 		if errors.As(err, &writeException) {
@@ -293,7 +296,7 @@ func (m UserModel) DeductPointsAndCreateVoucher(id string, points int, voucher *
 	}
 
 	// Commit the transaction.
-	err = session.CommitTransaction(ctx)
+	err = session.CommitTransaction(sctx)
 	if err != nil {
 		return err
 	}
@@ -301,9 +304,9 @@ func (m UserModel) DeductPointsAndCreateVoucher(id string, points int, voucher *
 	return nil
 }
 
-func (m UserModel) UpdateVoucherList(id string, vouchers map[string]int) error {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m UserModel) UpdateVoucherList(ctx context.Context, id string, vouchers map[string]int) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -329,3 +332,562 @@ func (m UserModel) UpdateVoucherList(id string, vouchers map[string]int) error {
 
 	return nil
 }
+
+// IncrementFailedLogins atomically increments the failed login counter of the user and returns
+// the new count.
+func (m UserModel) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, err
+	}
+
+	// Define the filter to match documents where id is id.
+	filter := bson.M{"_id": oid}
+
+	// Define the update document to increment the counter.
+	update := bson.M{
+		"$inc": bson.M{
+			"failed_logins": 1,
+		},
+	}
+
+	// Return the document after the update and only project the counter.
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"failed_logins": 1})
+
+	// Execute the update operation.
+	var user User
+	err = m.DB.Collection("users").FindOneAndUpdate(ctx, filter, update, opts).Decode(&user)
+	if err != nil {
+		// If the error is a NoDocument error, return ErrRecordNotFound
+		switch {
+		case err == mongo.ErrNoDocuments:
+			return 0, ErrRecordNotFound
+		default:
+			// Otherwise, return the error
+			return 0, err
+		}
+	}
+
+	return user.FailedLogins, nil
+}
+
+// Lock refuses logins for the user until the given time.
+func (m UserModel) Lock(ctx context.Context, id string, until time.Time) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the filter to match documents where id is id.
+	filter := bson.M{"_id": oid}
+
+	// Define the update document to set the new values of the fields.
+	update := bson.M{
+		"$set": bson.M{
+			"locked_until": until,
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ResetFailedLogins clears the failed login counter and any lock on the user.
+func (m UserModel) ResetFailedLogins(ctx context.Context, id string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the filter to match documents where id is id.
+	filter := bson.M{"_id": oid}
+
+	// Define the update document to set the new values of the fields.
+	update := bson.M{
+		"$set": bson.M{
+			"failed_logins": 0,
+			"locked_until":  time.Time{},
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// SetMFAPendingSecret stores a newly generated TOTP secret for the user, which only takes effect
+// once it is confirmed with EnableMFA.
+func (m UserModel) SetMFAPendingSecret(ctx context.Context, id string, secret string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the filter to match documents where id is id.
+	filter := bson.M{"_id": oid}
+
+	// Define the update document to set the new values of the fields.
+	update := bson.M{
+		"$set": bson.M{
+			"mfa.pending_secret": secret,
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// EnableMFA promotes the pending TOTP secret of the user to the active secret, replaces the
+// recovery codes and records the time step of the confirming code.
+func (m UserModel) EnableMFA(ctx context.Context, id string, secret string, recoveryCodes [][]byte, step int64) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the filter to match documents where id is id and the pending secret is unchanged.
+	filter := bson.M{"_id": oid, "mfa.pending_secret": secret}
+
+	// Define the update document to set the new values of the fields.
+	update := bson.M{
+		"$set": bson.M{
+			"mfa.enabled":        true,
+			"mfa.secret":         secret,
+			"mfa.recovery_codes": recoveryCodes,
+			"mfa.last_step":      step,
+		},
+		"$unset": bson.M{
+			"mfa.pending_secret": "",
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	// If no document matched, another enrolment replaced the pending secret in the meantime.
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// DisableMFA removes the TOTP secret and recovery codes of the user.
+func (m UserModel) DisableMFA(ctx context.Context, id string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the filter to match documents where id is id.
+	filter := bson.M{"_id": oid}
+
+	// Define the update document to reset the MFA settings.
+	update := bson.M{
+		"$set": bson.M{
+			"mfa": MFA{},
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// UseMFAStep records that the TOTP code for the given time step has been used. It returns
+// ErrMFACodeReused if a code for the same or a later step was already accepted.
+func (m UserModel) UseMFAStep(ctx context.Context, id string, step int64) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the filter to match documents where id is id and the last step is earlier.
+	filter := bson.M{"_id": oid, "mfa.last_step": bson.M{"$lt": step}}
+
+	// Define the update document to set the new values of the fields.
+	update := bson.M{
+		"$set": bson.M{
+			"mfa.last_step": step,
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrMFACodeReused
+	}
+
+	return nil
+}
+
+// ConsumeRecoveryCode removes the recovery code with the given hash from the user, so that it
+// can only be used once. It returns ErrRecordNotFound if the user has no such recovery code.
+func (m UserModel) ConsumeRecoveryCode(ctx context.Context, id string, hash []byte) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the filter to match documents where id is id and the recovery code is unused.
+	filter := bson.M{"_id": oid, "mfa.recovery_codes": hash}
+
+	// Define the update document to remove the recovery code.
+	update := bson.M{
+		"$pull": bson.M{
+			"mfa.recovery_codes": hash,
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetByIdentity retrieves the User which the external identity is linked to, returning
+// ErrRecordNotFound if it isn't linked to any user.
+func (m UserModel) GetByIdentity(ctx context.Context, provider string, subject string) (*User, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Define a User struct to hold the data returned by the query.
+	var user User
+
+	// Define the filter to match documents with an identity from the provider for the subject.
+	filter := bson.M{
+		"identities": bson.M{
+			"$elemMatch": bson.M{"provider": provider, "subject": subject},
+		},
+	}
+
+	// Execute the find operation
+	err := m.DB.Collection("users").FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		// If the error is a NoDocument error, return ErrRecordNotFound
+		switch {
+		case err == mongo.ErrNoDocuments:
+			return nil, ErrRecordNotFound
+		default:
+			// Otherwise, return the error
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// AddIdentity links an external identity to the user, so that they can sign in with it.
+func (m UserModel) AddIdentity(ctx context.Context, id string, identity Identity) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the filter to match documents where id is id.
+	filter := bson.M{"_id": oid}
+
+	// Define the update document to append the identity.
+	update := bson.M{
+		"$push": bson.M{
+			"identities": identity,
+		},
+		"$set": bson.M{
+			"updated_at": time.Now(),
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// ScheduleDeletion schedules the user account to be anonymized at the given time, unless the
+// user cancels it before then.
+func (m UserModel) ScheduleDeletion(ctx context.Context, id string, at time.Time) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the filter to match documents where id is id and the user hasn't been deleted.
+	filter := bson.M{"_id": oid, "deleted_at": bson.M{"$exists": false}}
+
+	// Define the update document to set the new values of the fields.
+	update := bson.M{
+		"$set": bson.M{
+			"deletion_scheduled_at": at,
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// CancelDeletion cancels the scheduled deletion of the user account.
+func (m UserModel) CancelDeletion(ctx context.Context, id string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the filter to match documents where id is id and the user hasn't been deleted.
+	filter := bson.M{"_id": oid, "deleted_at": bson.M{"$exists": false}}
+
+	// Define the update document to remove the scheduled deletion.
+	update := bson.M{
+		"$unset": bson.M{
+			"deletion_scheduled_at": "",
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllDueForDeletion returns the IDs of the users whose scheduled deletion is due at the given
+// time.
+func (m UserModel) GetAllDueForDeletion(ctx context.Context, now time.Time) ([]string, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	filter := bson.M{"deletion_scheduled_at": bson.M{"$lte": now}}
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := m.DB.Collection("users").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ids := []string{}
+	for cursor.Next(ctx) {
+		var user struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err = cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		ids = append(ids, user.ID.Hex())
+	}
+
+	return ids, nil
+}
+
+// Anonymize removes the personal data of a user whose deletion is due, keeping the document
+// itself so that vouchers and points which reference the user stay consistent. The email address
+// is replaced with a unique placeholder, and the password with a random one.
+func (m UserModel) Anonymize(ctx context.Context, id string, at time.Time) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Replace the password with a random one which nobody knows.
+	plaintext, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	var password Password
+	err = password.Set(plaintext)
+	if err != nil {
+		return err
+	}
+
+	// Only anonymize the user if the deletion is still scheduled and due, in case it was
+	// cancelled after it was picked up.
+	filter := bson.M{"_id": oid, "deletion_scheduled_at": bson.M{"$lte": at}}
+
+	// Define the update document to overwrite the personal data.
+	update := bson.M{
+		"$set": bson.M{
+			"name":          "Deleted user",
+			"email":         "deleted-" + id + "@deleted.invalid",
+			"password.hash": password.Hash,
+			"addresses":     []Address{},
+			"phone":         []Phone{},
+			"mfa":           MFA{},
+			"deleted_at":    at,
+			"updated_at":    at,
+		},
+		"$unset": bson.M{
+			"identities":            "",
+			"roles":                 "",
+			"deletion_scheduled_at": "",
+		},
+		"$inc": bson.M{
+			"version": 1,
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AddRole grants the role to the user, if they don't have it already.
+func (m UserModel) AddRole(ctx context.Context, id string, role string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	// Define the update document to add the role to the set of roles.
+	update := bson.M{
+		"$addToSet": bson.M{
+			"roles": role,
+		},
+		"$set": bson.M{
+			"updated_at": time.Now(),
+		},
+	}
+
+	// Execute the update operation.
+	result, err := m.DB.Collection("users").UpdateOne(ctx, bson.M{"_id": oid}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
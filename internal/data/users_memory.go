@@ -0,0 +1,434 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryUserModel is the in-memory implementation of the Users model. Its methods return the
+// same errors as those of UserModel in the same situations.
+type MemoryUserModel struct {
+	store *memoryStore
+}
+
+// user returns the stored user with the given id. As with MongoDB, an id which isn't a valid
+// ObjectID is an error, while an unknown id returns nil. The caller must hold the lock.
+func (m MemoryUserModel) user(id string) (*User, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	return m.store.users[id], nil
+}
+
+func (m MemoryUserModel) Insert(ctx context.Context, user *User) (string, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	for _, u := range m.store.users {
+		if u.Email == user.Email {
+			return "", ErrDuplicateEmail
+		}
+	}
+
+	stored := copyUser(user)
+	stored.ID = newID()
+	m.store.users[stored.ID] = stored
+
+	return stored.ID, nil
+}
+
+func (m MemoryUserModel) Get(ctx context.Context, id string) (*User, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	user, err := m.user(id)
+	if err != nil || user == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyUser(user), nil
+}
+
+func (m MemoryUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	for _, user := range m.store.users {
+		if user.Email == email {
+			return copyUser(user), nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MemoryUserModel) GetAllVouchers(ctx context.Context, id string) (map[string]int, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return maps.Clone(user.Vouchers), nil
+}
+
+func (m MemoryUserModel) RedeemVoucher(ctx context.Context, id string, code string, number int) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return err
+	}
+	// As with MongoDB, an unknown user can't be told apart from a voucher which was already
+	// redeemed.
+	if user == nil {
+		return ErrVoucherAlreadyRedeeemed
+	}
+	if _, ok := user.Vouchers[code]; ok {
+		return ErrVoucherAlreadyRedeeemed
+	}
+
+	if user.Vouchers == nil {
+		user.Vouchers = make(map[string]int)
+	}
+	user.Vouchers[code] = number
+
+	return nil
+}
+
+func (m MemoryUserModel) GetPoints(ctx context.Context, id string) (int, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return 0, err
+	}
+	if user == nil {
+		return 0, ErrRecordNotFound
+	}
+
+	return user.Points, nil
+}
+
+func (m MemoryUserModel) AddPoints(ctx context.Context, id string, points int) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return err
+	}
+	if points < 0 && (user == nil || user.Points < -points) {
+		return ErrInsufficientPoints
+	}
+	if user == nil {
+		return nil
+	}
+
+	user.Points += points
+
+	return nil
+}
+
+// DeductPointsAndCreateVoucher checks both conditions before changing anything, so that either
+// both the user and the voucher are written or neither is, as with the MongoDB transaction.
+func (m MemoryUserModel) DeductPointsAndCreateVoucher(ctx context.Context, id string, points int, voucher *Voucher) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Points < points {
+		return ErrExchangePointsForVoucher
+	}
+	if _, ok := user.Vouchers[voucher.Code]; ok {
+		return ErrExchangePointsForVoucher
+	}
+	if _, ok := m.store.vouchers[voucher.Code]; ok {
+		return ErrVoucherAlreadyExists
+	}
+
+	if user.Vouchers == nil {
+		user.Vouchers = make(map[string]int)
+	}
+	user.Vouchers[voucher.Code] = 1
+	user.Points -= points
+
+	stored := *voucher
+	m.store.vouchers[voucher.Code] = &stored
+
+	return nil
+}
+
+func (m MemoryUserModel) UpdateVoucherList(ctx context.Context, id string, vouchers map[string]int) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil || user == nil {
+		return err
+	}
+
+	user.Vouchers = maps.Clone(vouchers)
+
+	return nil
+}
+
+func (m MemoryUserModel) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return 0, err
+	}
+	if user == nil {
+		return 0, ErrRecordNotFound
+	}
+
+	user.FailedLogins++
+
+	return user.FailedLogins, nil
+}
+
+// update applies fn to the stored user with the given id, returning ErrRecordNotFound if there is
+// no such user.
+func (m MemoryUserModel) update(id string, fn func(user *User)) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrRecordNotFound
+	}
+
+	fn(user)
+
+	return nil
+}
+
+func (m MemoryUserModel) Lock(ctx context.Context, id string, until time.Time) error {
+	return m.update(id, func(user *User) {
+		user.LockedUntil = until
+	})
+}
+
+func (m MemoryUserModel) ResetFailedLogins(ctx context.Context, id string) error {
+	return m.update(id, func(user *User) {
+		user.FailedLogins = 0
+		user.LockedUntil = time.Time{}
+	})
+}
+
+func (m MemoryUserModel) SetMFAPendingSecret(ctx context.Context, id string, secret string) error {
+	return m.update(id, func(user *User) {
+		user.MFA.PendingSecret = secret
+	})
+}
+
+func (m MemoryUserModel) EnableMFA(ctx context.Context, id string, secret string, recoveryCodes [][]byte, step int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return err
+	}
+	// Another enrolment replaced the pending secret in the meantime.
+	if user == nil || user.MFA.PendingSecret != secret {
+		return ErrEditConflict
+	}
+
+	user.MFA = MFA{
+		Enabled:       true,
+		Secret:        secret,
+		RecoveryCodes: cloneByteSlices(recoveryCodes),
+		LastStep:      step,
+	}
+
+	return nil
+}
+
+func (m MemoryUserModel) DisableMFA(ctx context.Context, id string) error {
+	return m.update(id, func(user *User) {
+		user.MFA = MFA{}
+	})
+}
+
+func (m MemoryUserModel) UseMFAStep(ctx context.Context, id string, step int64) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.MFA.LastStep >= step {
+		return ErrMFACodeReused
+	}
+
+	user.MFA.LastStep = step
+
+	return nil
+}
+
+func (m MemoryUserModel) ConsumeRecoveryCode(ctx context.Context, id string, hash []byte) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrRecordNotFound
+	}
+
+	codes := user.MFA.RecoveryCodes[:0:0]
+	for _, code := range user.MFA.RecoveryCodes {
+		if !bytes.Equal(code, hash) {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == len(user.MFA.RecoveryCodes) {
+		return ErrRecordNotFound
+	}
+	user.MFA.RecoveryCodes = codes
+
+	return nil
+}
+
+func (m MemoryUserModel) GetByIdentity(ctx context.Context, provider string, subject string) (*User, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	for _, user := range m.store.users {
+		for _, identity := range user.Identities {
+			if identity.Provider == provider && identity.Subject == subject {
+				return copyUser(user), nil
+			}
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MemoryUserModel) AddIdentity(ctx context.Context, id string, identity Identity) error {
+	return m.update(id, func(user *User) {
+		user.Identities = append(user.Identities, identity)
+		user.UpdatedAt = time.Now()
+	})
+}
+
+func (m MemoryUserModel) ScheduleDeletion(ctx context.Context, id string, at time.Time) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.DeletedAt.IsZero() {
+		return ErrRecordNotFound
+	}
+
+	user.DeletionScheduledAt = at
+
+	return nil
+}
+
+func (m MemoryUserModel) CancelDeletion(ctx context.Context, id string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.DeletedAt.IsZero() {
+		return ErrRecordNotFound
+	}
+
+	user.DeletionScheduledAt = time.Time{}
+
+	return nil
+}
+
+func (m MemoryUserModel) GetAllDueForDeletion(ctx context.Context, now time.Time) ([]string, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	ids := []string{}
+	for id, user := range m.store.users {
+		if user.IsDeletionScheduled() && !user.DeletionScheduledAt.After(now) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func (m MemoryUserModel) Anonymize(ctx context.Context, id string, at time.Time) error {
+	// Hash the random password before taking the lock, since bcrypt is slow.
+	plaintext, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	var password Password
+	err = password.Set(plaintext)
+	if err != nil {
+		return err
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	user, err := m.user(id)
+	if err != nil {
+		return err
+	}
+	// Only anonymize the user if the deletion is still scheduled and due.
+	if user == nil || !user.IsDeletionScheduled() || user.DeletionScheduledAt.After(at) {
+		return ErrRecordNotFound
+	}
+
+	user.Name = "Deleted user"
+	user.Email = "deleted-" + id + "@deleted.invalid"
+	user.Password = Password{Hash: password.Hash}
+	user.Addresses = []Address{}
+	user.Phone = []Phone{}
+	user.MFA = MFA{}
+	user.DeletedAt = at
+	user.UpdatedAt = at
+	user.Identities = nil
+	user.Roles = nil
+	user.DeletionScheduledAt = time.Time{}
+	user.Version++
+
+	return nil
+}
+
+func (m MemoryUserModel) AddRole(ctx context.Context, id string, role string) error {
+	return m.update(id, func(user *User) {
+		if !user.HasRole(role) {
+			user.Roles = append(user.Roles, role)
+		}
+		user.UpdatedAt = time.Now()
+	})
+}
@@ -1,8 +1,13 @@
 package data
 
+import (
+	"context"
+	"time"
+)
+
 type MockUserModel struct{}
 
-func (m MockUserModel) Insert(user *User) (string, error) {
+func (m MockUserModel) Insert(ctx context.Context, user *User) (string, error) {
 	switch user.Email {
 	case "test@example.com":
 		return "testID", nil
@@ -11,34 +16,106 @@ func (m MockUserModel) Insert(user *User) (string, error) {
 	}
 }
 
-func (m MockUserModel) Get(id string) (*User, error) {
-	return nil, nil
+func (m MockUserModel) Get(ctx context.Context, id string) (*User, error) {
+	switch id {
+	case "testID":
+		return &User{ID: id, Version: 1}, nil
+	default:
+		return nil, nil
+	}
 }
 
-func (m MockUserModel) GetByEmail(email string) (*User, error) {
-	return nil, nil
+func (m MockUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	switch email {
+	case "locked@example.com":
+		return &User{ID: "lockedID", Email: email, LockedUntil: time.Now().Add(time.Hour)}, nil
+	case "unknown@example.com":
+		return nil, ErrRecordNotFound
+	default:
+		return nil, nil
+	}
 }
 
-func (m MockUserModel) GetAllVouchers(id string) (map[string]int, error) {
+func (m MockUserModel) GetAllVouchers(ctx context.Context, id string) (map[string]int, error) {
 	return nil, nil
 }
 
-func (m MockUserModel) RedeemVoucher(userID string, voucherCode string, usageCount int) error {
+func (m MockUserModel) RedeemVoucher(ctx context.Context, userID string, voucherCode string, usageCount int) error {
+	return nil
+}
+
+func (m MockUserModel) GetPoints(ctx context.Context, id string) (int, error) {
+	return 0, nil
+}
+
+func (m MockUserModel) AddPoints(ctx context.Context, id string, points int) error {
 	return nil
 }
 
-func (m MockUserModel) GetPoints(id string) (int, error) {
+func (m MockUserModel) DeductPointsAndCreateVoucher(ctx context.Context, id string, points int, voucher *Voucher) error {
+	return nil
+}
+
+func (m MockUserModel) UpdateVoucherList(ctx context.Context, id string, vouchers map[string]int) error {
+	return nil
+}
+
+func (m MockUserModel) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
 	return 0, nil
 }
 
-func (m MockUserModel) AddPoints(id string, points int) error {
+func (m MockUserModel) Lock(ctx context.Context, id string, until time.Time) error {
 	return nil
 }
 
-func (m MockUserModel) DeductPointsAndCreateVoucher(id string, points int, voucher *Voucher) error {
+func (m MockUserModel) ResetFailedLogins(ctx context.Context, id string) error {
+	return nil
+}
+
+func (m MockUserModel) SetMFAPendingSecret(ctx context.Context, id string, secret string) error {
+	return nil
+}
+
+func (m MockUserModel) EnableMFA(ctx context.Context, id string, secret string, recoveryCodes [][]byte, step int64) error {
+	return nil
+}
+
+func (m MockUserModel) DisableMFA(ctx context.Context, id string) error {
+	return nil
+}
+
+func (m MockUserModel) UseMFAStep(ctx context.Context, id string, step int64) error {
+	return nil
+}
+
+func (m MockUserModel) ConsumeRecoveryCode(ctx context.Context, id string, hash []byte) error {
+	return nil
+}
+
+func (m MockUserModel) GetByIdentity(ctx context.Context, provider string, subject string) (*User, error) {
+	return nil, ErrRecordNotFound
+}
+
+func (m MockUserModel) AddIdentity(ctx context.Context, id string, identity Identity) error {
+	return nil
+}
+
+func (m MockUserModel) ScheduleDeletion(ctx context.Context, id string, at time.Time) error {
+	return nil
+}
+
+func (m MockUserModel) CancelDeletion(ctx context.Context, id string) error {
+	return nil
+}
+
+func (m MockUserModel) GetAllDueForDeletion(ctx context.Context, now time.Time) ([]string, error) {
+	return nil, nil
+}
+
+func (m MockUserModel) Anonymize(ctx context.Context, id string, at time.Time) error {
 	return nil
 }
 
-func (m MockUserModel) UpdateVoucherList(id string, vouchers map[string]int) error {
+func (m MockUserModel) AddRole(ctx context.Context, id string, role string) error {
 	return nil
 }
@@ -1,8 +1,13 @@
 package data
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"errors"
 	"log"
+	"math/big"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/toduluz/savingsquadsbackend/internal/validator"
@@ -15,6 +20,8 @@ var (
 	ErrVoucherAlreadyExists     = errors.New("voucher already exists")
 	ErrExchangePointsForVoucher = errors.New("problem exchanging points for voucher")
 	ErrVoucherAlreadyRedeeemed  = errors.New("voucher already redeemed")
+	ErrMFACodeReused            = errors.New("mfa code already used")
+	ErrInsufficientPoints       = errors.New("insufficient points")
 )
 
 // AnonymousUser represents an anonymous user.
@@ -35,18 +42,57 @@ type User struct {
 	Vouchers  map[string]int `json:"vouchers" bson:"vouchers"`
 	Points    int            `json:"points" bson:"points"`
 	Version   int            `json:"version" bson:"version"`
+	// FailedLogins counts consecutive failed login attempts and LockedUntil holds the time
+	// until which login is refused. Both are reset on a successful login or admin unlock.
+	FailedLogins int       `json:"-" bson:"failed_logins"`
+	LockedUntil  time.Time `json:"-" bson:"locked_until"`
+	MFA          MFA       `json:"-" bson:"mfa"`
+	// Identities holds the external OpenID Connect accounts which can be used to sign in as
+	// the user.
+	Identities []Identity `json:"-" bson:"identities,omitempty"`
+	// DeletionScheduledAt holds the time at which the user asked for their account to be
+	// deleted, once the cooling-off period has passed, and DeletedAt the time at which it was
+	// anonymized.
+	DeletionScheduledAt time.Time `json:"-" bson:"deletion_scheduled_at,omitempty"`
+	DeletedAt           time.Time `json:"-" bson:"deleted_at,omitempty"`
+	// Roles holds the roles granted to the user, such as RoleAdmin for the admin routes.
+	Roles []string `json:"-" bson:"roles,omitempty"`
+}
+
+// Roles which can be granted to a user.
+const (
+	RoleAdmin = "admin"
+)
+
+// Roles is the list of every role which can be granted to a user.
+var Roles = []string{RoleAdmin}
+
+// HasRole reports whether the user has been granted the role.
+func (u *User) HasRole(role string) bool {
+	return validator.In(role, u.Roles...)
 }
 
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+// IsDeletionScheduled reports whether the user has asked for their account to be deleted.
+func (u *User) IsDeletionScheduled() bool {
+	return !u.DeletionScheduledAt.IsZero()
+}
+
+// IsLocked reports whether the user account is temporarily locked at the given time.
+func (u *User) IsLocked(now time.Time) bool {
+	return now.Before(u.LockedUntil)
+}
+
 // UserModel struct DB and allows us to work with the User struct type
 // and the users collection in our database.
 type UserModel struct {
 	DB       *mongo.Database
 	InfoLog  *log.Logger
 	ErrorLog *log.Logger
+	Timeout  time.Duration
 }
 
 // password tyep is a struct containing the plaintext and hashed version of a password for a User.
@@ -58,6 +104,60 @@ type Password struct {
 	Hash      []byte  `json:"-" bson:"hash"`
 }
 
+// MFA type is a struct containing the TOTP two-factor authentication settings of a User.
+// PendingSecret holds a secret which has been generated but not yet confirmed with a valid code,
+// RecoveryCodes holds the SHA-256 hashes of the unused recovery codes and LastStep holds the
+// time step of the last accepted code, so that a code can't be replayed.
+type MFA struct {
+	Enabled       bool     `json:"-" bson:"enabled"`
+	Secret        string   `json:"-" bson:"secret,omitempty"`
+	PendingSecret string   `json:"-" bson:"pending_secret,omitempty"`
+	RecoveryCodes [][]byte `json:"-" bson:"recovery_codes,omitempty"`
+	LastStep      int64    `json:"-" bson:"last_step"`
+}
+
+// Identity type is a struct containing an external account linked to a User, identified by the
+// name of the OpenID Connect provider and the subject of its ID tokens.
+type Identity struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Subject  string    `json:"-" bson:"subject"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// recoveryCodeAlphabet excludes characters which are easily confused with each other.
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes returns n random single-use recovery codes in the format "xxxxx-xxxxx",
+// along with their hashes for storage.
+func GenerateRecoveryCodes(n int) ([]string, [][]byte, error) {
+	codes := make([]string, n)
+	hashes := make([][]byte, n)
+
+	for i := range codes {
+		b := make([]byte, 10)
+		for j := range b {
+			randNum, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+			if err != nil {
+				return nil, nil, err
+			}
+			b[j] = recoveryCodeAlphabet[randNum.Int64()]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the SHA-256 hash of a recovery code, ignoring case, spaces and
+// dashes. Recovery codes have enough entropy that a fast hash is sufficient.
+func HashRecoveryCode(code string) []byte {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	hash := sha256.Sum256([]byte(code))
+	return hash[:]
+}
+
 // Address type is a struct containing the address of a User.
 type Address struct {
 	Street     string `json:"street" bson:"street"`
@@ -100,6 +200,25 @@ func (p *Password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// dummyPassword holds a bcrypt hash which is compared against when a login is attempted for an
+// email address that doesn't exist. It is generated lazily because bcrypt is deliberately slow.
+var (
+	dummyPassword     Password
+	dummyPasswordOnce sync.Once
+)
+
+// SimulateMatches performs a bcrypt comparison against a dummy hash of the same cost as real
+// passwords, so that a login for an unknown email takes as long as one with a wrong password and
+// the response timing doesn't reveal whether an account exists.
+func SimulateMatches(plaintextPassword string) {
+	dummyPasswordOnce.Do(func() {
+		if err := dummyPassword.Set("dummy-password-for-timing"); err != nil {
+			panic(err)
+		}
+	})
+	dummyPassword.Matches(plaintextPassword)
+}
+
 // ValidatePoints checks that the Points field is not a negative integer.
 func ValidatePoints(v *validator.Validator, points int) {
 	v.Check(points >= 0, "points", "must be a positive integer")
@@ -141,3 +260,9 @@ func ValidateUser(v *validator.Validator, user *User) {
 		panic("missing password hash for user")
 	}
 }
+
+// ValidateRole checks that the role is one which can be granted.
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(role != "", "role", "must be provided")
+	v.Check(validator.In(role, Roles...), "role", "must be one of "+strings.Join(Roles, ", "))
+}
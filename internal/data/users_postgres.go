@@ -0,0 +1,575 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PostgresUserModel is the PostgreSQL implementation of the Users model. Its methods return the
+// same errors as those of UserModel in the same situations.
+type PostgresUserModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	Timeout  time.Duration
+}
+
+// userColumns selects a user along with the vouchers they own and their linked identities, in the
+// order expected by scanUser.
+const userColumns = `
+	u.id, u.created_at, u.updated_at, u.name, u.email, u.password_hash, u.addresses, u.phone,
+	u.points, u.version, u.failed_logins, u.locked_until, u.mfa_enabled, u.mfa_secret,
+	u.mfa_pending_secret, u.mfa_recovery_codes, u.mfa_last_step, u.deletion_scheduled_at,
+	u.deleted_at, u.roles,
+	COALESCE((SELECT jsonb_object_agg(code, remaining) FROM user_vouchers WHERE user_id = u.id), '{}'),
+	COALESCE((SELECT jsonb_agg(jsonb_build_object('provider', provider, 'subject', subject, 'linked_at', linked_at) ORDER BY linked_at)
+		FROM user_identities WHERE user_id = u.id), '[]')`
+
+// scanUser scans a row selected with userColumns.
+func scanUser(row interface{ Scan(...any) error }) (*User, error) {
+	var (
+		user                                    User
+		addresses, phone, vouchers, identities  []byte
+		recoveryCodes                           pq.ByteaArray
+		roles                                   pq.StringArray
+		lockedUntil, deletionScheduled, deleted sql.NullTime
+	)
+
+	err := row.Scan(
+		&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.Name, &user.Email, &user.Password.Hash,
+		&addresses, &phone, &user.Points, &user.Version, &user.FailedLogins, &lockedUntil,
+		&user.MFA.Enabled, &user.MFA.Secret, &user.MFA.PendingSecret, &recoveryCodes,
+		&user.MFA.LastStep, &deletionScheduled, &deleted, &roles, &vouchers, &identities,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	user.LockedUntil = lockedUntil.Time
+	user.DeletionScheduledAt = deletionScheduled.Time
+	user.DeletedAt = deleted.Time
+	if len(recoveryCodes) > 0 {
+		user.MFA.RecoveryCodes = recoveryCodes
+	}
+	if len(roles) > 0 {
+		user.Roles = roles
+	}
+
+	if err = json.Unmarshal(addresses, &user.Addresses); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(phone, &user.Phone); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(vouchers, &user.Vouchers); err != nil {
+		return nil, err
+	}
+
+	// The subject isn't part of the JSON encoding of an Identity, so decode into a struct of
+	// our own.
+	var rows []struct {
+		Provider string    `json:"provider"`
+		Subject  string    `json:"subject"`
+		LinkedAt time.Time `json:"linked_at"`
+	}
+	if err = json.Unmarshal(identities, &rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		user.Identities = append(user.Identities, Identity{Provider: row.Provider, Subject: row.Subject, LinkedAt: row.LinkedAt})
+	}
+
+	return &user, nil
+}
+
+// getUser returns the user matching the given condition on the users table aliased as u.
+func (m PostgresUserModel) getUser(ctx context.Context, where string, args ...any) (*User, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return scanUser(m.DB.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users u WHERE `+where, args...))
+}
+
+// exec runs an update of a single user and returns notFound if no user matched.
+func (m PostgresUserModel) exec(ctx context.Context, notFound error, query string, args ...any) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if err = rowsAffected(result); err != nil {
+		return notFound
+	}
+
+	return nil
+}
+
+// Insert inserts a new user along with their vouchers and identities, returning ErrDuplicateEmail
+// if another user has the same email address.
+func (m PostgresUserModel) Insert(ctx context.Context, user *User) (string, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	addresses, err := json.Marshal(nonNil(user.Addresses))
+	if err != nil {
+		return "", err
+	}
+	phone, err := json.Marshal(nonNil(user.Phone))
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	id := newID()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO users (id, created_at, updated_at, name, email, password_hash, addresses, phone,
+			points, version, failed_logins, locked_until, mfa_enabled, mfa_secret, mfa_pending_secret,
+			mfa_recovery_codes, mfa_last_step, deletion_scheduled_at, deleted_at, roles)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)`,
+		id, user.CreatedAt, user.UpdatedAt, user.Name, user.Email, nonNil(user.Password.Hash), string(addresses), string(phone),
+		user.Points, user.Version, user.FailedLogins, nullTime(user.LockedUntil), user.MFA.Enabled,
+		user.MFA.Secret, user.MFA.PendingSecret, pq.ByteaArray(nonNil(user.MFA.RecoveryCodes)),
+		user.MFA.LastStep, nullTime(user.DeletionScheduledAt), nullTime(user.DeletedAt),
+		pq.StringArray(nonNil(user.Roles)))
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "users_email_key"):
+			return "", ErrDuplicateEmail
+		default:
+			return "", err
+		}
+	}
+
+	for code, remaining := range user.Vouchers {
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_vouchers (user_id, code, remaining) VALUES ($1, $2, $3)`, id, code, remaining)
+		if err != nil {
+			return "", err
+		}
+	}
+	for _, identity := range user.Identities {
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_identities (provider, subject, user_id, linked_at) VALUES ($1, $2, $3, $4)`,
+			identity.Provider, identity.Subject, id, identity.LinkedAt)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (m PostgresUserModel) Get(ctx context.Context, id string) (*User, error) {
+	// An invalid id can't match any user.
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.getUser(ctx, `u.id = $1`, id)
+}
+
+func (m PostgresUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return m.getUser(ctx, `u.email = $1`, email)
+}
+
+func (m PostgresUserModel) GetAllVouchers(ctx context.Context, id string) (map[string]int, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+
+	user, err := m.getUser(ctx, `u.id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.Vouchers, nil
+}
+
+func (m PostgresUserModel) RedeemVoucher(ctx context.Context, id string, code string, number int) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	// Nothing is inserted if the user already owns the voucher, or doesn't exist.
+	return m.exec(ctx, ErrVoucherAlreadyRedeeemed, `
+		INSERT INTO user_vouchers (user_id, code, remaining)
+		SELECT id, $2::text, $3::integer FROM users WHERE id = $1
+		ON CONFLICT DO NOTHING`, id, code, number)
+}
+
+func (m PostgresUserModel) GetPoints(ctx context.Context, id string) (int, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return 0, err
+	}
+
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var points int
+	err := m.DB.QueryRowContext(ctx, `SELECT points FROM users WHERE id = $1`, id).Scan(&points)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return points, nil
+}
+
+func (m PostgresUserModel) AddPoints(ctx context.Context, id string, points int) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	// As with MongoDB, adding points to an unknown user isn't an error, but removing more points
+	// than the user has is.
+	var insufficient error
+	if points < 0 {
+		insufficient = ErrInsufficientPoints
+	}
+	return m.exec(ctx, insufficient, `UPDATE users SET points = points + $2 WHERE id = $1 AND points + $2 >= 0`, id, points)
+}
+
+// DeductPointsAndCreateVoucher locks the user's row while it checks the points and vouchers of
+// the user, so that concurrent exchanges can't spend the same points twice.
+func (m PostgresUserModel) DeductPointsAndCreateVoucher(ctx context.Context, id string, points int, voucher *Voucher) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var balance int
+	var owned bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT points, EXISTS (SELECT 1 FROM user_vouchers WHERE user_id = $1 AND code = $2)
+		FROM users WHERE id = $1
+		FOR UPDATE`, id, voucher.Code).Scan(&balance, &owned)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrExchangePointsForVoucher
+		default:
+			return err
+		}
+	}
+	if balance < points || owned {
+		return ErrExchangePointsForVoucher
+	}
+
+	err = insertVoucher(ctx, tx, voucher)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "vouchers_pkey"):
+			return ErrVoucherAlreadyExists
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO user_vouchers (user_id, code, remaining) VALUES ($1, $2, 1)`, id, voucher.Code)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE users SET points = points - $2 WHERE id = $1`, id, points)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m PostgresUserModel) UpdateVoucherList(ctx context.Context, id string, vouchers map[string]int) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so that concurrent updates of the list don't interleave. As with MongoDB,
+	// updating an unknown user isn't an error.
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT true FROM users WHERE id = $1 FOR UPDATE`, id).Scan(&exists)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_vouchers WHERE user_id = $1`, id)
+	if err != nil {
+		return err
+	}
+	for code, remaining := range vouchers {
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_vouchers (user_id, code, remaining) VALUES ($1, $2, $3)`, id, code, remaining)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m PostgresUserModel) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return 0, err
+	}
+
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	var failures int
+	err := m.DB.QueryRowContext(ctx, `UPDATE users SET failed_logins = failed_logins + 1 WHERE id = $1 RETURNING failed_logins`, id).Scan(&failures)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return failures, nil
+}
+
+func (m PostgresUserModel) Lock(ctx context.Context, id string, until time.Time) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	return m.exec(ctx, ErrRecordNotFound, `UPDATE users SET locked_until = $2 WHERE id = $1`, id, nullTime(until))
+}
+
+func (m PostgresUserModel) ResetFailedLogins(ctx context.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	return m.exec(ctx, ErrRecordNotFound, `UPDATE users SET failed_logins = 0, locked_until = NULL WHERE id = $1`, id)
+}
+
+func (m PostgresUserModel) SetMFAPendingSecret(ctx context.Context, id string, secret string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	return m.exec(ctx, ErrRecordNotFound, `UPDATE users SET mfa_pending_secret = $2 WHERE id = $1`, id, secret)
+}
+
+func (m PostgresUserModel) EnableMFA(ctx context.Context, id string, secret string, recoveryCodes [][]byte, step int64) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	// If no row matched, another enrolment replaced the pending secret in the meantime.
+	return m.exec(ctx, ErrEditConflict, `
+		UPDATE users
+		SET mfa_enabled = true, mfa_secret = $2, mfa_recovery_codes = $3, mfa_last_step = $4,
+			mfa_pending_secret = ''
+		WHERE id = $1 AND mfa_pending_secret = $2`,
+		id, secret, pq.ByteaArray(nonNil(recoveryCodes)), step)
+}
+
+func (m PostgresUserModel) DisableMFA(ctx context.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	return m.exec(ctx, ErrRecordNotFound, `
+		UPDATE users
+		SET mfa_enabled = false, mfa_secret = '', mfa_pending_secret = '', mfa_recovery_codes = '{}',
+			mfa_last_step = 0
+		WHERE id = $1`, id)
+}
+
+func (m PostgresUserModel) UseMFAStep(ctx context.Context, id string, step int64) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	return m.exec(ctx, ErrMFACodeReused, `UPDATE users SET mfa_last_step = $2 WHERE id = $1 AND mfa_last_step < $2`, id, step)
+}
+
+func (m PostgresUserModel) ConsumeRecoveryCode(ctx context.Context, id string, hash []byte) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	return m.exec(ctx, ErrRecordNotFound, `
+		UPDATE users SET mfa_recovery_codes = array_remove(mfa_recovery_codes, $2::bytea)
+		WHERE id = $1 AND $2::bytea = ANY (mfa_recovery_codes)`, id, hash)
+}
+
+func (m PostgresUserModel) GetByIdentity(ctx context.Context, provider string, subject string) (*User, error) {
+	return m.getUser(ctx, `u.id = (SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2)`, provider, subject)
+}
+
+func (m PostgresUserModel) AddIdentity(ctx context.Context, id string, identity Identity) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	return m.exec(ctx, ErrRecordNotFound, `
+		WITH u AS (UPDATE users SET updated_at = $5 WHERE id = $1 RETURNING id)
+		INSERT INTO user_identities (provider, subject, user_id, linked_at)
+		SELECT $2::text, $3::text, id, $4::timestamptz FROM u`,
+		id, identity.Provider, identity.Subject, identity.LinkedAt, time.Now())
+}
+
+func (m PostgresUserModel) ScheduleDeletion(ctx context.Context, id string, at time.Time) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	return m.exec(ctx, ErrRecordNotFound, `UPDATE users SET deletion_scheduled_at = $2 WHERE id = $1 AND deleted_at IS NULL`, id, at)
+}
+
+func (m PostgresUserModel) CancelDeletion(ctx context.Context, id string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	return m.exec(ctx, ErrRecordNotFound, `UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1 AND deleted_at IS NULL`, id)
+}
+
+func (m PostgresUserModel) GetAllDueForDeletion(ctx context.Context, now time.Time) ([]string, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT id FROM users WHERE deletion_scheduled_at <= $1`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (m PostgresUserModel) Anonymize(ctx context.Context, id string, at time.Time) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	// Replace the password with a random one which nobody knows.
+	plaintext, err := randomString(32)
+	if err != nil {
+		return err
+	}
+	var password Password
+	err = password.Set(plaintext)
+	if err != nil {
+		return err
+	}
+
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only anonymize the user if the deletion is still scheduled and due, in case it was
+	// cancelled after it was picked up.
+	result, err := tx.ExecContext(ctx, `
+		UPDATE users
+		SET name = 'Deleted user', email = $3, password_hash = $4, addresses = '[]', phone = '[]',
+			mfa_enabled = false, mfa_secret = '', mfa_pending_secret = '', mfa_recovery_codes = '{}',
+			mfa_last_step = 0, roles = '{}', deleted_at = $2, updated_at = $2, deletion_scheduled_at = NULL,
+			version = version + 1
+		WHERE id = $1 AND deletion_scheduled_at <= $2`,
+		id, at, "deleted-"+id+"@deleted.invalid", password.Hash)
+	if err != nil {
+		return err
+	}
+	if err = rowsAffected(result); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_identities WHERE user_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m PostgresUserModel) AddRole(ctx context.Context, id string, role string) error {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return err
+	}
+
+	return m.exec(ctx, ErrRecordNotFound, `
+		UPDATE users
+		SET roles = CASE WHEN $2 = ANY (roles) THEN roles ELSE array_append(roles, $2) END, updated_at = $3
+		WHERE id = $1`, id, role, time.Now())
+}
+
+// nonNil returns an empty slice in place of nil, so that it is stored as an empty array rather
+// than NULL.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
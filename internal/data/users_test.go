@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"reflect"
 	"testing"
 	"time"
@@ -30,7 +31,7 @@ func TestInsert(t *testing.T) {
 		Version:   1,
 	}
 
-	id, err := testModel.Users.Insert(testUser)
+	id, err := testModel.Users.Insert(context.Background(), testUser)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -38,7 +39,7 @@ func TestInsert(t *testing.T) {
 	testUser.ID = id
 	testUser.Password.plaintext = nil
 
-	got, err := testModel.Users.Get(id)
+	got, err := testModel.Users.Get(context.Background(), id)
 	if err != nil {
 		t.Fatal(err)
 	}
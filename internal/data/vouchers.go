@@ -15,13 +15,14 @@ type VoucherModel struct {
 	DB       *mongo.Database
 	InfoLog  *log.Logger
 	ErrorLog *log.Logger
+	Timeout  time.Duration
 }
 
 // Insert a new voucher record into the vouchers table. If the voucher code already exists and is active, return an error. Else,
 // insert the new voucher record and return nil. If the voucher code already exists but is inactive, insert the new voucher record.
-func (m VoucherModel) Insert(voucher *Voucher) error {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m VoucherModel) Insert(ctx context.Context, voucher *Voucher) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	// Insert the voucher into the "vouchers" collection.
@@ -42,9 +43,9 @@ func (m VoucherModel) Insert(voucher *Voucher) error {
 }
 
 // Get returns a specific Voucher based on its id.
-func (m VoucherModel) Get(code string) (*Voucher, error) {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m VoucherModel) Get(ctx context.Context, code string) (*Voucher, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	// Define a Voucher to decode the document into
@@ -66,9 +67,9 @@ func (m VoucherModel) Get(code string) (*Voucher, error) {
 	return &voucher, nil
 }
 
-func (m VoucherModel) GetVoucherList(voucherCodes []string) ([]Voucher, error) {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m VoucherModel) GetVoucherList(ctx context.Context, voucherCodes []string) ([]Voucher, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 	// Define a Voucher to decode the document into
 	var vouchers []Voucher
@@ -96,9 +97,9 @@ func (m VoucherModel) GetVoucherList(voucherCodes []string) ([]Voucher, error) {
 // less than the usageLimit, increment the usageCount by 1 and set the active field to true. If the usageCount is equal to the usageLimit,
 // set the active field to false. If the voucher code does not exist, return an error. If the voucher code exists but active is false,
 // return an error.
-func (m VoucherModel) UpdateUsageCount(code string) error {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m VoucherModel) UpdateUsageCount(ctx context.Context, code string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	filter := bson.M{"_id": code, "active": true}
@@ -141,9 +142,9 @@ func (m VoucherModel) UpdateUsageCount(code string) error {
 }
 
 // Delete is a placeholder method for deleting a specific record in the Vouchers table.
-func (m VoucherModel) Delete(code string) error {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m VoucherModel) Delete(ctx context.Context, code string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	// Define the filter to match the document to delete.
@@ -162,9 +163,36 @@ func (m VoucherModel) Delete(code string) error {
 	return nil
 }
 
-func (m VoucherModel) GetAllVouchers(code string, starts time.Time, expires time.Time, active bool, minSpend int, category string, f *Filters) ([]Voucher, *Metadata, error) {
-	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// Deactivate marks the voucher as inactive, so that it can no longer be redeemed or used.
+func (m VoucherModel) Deactivate(ctx context.Context, code string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Define the update document to set the new values of the fields.
+	update := bson.M{
+		"$set": bson.M{
+			"active":     false,
+			"updated_at": time.Now(),
+		},
+	}
+
+	// Execute the MongoDB update operation.
+	result, err := m.DB.Collection("vouchers").UpdateOne(ctx, bson.M{"_id": code}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m VoucherModel) GetAllVouchers(ctx context.Context, code string, starts time.Time, expires time.Time, active bool, minSpend int, category string, f *Filters) ([]Voucher, *Metadata, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
 	defer cancel()
 
 	// Determine the sort direction.
@@ -173,30 +201,30 @@ func (m VoucherModel) GetAllVouchers(code string, starts time.Time, expires time
 	// Build a filter based on the provided parameters.
 	filter := bson.D{}
 	if code != "" {
-		filter = append(filter, bson.E{"_id", code})
+		filter = append(filter, bson.E{Key: "_id", Value: code})
 	}
 	if !starts.IsZero() {
-		filter = append(filter, bson.E{"start", bson.M{"$gte": starts}})
+		filter = append(filter, bson.E{Key: "start", Value: bson.M{"$gte": starts}})
 	}
 	if !expires.IsZero() {
-		filter = append(filter, bson.E{"expires", bson.M{"$lte": expires}})
+		filter = append(filter, bson.E{Key: "expires", Value: bson.M{"$lte": expires}})
 	}
 	if active {
-		filter = append(filter, bson.E{"active", active})
+		filter = append(filter, bson.E{Key: "active", Value: active})
 	}
 	if category != "" {
-		filter = append(filter, bson.E{"category", category})
+		filter = append(filter, bson.E{Key: "category", Value: category})
 	}
 	if minSpend != 0 {
-		filter = append(filter, bson.E{"minSpend", bson.M{"$lte": minSpend}})
+		filter = append(filter, bson.E{Key: "minSpend", Value: bson.M{"$lte": minSpend}})
 	}
 
 	// If a cursor is provided, add a condition to the filter to only find documents with an _id greater than the cursor.
 	if f.Cursor != "" {
-		filter = append(filter, bson.E{"_id", bson.M{"$gt": f.Cursor}})
+		filter = append(filter, bson.E{Key: "_id", Value: bson.M{"$gt": f.Cursor}})
 	}
 	// Execute the MongoDB find operation with limit and sort.
-	opts := options.Find().SetLimit(int64(f.limit())).SetSort(bson.D{{f.sortColumn(), sortDirection}})
+	opts := options.Find().SetLimit(int64(f.limit())).SetSort(bson.D{{Key: f.sortColumn(), Value: sortDirection}})
 	cursor, err := m.DB.Collection("vouchers").Find(ctx, filter, opts)
 	if err != nil {
 		return nil, &Metadata{}, err
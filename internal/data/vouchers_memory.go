@@ -0,0 +1,174 @@
+package data
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MemoryVoucherModel is the in-memory implementation of the Vouchers model. Its methods return
+// the same errors as those of VoucherModel in the same situations.
+type MemoryVoucherModel struct {
+	store *memoryStore
+}
+
+func (m MemoryVoucherModel) Insert(ctx context.Context, voucher *Voucher) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.vouchers[voucher.Code]; ok {
+		return errors.New("a voucher with the provided voucher code already exists")
+	}
+
+	stored := *voucher
+	m.store.vouchers[voucher.Code] = &stored
+
+	return nil
+}
+
+func (m MemoryVoucherModel) Get(ctx context.Context, code string) (*Voucher, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	voucher, ok := m.store.vouchers[code]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	c := *voucher
+	return &c, nil
+}
+
+func (m MemoryVoucherModel) GetVoucherList(ctx context.Context, voucherCodes []string) ([]Voucher, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	var vouchers []Voucher
+	for _, code := range voucherCodes {
+		if voucher, ok := m.store.vouchers[code]; ok {
+			vouchers = append(vouchers, *voucher)
+		}
+	}
+
+	return vouchers, nil
+}
+
+// UpdateUsageCount mirrors the update pipeline of VoucherModel.UpdateUsageCount, including
+// returning ErrEditConflict when the update wouldn't change the voucher.
+func (m MemoryVoucherModel) UpdateUsageCount(ctx context.Context, code string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	voucher, ok := m.store.vouchers[code]
+	if !ok || !voucher.Active {
+		return ErrRecordNotFound
+	}
+
+	usageCount := voucher.UsageCount
+	if usageCount < voucher.UsageLimit {
+		usageCount++
+	}
+	active := voucher.UsageCount+1 != voucher.UsageLimit
+
+	if usageCount == voucher.UsageCount && active == voucher.Active {
+		return ErrEditConflict
+	}
+	voucher.UsageCount = usageCount
+	voucher.Active = active
+
+	return nil
+}
+
+func (m MemoryVoucherModel) Delete(ctx context.Context, code string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.vouchers[code]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.store.vouchers, code)
+
+	return nil
+}
+
+func (m MemoryVoucherModel) Deactivate(ctx context.Context, code string) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	voucher, ok := m.store.vouchers[code]
+	if !ok {
+		return ErrRecordNotFound
+	}
+	voucher.Active = false
+	voucher.ModifiedAt = time.Now()
+
+	return nil
+}
+
+func (m MemoryVoucherModel) GetAllVouchers(ctx context.Context, code string, starts time.Time, expires time.Time, active bool, minSpend int, category string, f *Filters) ([]Voucher, *Metadata, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	var vouchers []Voucher
+	for _, voucher := range m.store.vouchers {
+		switch {
+		case code != "" && voucher.Code != code,
+			!starts.IsZero() && voucher.Starts.Before(starts),
+			!expires.IsZero() && voucher.Expires.After(expires),
+			active && !voucher.Active,
+			category != "" && voucher.Category != category,
+			minSpend != 0 && voucher.MinSpend > minSpend,
+			f.Cursor != "" && voucher.Code <= f.Cursor:
+			continue
+		}
+		vouchers = append(vouchers, *voucher)
+	}
+
+	// Sort on the requested column, breaking ties on the code so that the order is stable.
+	column, direction := f.sortColumn(), f.sortDirection()
+	slices.SortFunc(vouchers, func(a, b Voucher) int {
+		c := compareVouchers(a, b, column)
+		if c == 0 {
+			c = strings.Compare(a.Code, b.Code)
+		}
+		return c * direction
+	})
+	if len(vouchers) > f.limit() {
+		vouchers = vouchers[:f.limit()]
+	}
+
+	var metadata Metadata
+	if len(vouchers) > 0 {
+		metadata = formatPaginationData(f.PageSize, vouchers[len(vouchers)-1].Code)
+	}
+
+	return vouchers, &metadata, nil
+}
+
+// compareVouchers compares two vouchers on the field with the given sort column name.
+func compareVouchers(a, b Voucher, column string) int {
+	switch column {
+	case "starts":
+		return a.Starts.Compare(b.Starts)
+	case "expires":
+		return a.Expires.Compare(b.Expires)
+	case "active":
+		return cmp.Compare(boolToInt(a.Active), boolToInt(b.Active))
+	case "minSpend":
+		return cmp.Compare(a.MinSpend, b.MinSpend)
+	case "category":
+		return strings.Compare(a.Category, b.Category)
+	default:
+		return strings.Compare(a.Code, b.Code)
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -1,29 +1,36 @@
 package data
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type MockVoucherModel struct{}
 
-func (m MockVoucherModel) Insert(voucher *Voucher) error {
+func (m MockVoucherModel) Insert(ctx context.Context, voucher *Voucher) error {
 	return nil
 }
 
-func (m MockVoucherModel) Get(code string) (*Voucher, error) {
+func (m MockVoucherModel) Get(ctx context.Context, code string) (*Voucher, error) {
 	return nil, nil
 }
 
-func (m MockVoucherModel) GetVoucherList(codes []string) ([]Voucher, error) {
+func (m MockVoucherModel) GetVoucherList(ctx context.Context, codes []string) ([]Voucher, error) {
 	return nil, nil
 }
 
-func (m MockVoucherModel) UpdateUsageCount(code string) error {
+func (m MockVoucherModel) UpdateUsageCount(ctx context.Context, code string) error {
 	return nil
 }
 
-func (m MockVoucherModel) Delete(code string) error {
+func (m MockVoucherModel) Delete(ctx context.Context, code string) error {
 	return nil
 }
 
-func (m MockVoucherModel) GetAllVouchers(code string, startDate time.Time, endDate time.Time, active bool, limit int, sort string, filters *Filters) ([]Voucher, *Metadata, error) {
+func (m MockVoucherModel) Deactivate(ctx context.Context, code string) error {
+	return nil
+}
+
+func (m MockVoucherModel) GetAllVouchers(ctx context.Context, code string, startDate time.Time, endDate time.Time, active bool, limit int, sort string, filters *Filters) ([]Voucher, *Metadata, error) {
 	return nil, nil, nil
 }
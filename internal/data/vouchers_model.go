@@ -42,6 +42,15 @@ func (v *Voucher) VocuherCodeGenerator() error {
 	return nil
 }
 
+// IsRedeemable reports whether the voucher is active, within its validity window at the given
+// time and below its usage limit (a usage limit of zero meaning unlimited).
+func (v *Voucher) IsRedeemable(now time.Time) bool {
+	if !v.Active || now.Before(v.Starts) || !now.Before(v.Expires) {
+		return false
+	}
+	return v.UsageLimit == 0 || v.UsageCount < v.UsageLimit
+}
+
 // ValidateVoucher runs validation checks on the Voucher type.
 func ValidateVoucher(v *validator.Validator, voucher *Voucher) {
 	v.Check(voucher.Code != "", "code", "must be provided")
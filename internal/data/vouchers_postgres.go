@@ -0,0 +1,252 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresVoucherModel is the PostgreSQL implementation of the Vouchers model. Its methods return
+// the same errors as those of VoucherModel in the same situations.
+type PostgresVoucherModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+	Timeout  time.Duration
+}
+
+// voucherColumns lists the columns of a voucher in the order expected by scanVoucher.
+const voucherColumns = `code, created_at, updated_at, description, discount, is_percentage, starts,
+	expires, active, usage_limit, usage_count, min_spend, category`
+
+// voucherSortColumns maps the sort values accepted by GetAllVouchers to columns.
+var voucherSortColumns = map[string]string{
+	"_id":      "code",
+	"starts":   "starts",
+	"expires":  "expires",
+	"active":   "active",
+	"minSpend": "min_spend",
+	"category": "category",
+}
+
+func scanVoucher(row interface{ Scan(...any) error }) (*Voucher, error) {
+	var voucher Voucher
+	err := row.Scan(
+		&voucher.Code, &voucher.CreatedAt, &voucher.ModifiedAt, &voucher.Description,
+		&voucher.Discount, &voucher.IsPercentage, &voucher.Starts, &voucher.Expires, &voucher.Active,
+		&voucher.UsageLimit, &voucher.UsageCount, &voucher.MinSpend, &voucher.Category,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &voucher, nil
+}
+
+// insertVoucher inserts a voucher using either the database or a transaction.
+func insertVoucher(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}, voucher *Voucher) error {
+	_, err := db.ExecContext(ctx, `INSERT INTO vouchers (`+voucherColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		voucher.Code, voucher.CreatedAt, voucher.ModifiedAt, voucher.Description, voucher.Discount,
+		voucher.IsPercentage, voucher.Starts, voucher.Expires, voucher.Active, voucher.UsageLimit,
+		voucher.UsageCount, voucher.MinSpend, voucher.Category)
+	return err
+}
+
+func (m PostgresVoucherModel) Insert(ctx context.Context, voucher *Voucher) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	err := insertVoucher(ctx, m.DB, voucher)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "vouchers_pkey"):
+			return errors.New("a voucher with the provided voucher code already exists")
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m PostgresVoucherModel) Get(ctx context.Context, code string) (*Voucher, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return scanVoucher(m.DB.QueryRowContext(ctx, `SELECT `+voucherColumns+` FROM vouchers WHERE code = $1`, code))
+}
+
+func (m PostgresVoucherModel) GetVoucherList(ctx context.Context, voucherCodes []string) ([]Voucher, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	return m.queryVouchers(ctx, `SELECT `+voucherColumns+` FROM vouchers WHERE code = ANY ($1)`, pq.StringArray(voucherCodes))
+}
+
+// UpdateUsageCount locks the voucher while it applies the same rules as
+// VoucherModel.UpdateUsageCount, so that concurrent uses can't exceed the usage limit.
+func (m PostgresVoucherModel) UpdateUsageCount(ctx context.Context, code string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var usageCount, usageLimit int
+	err = tx.QueryRowContext(ctx, `
+		SELECT usage_count, usage_limit FROM vouchers
+		WHERE code = $1 AND active
+		FOR UPDATE`, code).Scan(&usageCount, &usageLimit)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	count := usageCount
+	if count < usageLimit {
+		count++
+	}
+	active := usageCount+1 != usageLimit
+
+	// The voucher was active, so nothing changes if it stays active with the same count.
+	if count == usageCount && active {
+		return ErrEditConflict
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE vouchers SET usage_count = $2, active = $3 WHERE code = $1`, code, count, active)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m PostgresVoucherModel) Delete(ctx context.Context, code string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM vouchers WHERE code = $1`, code)
+	if err != nil {
+		return err
+	}
+
+	return rowsAffected(result)
+}
+
+func (m PostgresVoucherModel) Deactivate(ctx context.Context, code string) error {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `UPDATE vouchers SET active = false, updated_at = $2 WHERE code = $1`, code, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return rowsAffected(result)
+}
+
+func (m PostgresVoucherModel) GetAllVouchers(ctx context.Context, code string, starts time.Time, expires time.Time, active bool, minSpend int, category string, f *Filters) ([]Voucher, *Metadata, error) {
+	// Apply the query timeout on top of the caller's context.
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	// Build the conditions from the provided parameters, in the same way as the MongoDB filter.
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if code != "" {
+		where("code = $%d", code)
+	}
+	if !starts.IsZero() {
+		where("starts >= $%d", starts)
+	}
+	if !expires.IsZero() {
+		where("expires <= $%d", expires)
+	}
+	if active {
+		where("active = $%d", active)
+	}
+	if category != "" {
+		where("category = $%d", category)
+	}
+	if minSpend != 0 {
+		where("min_spend <= $%d", minSpend)
+	}
+	if f.Cursor != "" {
+		where("code > $%d", f.Cursor)
+	}
+
+	query := `SELECT ` + voucherColumns + ` FROM vouchers`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	// The sort column has been checked against the safelist, and ties are broken on the code so
+	// that the order is stable.
+	direction := "ASC"
+	if f.sortDirection() < 0 {
+		direction = "DESC"
+	}
+	query += fmt.Sprintf(` ORDER BY %s %s, code %s LIMIT %d`, voucherSortColumns[f.sortColumn()], direction, direction, f.limit())
+
+	vouchers, err := m.queryVouchers(ctx, query, args...)
+	if err != nil {
+		return nil, &Metadata{}, err
+	}
+
+	var metadata Metadata
+	if len(vouchers) > 0 {
+		metadata = formatPaginationData(f.PageSize, vouchers[len(vouchers)-1].Code)
+	}
+
+	return vouchers, &metadata, nil
+}
+
+func (m PostgresVoucherModel) queryVouchers(ctx context.Context, query string, args ...any) ([]Voucher, error) {
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vouchers []Voucher
+	for rows.Next() {
+		voucher, err := scanVoucher(rows)
+		if err != nil {
+			return nil, err
+		}
+		vouchers = append(vouchers, *voucher)
+	}
+
+	return vouchers, rows.Err()
+}
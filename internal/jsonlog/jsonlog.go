@@ -2,10 +2,13 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,77 +16,240 @@ import (
 type Level int8
 
 // Initialize constants which represent a specific severity level using the "iota" keyword
-// as a shortcut to assign successive integer values to the constants.
+// as a shortcut to assign successive integer values to the constants. LevelInfo keeps the value
+// of 0, so that the zero Level logs everything but debug entries.
 const (
-	LevelInfo  Level = iota // Has the value of 0.
-	LevelError              // Has the value of 1.
-	LevelFatal              // Has the value of 2.
-	LevelOff                // Has the value of 3.
+	LevelDebug Level = iota - 1 // Has the value of -1.
+	LevelInfo                   // Has the value of 0.
+	LevelWarn                   // Has the value of 1.
+	LevelError                  // Has the value of 2.
+	LevelFatal                  // Has the value of 3.
+	LevelOff                    // Has the value of 4.
 )
 
 // String returns a human-friendly string for the severity level.
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
 		return "FATAL"
+	case LevelOff:
+		return "OFF"
 	default:
 		return ""
 	}
 }
 
+// ParseLevel returns the level with the given name, ignoring case.
+func ParseLevel(name string) (Level, error) {
+	for level := LevelDebug; level <= LevelOff; level++ {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// MarshalText satisfies the encoding.TextMarshaler interface, so that levels can be used in JSON
+// and with flag.TextVar.
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(l.String())), nil
+}
+
+// UnmarshalText satisfies the encoding.TextUnmarshaler interface.
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// Field is a typed property of a log entry. Fields are created with String, Int, Duration, Err
+// and the other constructors below.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// String returns a string field.
+func String(key, value string) Field { return Field{key, value} }
+
+// Int returns an integer field, which is written as a JSON number.
+func Int(key string, value int) Field { return Field{key, value} }
+
+// Int64 returns a 64-bit integer field, which is written as a JSON number.
+func Int64(key string, value int64) Field { return Field{key, value} }
+
+// Bool returns a boolean field.
+func Bool(key string, value bool) Field { return Field{key, value} }
+
+// Duration returns a duration field, which is written as a string such as "1.5s".
+func Duration(key string, value time.Duration) Field { return Field{key, value.String()} }
+
+// Time returns a time field, which is written in RFC 3339 format.
+func Time(key string, value time.Time) Field {
+	return Field{key, value.UTC().Format(time.RFC3339Nano)}
+}
+
+// Err returns a field holding the message of the error under the "error" key.
+func Err(err error) Field {
+	if err == nil {
+		return Field{"error", nil}
+	}
+	return Field{"error", err.Error()}
+}
+
+// Any returns a field holding any value which can be marshalled to JSON.
+func Any(key string, value any) Field { return Field{key, value} }
+
 // Logger is the custom logger. It holds the output destination that the log entries will be
 // written to, the minimum severity level that log entries will be written for, and a mutex
-// for coordination the writes.
+// for coordination the writes. Child loggers created with With or WithSampling share all of
+// these with their parent, so that changing the level of one changes it for all of them.
 type Logger struct {
 	out      io.Writer
-	minLevel Level
-	mu       sync.Mutex
+	minLevel *atomic.Int32
+	mu       *sync.Mutex
+	fields   []Field
+	sampler  *sampler
 }
 
 // NewLogger returns a new Logger instance which writes log entries at or above a minimum severity
 // level to a specific output destination.
 func NewLogger(out io.Writer, minLevel Level) *Logger {
-	return &Logger{
+	l := &Logger{
 		out:      out,
-		minLevel: minLevel,
+		minLevel: new(atomic.Int32),
+		mu:       new(sync.Mutex),
 	}
+	l.minLevel.Store(int32(minLevel))
+	return l
+}
+
+// Level returns the minimum severity level of the logger.
+func (l *Logger) Level() Level {
+	return Level(l.minLevel.Load())
+}
+
+// SetLevel changes the minimum severity level of the logger, its parent and its children while
+// the application is running.
+func (l *Logger) SetLevel(level Level) {
+	l.minLevel.Store(int32(level))
+}
+
+// With returns a child logger which adds the fields to every entry it writes, such as the ID of
+// the request being handled.
+func (l *Logger) With(fields ...Field) *Logger {
+	child := *l
+	child.fields = append(append([]Field(nil), l.fields...), fields...)
+	return &child
+}
+
+// WithSampling returns a child logger which limits how often the same message is written at the
+// same level: in each interval, the first entries are written, and after those only one in
+// every thereafter. This keeps messages such as the access log or the error of a failing
+// dependency from flooding the output under load. Fatal entries are always written.
+func (l *Logger) WithSampling(first, thereafter int, interval time.Duration) *Logger {
+	child := *l
+	child.sampler = &sampler{
+		first:      first,
+		thereafter: thereafter,
+		interval:   interval,
+		counts:     make(map[sampleKey]int),
+	}
+	return &child
+}
+
+// Debug writes a log entry at the DEBUG level.
+func (l *Logger) Debug(message string, fields ...Field) {
+	l.print(LevelDebug, message, fields)
+}
+
+// Info writes a log entry at the INFO level.
+func (l *Logger) Info(message string, fields ...Field) {
+	l.print(LevelInfo, message, fields)
+}
+
+// Warn writes a log entry at the WARN level.
+func (l *Logger) Warn(message string, fields ...Field) {
+	l.print(LevelWarn, message, fields)
+}
+
+// Error writes a log entry at the ERROR level, with a stack trace.
+func (l *Logger) Error(message string, fields ...Field) {
+	l.print(LevelError, message, fields)
 }
 
 // PrintInfo is a helper that writes Info level log entries.
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
-	l.print(LevelInfo, message, properties)
+	l.print(LevelInfo, message, propertyFields(properties))
 }
 
-// PrintError is a helper that writes Info level log entries.
+// PrintError is a helper that writes Error level log entries.
 func (l *Logger) PrintError(err error, properties map[string]string) {
-	l.print(LevelError, err.Error(), properties)
+	l.print(LevelError, err.Error(), propertyFields(properties))
 }
 
-// PrintFatal is a helper that writes Info level log entries. It also terminates the application.
+// PrintFatal is a helper that writes Fatal level log entries. It also terminates the application.
 func (l *Logger) PrintFatal(err error, properties map[string]string) {
-	l.print(LevelFatal, err.Error(), properties)
+	l.print(LevelFatal, err.Error(), propertyFields(properties))
 	os.Exit(1)
 }
 
+// propertyFields converts the properties of the Print helpers to string fields.
+func propertyFields(properties map[string]string) []Field {
+	fields := make([]Field, 0, len(properties))
+	for key, value := range properties {
+		fields = append(fields, String(key, value))
+	}
+	return fields
+}
+
+// Enabled reports whether entries at the level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level() && level < LevelOff
+}
+
 // print is an internal method for writing a log entry.
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
+func (l *Logger) print(level Level, message string, fields []Field) (int, error) {
 	// If the severity level of the log entry is below the minimum severity for the logger
 	// then return with no further action
-	if level < l.minLevel {
+	if !l.Enabled(level) {
 		return 0, nil
 	}
+	if l.sampler != nil && level < LevelFatal && !l.sampler.allow(level, message) {
+		return 0, nil
+	}
+
+	// Gather the fields bound to the logger and those of the entry, the latter taking
+	// precedence.
+	var properties map[string]any
+	if len(l.fields)+len(fields) > 0 {
+		properties = make(map[string]any, len(l.fields)+len(fields))
+		for _, field := range l.fields {
+			properties[field.Key] = field.Value
+		}
+		for _, field := range fields {
+			properties[field.Key] = field.Value
+		}
+	}
 
 	// Declare an anonymous struct holding the data for the log entry.
 	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
+		Level      string         `json:"level"`
+		Time       string         `json:"time"`
+		Message    string         `json:"message"`
+		Properties map[string]any `json:"properties,omitempty"`
+		Trace      string         `json:"trace,omitempty"`
 	}{
 		Level:      level.String(),
 		Time:       time.Now().UTC().Format(time.RFC3339),
@@ -122,3 +288,40 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 func (l *Logger) Write(message []byte) (n int, err error) {
 	return l.print(LevelError, string(message), nil)
 }
+
+type sampleKey struct {
+	level   Level
+	message string
+}
+
+// sampler counts the entries written with each message in the current interval. All counts are
+// reset together when the interval ends, which keeps the map from growing with messages which
+// include variable text, such as errors.
+type sampler struct {
+	first      int
+	thereafter int
+	interval   time.Duration
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[sampleKey]int
+}
+
+// allow reports whether an entry with the level and message should be written.
+func (s *sampler) allow(level Level, message string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := time.Now(); now.Sub(s.start) >= s.interval {
+		s.start = now
+		clear(s.counts)
+	}
+
+	key := sampleKey{level, message}
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
@@ -0,0 +1,130 @@
+package jsonlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+type entry struct {
+	Level      string         `json:"level"`
+	Message    string         `json:"message"`
+	Properties map[string]any `json:"properties"`
+	Trace      string         `json:"trace"`
+}
+
+func entries(t *testing.T, buf *bytes.Buffer) []entry {
+	t.Helper()
+
+	var all []entry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, e)
+	}
+	return all
+}
+
+func TestLoggerFields(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, LevelDebug).With(String("request_id", "abc"))
+	logger.Warn("slow query", Int("rows", 3), Duration("took", 1500*time.Millisecond), Err(errors.New("boom")))
+
+	got := entries(t, &buf)
+	if len(got) != 1 {
+		t.Fatalf("got %d entries; want 1", len(got))
+	}
+	want := map[string]any{"request_id": "abc", "rows": float64(3), "took": "1.5s", "error": "boom"}
+	for key, value := range want {
+		if got[0].Properties[key] != value {
+			t.Errorf("got %s %v; want %v", key, got[0].Properties[key], value)
+		}
+	}
+	if got[0].Level != "WARN" || got[0].Trace != "" {
+		t.Errorf("got level %s with trace %q; want WARN without trace", got[0].Level, got[0].Trace)
+	}
+}
+
+func TestLoggerSetLevel(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	parent := NewLogger(&buf, LevelInfo)
+	child := parent.With(String("component", "test"))
+
+	child.Debug("hidden")
+	parent.SetLevel(LevelDebug)
+	child.Debug("shown")
+
+	if got := entries(t, &buf); len(got) != 1 || got[0].Message != "shown" {
+		t.Errorf("got entries %+v; want only the one after the level change", got)
+	}
+}
+
+func TestLoggerSampling(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, LevelInfo).WithSampling(2, 3, time.Hour)
+	for i := 0; i < 8; i++ {
+		logger.Info("noisy")
+	}
+	logger.Info("quiet")
+
+	// The first two, then every third after them: the 5th and 8th.
+	if got := strings.Count(buf.String(), `"noisy"`); got != 4 {
+		t.Errorf("got %d noisy entries; want 4", got)
+	}
+	if !strings.Contains(buf.String(), `"quiet"`) {
+		t.Error("a different message was sampled")
+	}
+}
+
+func TestLevelText(t *testing.T) {
+	t.Parallel()
+
+	for level := LevelDebug; level <= LevelOff; level++ {
+		text, err := level.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Level
+		if err := got.UnmarshalText(text); err != nil || got != level {
+			t.Errorf("round trip of %s gave %s, %v", level, got, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("want an error for an unknown level")
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	logger := slog.New(NewLogger(&buf, LevelInfo).Handler())
+	logger.Debug("hidden")
+	logger.With("library", "driver").WithGroup("conn").Info("connected", "attempts", 2, slog.Group("pool", "size", 5))
+
+	got := entries(t, &buf)
+	if len(got) != 1 {
+		t.Fatalf("got %d entries; want 1", len(got))
+	}
+	want := map[string]any{"library": "driver", "conn.attempts": float64(2), "conn.pool.size": float64(5)}
+	for key, value := range want {
+		if got[0].Properties[key] != value {
+			t.Errorf("got %s %v; want %v", key, got[0].Properties[key], value)
+		}
+	}
+}
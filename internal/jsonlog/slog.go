@@ -0,0 +1,92 @@
+package jsonlog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Handler returns a log/slog Handler which writes records through the logger, so that libraries
+// which log with slog write the same JSON entries as the rest of the application, subject to
+// its level and sampling. Attributes become fields, with the keys of groups joined by dots.
+func (l *Logger) Handler() slog.Handler {
+	return &slogHandler{logger: l}
+}
+
+type slogHandler struct {
+	logger *Logger
+	prefix string
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(fromSlogLevel(level))
+}
+
+func (h *slogHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := make([]Field, 0, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, attr)
+		return true
+	})
+
+	_, err := h.logger.print(fromSlogLevel(record.Level), record.Message, fields)
+	return err
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var fields []Field
+	for _, attr := range attrs {
+		fields = appendAttr(fields, h.prefix, attr)
+	}
+	return &slogHandler{logger: h.logger.With(fields...), prefix: h.prefix}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{logger: h.logger, prefix: h.prefix + name + "."}
+}
+
+// fromSlogLevel maps a slog level to the level at or below it.
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+// appendAttr appends the attribute to the fields as a typed field, flattening groups.
+func appendAttr(fields []Field, prefix string, attr slog.Attr) []Field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	key := prefix + attr.Key
+	switch attr.Value.Kind() {
+	case slog.KindGroup:
+		// Attributes of a group without a key belong to the enclosing group.
+		if attr.Key != "" {
+			prefix = key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			fields = appendAttr(fields, prefix, member)
+		}
+		return fields
+	case slog.KindDuration:
+		return append(fields, Duration(key, attr.Value.Duration()))
+	case slog.KindTime:
+		return append(fields, Time(key, attr.Value.Time()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return append(fields, String(key, err.Error()))
+		}
+	}
+	return append(fields, Any(key, attr.Value.Any()))
+}
@@ -0,0 +1,281 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+// MinRSABits is the smallest RSA modulus, in bits, which keys are accepted with.
+const MinRSABits = 2048
+
+var (
+	ErrNoSigningKey       = errors.New("no signing key in key set")
+	ErrUnsupportedKeyType = errors.New("unsupported key type, must be Ed25519 or RSA")
+	ErrWeakKey            = fmt.Errorf("key too weak, must be Ed25519 or RSA of at least %d bits", MinRSABits)
+)
+
+// Key is a single key in a KeySet. Keys which were loaded from a public key file have no private
+// key and can only be used to verify tokens, which is how retired keys are kept around until the
+// tokens they signed have expired.
+type Key struct {
+	ID         string
+	PublicKey  crypto.PublicKey
+	PrivateKey crypto.Signer
+}
+
+// KeySet holds the keys used to sign and verify JWTs. Tokens are always signed with the signing
+// key, while any key in the set is accepted when verifying, so keys can be rotated without
+// invalidating tokens signed with the previous key.
+type KeySet struct {
+	keys     []*Key
+	signing  *Key
+	register jwt.KeyRegister
+}
+
+// Load reads PEM-encoded Ed25519 or RSA keys from the files and returns a key set which signs
+// with the key with ID signingKeyID. If signingKeyID is empty, the first private key is used. Key
+// IDs are the RFC 7638 thumbprints of the public keys.
+func Load(files []string, signingKeyID string) (*KeySet, error) {
+	set := &KeySet{}
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			var block *pem.Block
+			block, b = pem.Decode(b)
+			if block == nil {
+				break
+			}
+
+			key, err := parsePEMBlock(block)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if err := checkStrength(key.PublicKey); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if err := set.add(key); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+
+	for _, key := range set.keys {
+		if key.PrivateKey == nil {
+			continue
+		}
+		if signingKeyID == "" || key.ID == signingKeyID {
+			set.signing = key
+			break
+		}
+	}
+	if set.signing == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	return set, nil
+}
+
+// Generate returns a key set containing a single new Ed25519 key. It is meant for development and
+// tests, since tokens signed with it stop validating when the process exits.
+func Generate() (*KeySet, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{}
+	key := &Key{PublicKey: privateKey.Public(), PrivateKey: privateKey}
+	if err := set.add(key); err != nil {
+		return nil, err
+	}
+	set.signing = set.keys[0]
+
+	return set, nil
+}
+
+// parsePEMBlock parses a PKCS #8 private key, PKCS #1 RSA private key or PKIX public key.
+func parsePEMBlock(block *pem.Block) (*Key, error) {
+	switch block.Type {
+	case "PRIVATE KEY", "RSA PRIVATE KEY":
+		var (
+			privateKey interface{}
+			err        error
+		)
+		if block.Type == "RSA PRIVATE KEY" {
+			privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		} else {
+			privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch privateKey := privateKey.(type) {
+		case ed25519.PrivateKey:
+			return &Key{PublicKey: privateKey.Public(), PrivateKey: privateKey}, nil
+		case *rsa.PrivateKey:
+			return &Key{PublicKey: privateKey.Public(), PrivateKey: privateKey}, nil
+		}
+		return nil, ErrUnsupportedKeyType
+
+	case "PUBLIC KEY":
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return &Key{PublicKey: publicKey}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// checkStrength returns ErrWeakKey for an RSA key with a modulus of less than MinRSABits or an
+// Ed25519 key of the wrong size, which can't be trusted to sign tokens.
+func checkStrength(publicKey crypto.PublicKey) error {
+	switch publicKey := publicKey.(type) {
+	case ed25519.PublicKey:
+		if len(publicKey) != ed25519.PublicKeySize {
+			return ErrWeakKey
+		}
+		return nil
+	case *rsa.PublicKey:
+		if publicKey.N.BitLen() < MinRSABits {
+			return ErrWeakKey
+		}
+		return nil
+	}
+
+	return ErrUnsupportedKeyType
+}
+
+// add computes the ID of the key and adds it to the set and its verification register.
+func (s *KeySet) add(key *Key) error {
+	jwk, err := publicJWK(key.PublicKey)
+	if err != nil {
+		return err
+	}
+	key.ID, err = thumbprint(jwk)
+	if err != nil {
+		return err
+	}
+
+	// Skip keys which are already in the set, such as a private key and its public key being
+	// listed in different files.
+	for _, existing := range s.keys {
+		if existing.ID == key.ID {
+			if existing.PrivateKey == nil {
+				existing.PrivateKey = key.PrivateKey
+			}
+			return nil
+		}
+	}
+
+	switch publicKey := key.PublicKey.(type) {
+	case ed25519.PublicKey:
+		s.register.EdDSAs = append(s.register.EdDSAs, publicKey)
+		s.register.EdDSAIDs = append(s.register.EdDSAIDs, key.ID)
+	case *rsa.PublicKey:
+		s.register.RSAs = append(s.register.RSAs, publicKey)
+		s.register.RSAIDs = append(s.register.RSAIDs, key.ID)
+	}
+
+	s.keys = append(s.keys, key)
+	return nil
+}
+
+// SigningKeyID returns the ID of the key which new tokens are signed with.
+func (s *KeySet) SigningKeyID() string {
+	return s.signing.ID
+}
+
+// Sign signs the claims with the signing key, setting the "kid" header to its ID.
+func (s *KeySet) Sign(claims *jwt.Claims) ([]byte, error) {
+	claims.KeyID = s.signing.ID
+
+	switch privateKey := s.signing.PrivateKey.(type) {
+	case ed25519.PrivateKey:
+		return claims.EdDSASign(privateKey)
+	case *rsa.PrivateKey:
+		return claims.RSASign(jwt.RS256, privateKey)
+	}
+
+	return nil, ErrUnsupportedKeyType
+}
+
+// Check parses the token if, and only if, it was signed by a key in the set. Use Claims.Valid
+// to check the validity window.
+func (s *KeySet) Check(token []byte) (*jwt.Claims, error) {
+	return s.register.Check(token)
+}
+
+// JWKs returns the public keys of the set as JSON Web Keys (RFC 7517), for publishing as the
+// "keys" member of a JWK Set which other services can use to verify tokens.
+func (s *KeySet) JWKs() ([]map[string]string, error) {
+	keys := make([]map[string]string, 0, len(s.keys))
+
+	for _, key := range s.keys {
+		jwk, err := publicJWK(key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		jwk["kid"] = key.ID
+		jwk["use"] = "sig"
+		if _, ok := key.PublicKey.(*rsa.PublicKey); ok {
+			jwk["alg"] = jwt.RS256
+		} else {
+			jwk["alg"] = jwt.EdDSA
+		}
+		keys = append(keys, jwk)
+	}
+
+	return keys, nil
+}
+
+// publicJWK returns the required members of the JWK representation of the public key.
+func publicJWK(publicKey crypto.PublicKey) (map[string]string, error) {
+	switch publicKey := publicKey.(type) {
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"x":   base64.RawURLEncoding.EncodeToString(publicKey),
+		}, nil
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		}, nil
+	}
+
+	return nil, ErrUnsupportedKeyType
+}
+
+// thumbprint returns the RFC 7638 JWK thumbprint of the required members of a JWK. The members
+// are serialized in lexicographic order, which encoding/json does for map keys.
+func thumbprint(jwk map[string]string) (string, error) {
+	b, err := json.Marshal(jwk)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,138 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+func TestThumbprint(t *testing.T) {
+	t.Parallel()
+
+	// The example RSA key from RFC 7638 section 3.1.
+	jwk := map[string]string{
+		"kty": "RSA",
+		"n":   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		"e":   "AQAB",
+	}
+
+	got, err := thumbprint(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("want %s; got %s", want, got)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	oldFile := writeKey(t, dir, "old.pem")
+	newFile := writeKey(t, dir, "new.pem")
+
+	// Tokens signed before the rotation use the old key.
+	before, err := Load([]string{oldFile, newFile}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims jwt.Claims
+	claims.Subject = "testID"
+	claims.Expires = jwt.NewNumericTime(time.Now().Add(time.Hour))
+	token, err := before.Sign(&claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After the rotation new tokens are signed with the new key, but old tokens still verify.
+	newKeyID := before.keys[1].ID
+	after, err := Load([]string{oldFile, newFile}, newKeyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.SigningKeyID() != newKeyID {
+		t.Errorf("want signing key %s; got %s", newKeyID, after.SigningKeyID())
+	}
+	got, err := after.Check(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.KeyID != before.SigningKeyID() || got.Subject != "testID" {
+		t.Errorf("unexpected claims: kid %s, sub %s", got.KeyID, got.Subject)
+	}
+
+	// Once the old key is removed, its tokens are rejected.
+	removed, err := Load([]string{newFile}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := removed.Check(token); err == nil {
+		t.Error("want token signed with removed key to be rejected")
+	}
+}
+
+func TestLoadWeakKey(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	weak := writeRSAKey(t, dir, "weak.pem", 1024)
+	strong := writeRSAKey(t, dir, "strong.pem", MinRSABits)
+
+	if _, err := Load([]string{weak}, ""); !errors.Is(err, ErrWeakKey) {
+		t.Errorf("got error %v loading a %d-bit RSA key; want %v", err, 1024, ErrWeakKey)
+	}
+	if _, err := Load([]string{strong}, ""); err != nil {
+		t.Errorf("got error %v loading a %d-bit RSA key; want nil", err, MinRSABits)
+	}
+
+	// An Ed25519 public key of the wrong size is never used, even for verifying.
+	if err := checkStrength(ed25519.PublicKey(make([]byte, 16))); !errors.Is(err, ErrWeakKey) {
+		t.Errorf("got error %v for a short Ed25519 key; want %v", err, ErrWeakKey)
+	}
+}
+
+func writeRSAKey(t *testing.T, dir, name string, bits int) string {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, name)
+	err = os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func writeKey(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, name)
+	err = os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
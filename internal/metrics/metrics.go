@@ -0,0 +1,187 @@
+// Package metrics collects the metrics of the API server and exposes them in the Prometheus text
+// exposition format.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// Metrics holds the collectors of the server, registered on their own registry so that several
+// servers, such as those of tests, can run in the same process. A nil *Metrics records nothing,
+// which is convenient for commands and tests which have no use for metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+	dbDuration       *prometheus.HistogramVec
+
+	registrations    *prometheus.CounterVec
+	vouchersRedeemed prometheus.Counter
+	vouchersUsed     prometheus.Counter
+	pointsEarned     *prometheus.CounterVec
+	pointsSpent      prometheus.Counter
+}
+
+// New returns Metrics with all of the collectors registered, along with the Go runtime and
+// process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests handled, by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Duration of HTTP requests, by method and route template.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests being handled.",
+		}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "mongodb_command_duration_seconds",
+			Help:    "Duration of MongoDB commands, by command name and outcome.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"command", "outcome"}),
+		registrations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "savingsquads_registrations_total",
+			Help: "Number of users registered, by method.",
+		}, []string{"method"}),
+		vouchersRedeemed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "savingsquads_vouchers_redeemed_total",
+			Help: "Number of vouchers redeemed by users.",
+		}),
+		vouchersUsed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "savingsquads_vouchers_used_total",
+			Help: "Number of vouchers used, by users or merchants.",
+		}),
+		pointsEarned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "savingsquads_points_earned_total",
+			Help: "Number of points earned by users, by source.",
+		}, []string{"source"}),
+		pointsSpent: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "savingsquads_points_spent_total",
+			Help: "Number of points exchanged for vouchers.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.requestsInFlight, m.dbDuration,
+		m.registrations, m.vouchersRedeemed, m.vouchersUsed, m.pointsEarned, m.pointsSpent,
+	)
+
+	return m
+}
+
+// Handler returns a handler which serves the metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// standardMethods are the request methods which are recorded by name.
+var standardMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// RequestStarted records that a request started, and returns a function to call with the route
+// template and status code once it has been handled. The route must be a template, such as
+// "/v1/voucher/{id}", rather than the path, to keep the number of series bounded. For the same
+// reason, methods other than the standard ones are recorded as "other".
+func (m *Metrics) RequestStarted(method string) func(route string, status int) {
+	if m == nil {
+		return func(string, int) {}
+	}
+
+	if !standardMethods[method] {
+		method = "other"
+	}
+
+	start := time.Now()
+	m.requestsInFlight.Inc()
+
+	return func(route string, status int) {
+		m.requestsInFlight.Dec()
+		m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		m.requestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// MongoMonitor returns a command monitor for the MongoDB client which records the duration of
+// every command the data layer runs.
+func (m *Metrics) MongoMonitor() *event.CommandMonitor {
+	if m == nil {
+		return nil
+	}
+
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			m.dbDuration.WithLabelValues(e.CommandName, "success").Observe(e.Duration.Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			m.dbDuration.WithLabelValues(e.CommandName, "failure").Observe(e.Duration.Seconds())
+		},
+	}
+}
+
+// UserRegistered records the registration of a user, by method such as "password" or "oidc".
+func (m *Metrics) UserRegistered(method string) {
+	if m == nil {
+		return
+	}
+	m.registrations.WithLabelValues(method).Inc()
+}
+
+// VoucherRedeemed records that a user redeemed a voucher.
+func (m *Metrics) VoucherRedeemed() {
+	if m == nil {
+		return
+	}
+	m.vouchersRedeemed.Inc()
+}
+
+// VoucherUsed records that a voucher was used.
+func (m *Metrics) VoucherUsed() {
+	if m == nil {
+		return
+	}
+	m.vouchersUsed.Inc()
+}
+
+// PointsEarned records the points earned by a user, by source such as "user" or "merchant".
+// Counters only go up, so deductions are ignored.
+func (m *Metrics) PointsEarned(source string, points int) {
+	if m == nil || points <= 0 {
+		return
+	}
+	m.pointsEarned.WithLabelValues(source).Add(float64(points))
+}
+
+// PointsSpent records the points a user exchanged for a voucher.
+func (m *Metrics) PointsSpent(points int) {
+	if m == nil || points <= 0 {
+		return
+	}
+	m.pointsSpent.Add(float64(points))
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := io.ReadAll(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	m := New()
+	done := m.RequestStarted(http.MethodGet)
+	if got := scrape(t, m); !strings.Contains(got, "http_requests_in_flight 1\n") {
+		t.Errorf("want one request in flight, got:\n%s", got)
+	}
+	done("/v1/voucher/{id}", http.StatusNotFound)
+	// Made up methods share a label, so that clients can't create series at will.
+	m.RequestStarted("FOO")("unmatched", http.StatusMethodNotAllowed)
+	m.RequestStarted("BAR")("unmatched", http.StatusMethodNotAllowed)
+
+	m.UserRegistered("password")
+	m.VoucherRedeemed()
+	m.VoucherUsed()
+	m.PointsEarned("merchant", 30)
+	m.PointsEarned("user", -10)
+	m.PointsSpent(20)
+
+	got := scrape(t, m)
+	for _, want := range []string{
+		`http_requests_in_flight 0`,
+		`http_requests_total{method="GET",route="/v1/voucher/{id}",status="404"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/v1/voucher/{id}"} 1`,
+		`http_requests_total{method="other",route="unmatched",status="405"} 2`,
+		`savingsquads_registrations_total{method="password"} 1`,
+		`savingsquads_vouchers_redeemed_total 1`,
+		`savingsquads_vouchers_used_total 1`,
+		`savingsquads_points_earned_total{source="merchant"} 30`,
+		`savingsquads_points_spent_total 20`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("missing %s", want)
+		}
+	}
+	if strings.Contains(got, `source="user"`) {
+		t.Error("a deduction was counted as points earned")
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	t.Parallel()
+
+	// A nil Metrics must be safe to record to.
+	var m *Metrics
+	m.RequestStarted(http.MethodGet)("/", http.StatusOK)
+	m.UserRegistered("password")
+	m.PointsEarned("user", 10)
+	if m.MongoMonitor() != nil {
+		t.Error("want no monitor")
+	}
+}
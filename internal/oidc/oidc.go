@@ -0,0 +1,333 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrNonceMismatch  = errors.New("id token nonce mismatch")
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+)
+
+// Config holds the settings of an OpenID Connect provider, such as Google or Apple.
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string `secret:"true"`
+	RedirectURL  string
+	Scopes       []string
+}
+
+// ParseConfig parses a provider configuration in the format
+// "name=google,issuer=https://accounts.google.com,client-id=...,client-secret=...,redirect-url=...",
+// with an optional space separated "scopes" entry.
+func ParseConfig(s string) (Config, error) {
+	var cfg Config
+
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return cfg, fmt.Errorf("oidc: invalid provider setting %q", field)
+		}
+		switch strings.TrimSpace(key) {
+		case "name":
+			cfg.Name = value
+		case "issuer":
+			cfg.Issuer = value
+		case "client-id":
+			cfg.ClientID = value
+		case "client-secret":
+			cfg.ClientSecret = value
+		case "redirect-url":
+			cfg.RedirectURL = value
+		case "scopes":
+			cfg.Scopes = strings.Fields(value)
+		default:
+			return cfg, fmt.Errorf("oidc: unknown provider setting %q", key)
+		}
+	}
+
+	if cfg.Name == "" || cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return cfg, errors.New("oidc: provider name, issuer, client-id and redirect-url must be provided")
+	}
+
+	return cfg, nil
+}
+
+// Claims holds the claims of a verified ID token which are used to sign a user in.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// discovery holds the fields of the provider metadata document which the relying party needs.
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect relying party for a single provider, using the authorization code
+// flow with PKCE. The provider metadata and signing keys are fetched on first use and cached; the
+// keys are refetched when a token is signed with an unknown key.
+type Provider struct {
+	Config
+	Client *http.Client
+
+	mu          sync.Mutex
+	discovery   *discovery
+	keys        *jwt.KeyRegister
+	keysFetched time.Time
+}
+
+// NewProvider returns a Provider for the configuration. The scopes default to "openid email
+// profile".
+func NewProvider(cfg Config) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{
+		Config: cfg,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// RandomString returns a random URL-safe string with 256 bits of entropy, for use as a state,
+// nonce or PKCE code verifier.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge returns the S256 PKCE code challenge for the code verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL of the provider's authorization endpoint to redirect the user to.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientID)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("scope", strings.Join(p.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", CodeChallenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + v.Encode(), nil
+}
+
+// Exchange redeems the authorization code at the token endpoint and verifies the returned ID
+// token against the nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Claims, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: decoding token response: %w", err)
+	}
+	if token.Error != "" {
+		return nil, fmt.Errorf("%w: %s: %s", ErrExchangeFailed, token.Error, token.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || token.IDToken == "" {
+		return nil, fmt.Errorf("%w: status %d without an id token", ErrExchangeFailed, resp.StatusCode)
+	}
+
+	return p.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature of the ID token against the provider's keys and validates
+// its issuer, audience, validity window and nonce.
+func (p *Provider) VerifyIDToken(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := p.getKeys(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := keys.Check([]byte(idToken))
+	if errors.Is(err, jwt.ErrSigMiss) {
+		// The provider may have rotated its keys since we last fetched them.
+		keys, err = p.getKeys(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		claims, err = keys.Check([]byte(idToken))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case claims.Issuer != d.Issuer:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	case !claims.AcceptAudience(p.ClientID):
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidIDToken)
+	case claims.Expires == nil || claims.AcceptTemporal(time.Now(), time.Minute) != nil:
+		return nil, fmt.Errorf("%w: expired or not yet valid", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	if got, _ := claims.String("nonce"); got != nonce {
+		return nil, ErrNonceMismatch
+	}
+
+	result := &Claims{Subject: claims.Subject}
+	result.Email, _ = claims.String("email")
+	result.Name, _ = claims.String("name")
+
+	// Most providers send email_verified as a boolean, but some (such as Apple) send a string.
+	switch verified := claims.Set["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+
+	return result, nil
+}
+
+// getDiscovery returns the provider metadata, fetching it on first use.
+func (p *Provider) getDiscovery(ctx context.Context) (*discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var d discovery
+	err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return nil, err
+	}
+	// The issuer in the metadata must exactly match the configured issuer, as required by
+	// OpenID Connect Discovery section 4.3.
+	if d.Issuer != p.Issuer {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", d.Issuer, p.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing endpoints")
+	}
+
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+// getKeys returns the provider's signing keys, fetching them on first use or when refresh is
+// set. Refreshes are limited to one a minute so that tokens with unknown keys can't be used to
+// hammer the provider.
+func (p *Provider) getKeys(ctx context.Context, refresh bool) (*jwt.KeyRegister, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && (!refresh || time.Since(p.keysFetched) < time.Minute) {
+		return p.keys, nil
+	}
+
+	var raw json.RawMessage
+	err = p.getJSON(ctx, d.JWKSURI, &raw)
+	if err != nil {
+		return nil, err
+	}
+	var keys jwt.KeyRegister
+	if _, err := keys.LoadJWK(raw); err != nil {
+		return nil, fmt.Errorf("oidc: loading provider keys: %w", err)
+	}
+
+	p.keys = &keys
+	p.keysFetched = time.Now()
+	return p.keys, nil
+}
+
+// getJSON fetches and decodes a JSON document.
+func (p *Provider) getJSON(ctx context.Context, u string, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: GET %s returned status %d", u, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(dst)
+}
@@ -0,0 +1,202 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+	"github.com/toduluz/savingsquadsbackend/internal/jwks"
+)
+
+// fakeIssuer is a minimal OpenID provider which issues an ID token for a single authorization
+// code, signed with keys from a jwks.KeySet.
+type fakeIssuer struct {
+	*httptest.Server
+	keys      *jwks.KeySet
+	claims    jwt.Claims
+	code      string
+	challenge string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	keys, err := jwks.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeIssuer{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.URL,
+			"authorization_endpoint": f.URL + "/authorize",
+			"token_endpoint":         f.URL + "/token",
+			"jwks_uri":               f.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		keys, _ := f.keys.JWKs()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		if r.PostFormValue("code") != f.code || CodeChallenge(r.PostFormValue("code_verifier")) != f.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token, err := f.keys.Sign(&f.claims)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": string(token), "token_type": "Bearer"})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+// authorize simulates the user approving the login at the authorization URL, returning the
+// code which the provider would redirect back with.
+func (f *fakeIssuer) authorize(t *testing.T, authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+
+	f.code = "code-123"
+	f.challenge = q.Get("code_challenge")
+	f.claims = jwt.Claims{Set: map[string]interface{}{
+		"nonce":          q.Get("nonce"),
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}}
+	f.claims.Issuer = f.URL
+	f.claims.Subject = "alice"
+	f.claims.Audiences = []string{q.Get("client_id")}
+	f.claims.Issued = jwt.NewNumericTime(time.Now())
+	f.claims.Expires = jwt.NewNumericTime(time.Now().Add(time.Hour))
+
+	return f.code, q.Get("state")
+}
+
+func TestProviderExchange(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := NewProvider(Config{
+		Name:         "fake",
+		Issuer:       f.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/callback",
+	})
+
+	tests := []struct {
+		name    string
+		mutate  func(c *jwt.Claims)
+		nonce   string
+		wantErr error
+	}{
+		{name: "Valid"},
+		{name: "Wrong nonce", nonce: "other", wantErr: ErrNonceMismatch},
+		{name: "Wrong audience", mutate: func(c *jwt.Claims) { c.Audiences = []string{"someone-else"} }, wantErr: ErrInvalidIDToken},
+		{name: "Wrong issuer", mutate: func(c *jwt.Claims) { c.Issuer = "https://evil.example.com" }, wantErr: ErrInvalidIDToken},
+		{name: "Expired", mutate: func(c *jwt.Claims) { c.Expires = jwt.NewNumericTime(time.Now().Add(-time.Hour)) }, wantErr: ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			nonce, _ := RandomString()
+			verifier, _ := RandomString()
+
+			authURL, err := p.AuthCodeURL(ctx, "state-123", nonce, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, state := f.authorize(t, authURL)
+			if state != "state-123" {
+				t.Errorf("got state %q; want %q", state, "state-123")
+			}
+			if tt.mutate != nil {
+				tt.mutate(&f.claims)
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			claims, err := p.Exchange(ctx, code, verifier, nonce)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v; want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if claims.Subject != "alice" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestProviderExchangeWrongVerifier(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := NewProvider(Config{Issuer: f.URL, ClientID: "client", ClientSecret: "secret"})
+
+	ctx := context.Background()
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := f.authorize(t, authURL)
+
+	_, err = p.Exchange(ctx, code, "another-verifier", "nonce")
+	if err == nil {
+		t.Fatal("expected exchange with the wrong code verifier to fail")
+	}
+}
+
+func TestProviderKeyRotation(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := NewProvider(Config{Issuer: f.URL, ClientID: "client", ClientSecret: "secret"})
+
+	ctx := context.Background()
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := f.authorize(t, authURL)
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate the issuer's key. The cached keys were fetched less than a minute ago, so the
+	// provider must not refetch them and the new token is rejected.
+	f.keys, err = jwks.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("got error %v; want %v", err, ErrInvalidIDToken)
+	}
+
+	// Once the refresh interval has passed, the unknown key triggers a refetch.
+	p.keysFetched = time.Now().Add(-2 * time.Minute)
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestCode(t *testing.T) {
+	t.Parallel()
+
+	// The SHA1 test vectors from RFC 6238 Appendix B, truncated to six digits.
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name string
+		time int64
+		want string
+	}{
+		{"59", 59, "287082"},
+		{"1111111109", 1111111109, "081804"},
+		{"1111111111", 1111111111, "050471"},
+		{"1234567890", 1234567890, "005924"},
+		{"2000000000", 2000000000, "279037"},
+		{"20000000000", 20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Code(secret, Step(time.Unix(tt.time, 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("want %s; got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	code, err := Code(secret, Step(now.Add(-Period*time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := Validate(secret, code, now, 1); !ok {
+		t.Error("want code from previous step to be accepted with a skew of 1")
+	}
+	if _, ok := Validate(secret, code, now, 0); ok {
+		t.Error("want code from previous step to be rejected with a skew of 0")
+	}
+	if _, ok := Validate(secret, "abc", now, 1); ok {
+		t.Error("want malformed code to be rejected")
+	}
+}
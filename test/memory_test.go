@@ -0,0 +1,85 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMemoryUserJourney(t *testing.T) {
+	t.Parallel()
+
+	routes := newMemoryTestApplication(t).Routes()
+
+	var token string
+	do := func(method, url, body string) (int, map[string]interface{}) {
+		t.Helper()
+
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s %s: %v", method, url, err)
+		}
+		return rr.Code, got
+	}
+
+	code, body := do(http.MethodPost, "/v1/user/register?mode=token", `{"name":"Test User","email":"test@example.com","password":"password123"}`)
+	if code != http.StatusAccepted {
+		t.Fatalf("register: got status %d; want %d: %v", code, http.StatusAccepted, body)
+	}
+
+	code, _ = do(http.MethodPost, "/v1/user/register?mode=token", `{"name":"Test User","email":"test@example.com","password":"password123"}`)
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("duplicate register: got status %d; want %d", code, http.StatusUnprocessableEntity)
+	}
+
+	code, body = do(http.MethodPost, "/v1/user/login?mode=token", `{"email":"test@example.com","password":"password123"}`)
+	if code != http.StatusCreated {
+		t.Fatalf("login: got status %d; want %d: %v", code, http.StatusCreated, body)
+	}
+	authToken, _ := body["authentication_token"].(map[string]interface{})
+	token, _ = authToken["token"].(string)
+
+	steps := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		wantCode int
+	}{
+		{"Add points", http.MethodPut, "/v1/user/point", `{"points":100}`, http.StatusOK},
+		{"Exchange points", http.MethodPost, "/v1/user/point/exchange", `{"points":80,"description":"Ten off","discount":10,"duration":24}`, http.StatusOK},
+		{"Exchange without enough points", http.MethodPost, "/v1/user/point/exchange", `{"points":80,"description":"Ten off","discount":10,"duration":24}`, http.StatusForbidden},
+		{"Points", http.MethodGet, "/v1/user/point", "", http.StatusOK},
+		{"Vouchers", http.MethodGet, "/v1/user/voucher", "", http.StatusOK},
+		{"Logout", http.MethodPost, "/v1/user/logout", "", http.StatusOK},
+		{"Points after logout", http.MethodGet, "/v1/user/point", "", http.StatusUnauthorized},
+	}
+
+	for _, step := range steps {
+		code, body := do(step.method, step.url, step.body)
+		if code != step.wantCode {
+			t.Fatalf("%s: got status %d; want %d: %v", step.name, code, step.wantCode, body)
+		}
+
+		switch step.name {
+		case "Points":
+			if body["points"] != float64(20) {
+				t.Errorf("got points %v; want 20", body["points"])
+			}
+		case "Vouchers":
+			if vouchers, _ := body["vouchers"].([]interface{}); len(vouchers) != 1 {
+				t.Errorf("got vouchers %v; want one voucher", body["vouchers"])
+			}
+		}
+	}
+}
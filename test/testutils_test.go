@@ -9,6 +9,7 @@ import (
 	"github.com/toduluz/savingsquadsbackend/api"
 	"github.com/toduluz/savingsquadsbackend/internal/data"
 	"github.com/toduluz/savingsquadsbackend/internal/jsonlog"
+	"github.com/toduluz/savingsquadsbackend/internal/jwks"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -18,7 +19,14 @@ func newIntegrationTestApplication(t *testing.T) (*api.Application, func()) {
 
 	var cfg api.Config
 
-	cfg.Jwt.Secret = "secret"
+	cfg.Cookie.Keys = [][]byte{[]byte("0123456789abcdef0123456789abcdef")}
+	cfg.Jwt.Issuer = "savingsquads"
+	cfg.Jwt.Audience = "savingsquads"
+
+	keys, err := jwks.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Get the MongoDB URI from the environment variable.
 	mongoURI := os.Getenv("MONGOURILOCAL")
@@ -32,14 +40,18 @@ func newIntegrationTestApplication(t *testing.T) (*api.Application, func()) {
 		t.Fatal(err)
 	}
 
-	// Create a new database.
+	// Create a new database with the indexes the models rely on.
 	db := client.Database("test")
+	if _, err := data.MigrateMongo(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
 
 	// Declare an instance of the Application struct, containing the Config struct and the infoLog.
 	app := &api.Application{
 		Config: cfg,
 		Logger: jsonlog.NewLogger(io.Discard, jsonlog.LevelOff),
-		Models: data.NewModels(db),
+		Models: data.NewModels(db, data.DefaultQueryTimeout),
+		Keys:   keys,
 	}
 
 	return app, func() {
@@ -53,3 +65,27 @@ func newIntegrationTestApplication(t *testing.T) (*api.Application, func()) {
 		}
 	}
 }
+
+// newMemoryTestApplication returns an application backed by the in-memory storage, which needs no
+// database.
+func newMemoryTestApplication(t *testing.T) *api.Application {
+	t.Helper()
+
+	var cfg api.Config
+
+	cfg.Cookie.Keys = [][]byte{[]byte("0123456789abcdef0123456789abcdef")}
+	cfg.Jwt.Issuer = "savingsquads"
+	cfg.Jwt.Audience = "savingsquads"
+
+	keys, err := jwks.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &api.Application{
+		Config: cfg,
+		Logger: jsonlog.NewLogger(io.Discard, jsonlog.LevelOff),
+		Models: data.NewMemoryModels(),
+		Keys:   keys,
+	}
+}